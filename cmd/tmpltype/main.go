@@ -1,102 +1,319 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
 
+	"github.com/bellwood4486/tmpltype/internal/config"
+	"github.com/bellwood4486/tmpltype/internal/diag"
+	"github.com/bellwood4486/tmpltype/internal/diff"
 	"github.com/bellwood4486/tmpltype/internal/gen"
+	"github.com/bellwood4486/tmpltype/internal/logger"
 )
 
 func main() {
-	dir := flag.String("dir", "", "template directory (required)")
-	pkg := flag.String("pkg", "", "output package name (required)")
-	out := flag.String("out", "", "output .go file path (required)")
-	flag.Parse()
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
 
-	if *dir == "" || *pkg == "" || *out == "" {
-		fmt.Fprintln(os.Stderr, "usage: tmpltype -dir <directory> -pkg <name> -out <file>")
-		os.Exit(2)
+// run はコマンドライン引数 args でコード生成を実行し、終了ステータスを返す
+// 0: 成功、1: エラーまたは -check で生成ファイルが古い、2: 引数の誤り
+func run(args []string, stdout, stderr io.Writer) int {
+	fl, err := parseFlags(args, stderr)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fl.format != formatText && fl.format != formatJSON {
+		return usage(stderr)
 	}
 
-	// ディレクトリの存在確認
-	if _, err := os.Stat(*dir); os.IsNotExist(err) {
-		fmt.Fprintf(os.Stderr, "Error: directory not found: %s\n", *dir)
-		os.Exit(1)
+	r := &reporter{format: fl.format, stdout: stdout, stderr: stderr}
+	if fl.format == formatJSON || fl.check {
+		// 標準出力は JSON または -check の差分のみにするため、ログは標準エラー出力に出す
+		logger.SetOutput(stderr)
+	} else {
+		logger.SetOutput(stdout)
 	}
 
-	// テンプレートファイルをスキャン
-	files, err := scanTemplateFiles(*dir)
+	// 設定ファイルを読み込み、明示的に指定されたフラグで上書きする
+	cfg, err := loadConfig(fl.configPath)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, fmt.Errorf("failed to scan directory: %w", err))
-		os.Exit(1)
+		return r.fail(err)
+	}
+	applyFlags(cfg, fl)
+	if (len(cfg.Dirs) == 0 && len(cfg.Patterns) == 0) || cfg.Package == "" || cfg.Output == "" {
+		return usage(stderr)
+	}
+
+	// -dir と位置引数のパターンからテンプレートファイルを集める
+	files, err := collectTemplateFiles(cfg.Dirs, cfg.Patterns, cfg.Exclude)
+	if err != nil {
+		return r.fail(err)
 	}
 
 	if len(files) == 0 {
-		fmt.Fprintf(os.Stderr, "Error: no .tmpl files found in %s/\n", *dir)
-		os.Exit(1)
+		return r.fail(fmt.Errorf("no .tmpl files found in %s", strings.Join(append(cfg.Dirs, cfg.Patterns...), ", ")))
 	}
 
 	// 複数のテンプレートを処理
 	specs := make([]gen.TemplateSpec, 0, len(files))
-	outDir := filepath.Dir(*out)
+	names := make([]string, 0, len(files))
+	outDir := filepath.Dir(cfg.Output)
 
-	for _, file := range files {
+	for _, tf := range files {
+		file := tf.path
 		src, err := os.ReadFile(file)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, fmt.Errorf("failed to read %s: %w", file, err))
-			os.Exit(1)
+			return r.fail(fmt.Errorf("failed to read %s: %w", file, err))
 		}
 
-		// テンプレート名を抽出
-		templateName, err := extractTemplateName(file, *dir)
+		// テンプレート名を抽出（入力のベースディレクトリからの相対パス）
+		templateName, err := extractTemplateName(file, tf.base)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, fmt.Errorf("failed to extract template name from %s: %w", file, err))
-			os.Exit(1)
+			return r.fail(fmt.Errorf("failed to extract template name from %s: %w", file, err))
 		}
 
 		// ファイルパスを計算（出力ディレクトリからの相対パス）
 		relPath, err := filepath.Rel(outDir, file)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, fmt.Errorf("failed to get relative path for %s: %w", file, err))
-			os.Exit(1)
+			return r.fail(fmt.Errorf("failed to get relative path for %s: %w", file, err))
 		}
 
-		specs = append(specs, gen.TemplateSpec{
+		spec := gen.TemplateSpec{
 			Name:     templateName,
-			Pkg:      *pkg,
+			Pkg:      cfg.Package,
 			FilePath: relPath,
 			Source:   string(src),
-		})
+			HTML:     isHTMLTemplate(file),
+		}
+		cfg.Apply(&spec)
+		specs = append(specs, spec)
+		names = append(names, templateName)
+	}
+
+	// 設定ファイルのテンプレート名の書き間違いを検出
+	// 入力をフラグで絞り込んだ場合は、設定にあるテンプレートが含まれないこともあるため検証しない
+	if !fl.inputsOverridden() {
+		if err := cfg.CheckTemplates(names); err != nil {
+			return r.fail(err)
+		}
 	}
 
 	// コード生成
-	result, err := gen.Emit(specs)
+	// @import と -funcs のパッケージは出力パッケージのモジュールから解決する
+	opts := append(cfg.Options(), gen.WithPackageDir(outDir))
+	opts = append(opts, fl.importOptions()...)
+	result, err := gen.Emit(specs, opts...)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, fmt.Errorf("failed to emit: %w", err))
-		os.Exit(1)
+		// テンプレート上の位置が分かるエラーは "file:line:col: error: message" の形式で出力
+		return r.fail(relocateDiagnostic(diag.FromError(err), outDir))
 	}
 
 	// 警告を出力
 	for _, warning := range result.Warnings {
-		fmt.Fprintln(os.Stderr, warning)
+		r.report(relocateDiagnostic(warning, outDir))
 	}
 
-	// メインファイルを書き込み
-	if err := os.WriteFile(*out, []byte(result.MainCode), 0644); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+	outputs := []generatedFile{
+		{path: cfg.Output, content: result.MainCode},
+		// テンプレート文字列リテラル（-embed の場合は go:embed）ファイル
+		{path: generateSourcesPath(cfg.Output), content: result.SourcesCode},
 	}
 
-	// テンプレート文字列リテラルファイルを書き込み
-	sourcesPath := generateSourcesPath(*out)
-	if err := os.WriteFile(sourcesPath, []byte(result.SourcesCode), 0644); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+	// -check の場合は書き込まずにディスク上のファイルと比較する
+	// JSON 形式では差分を出力せず、古くなったファイルごとの診断だけを出力する
+	if fl.check {
+		diffOut := stdout
+		if fl.format == formatJSON {
+			diffOut = io.Discard
+		}
+		stale, err := checkGeneratedFiles(diffOut, outputs)
+		if err != nil {
+			return r.fail(err)
+		}
+		for _, path := range stale {
+			r.report(diag.Errorf(diag.CodeStale, path, 0, 0, "generated code is out of date; run go generate"))
+		}
+		r.flush()
+		if len(stale) > 0 {
+			return 1
+		}
+		return 0
+	}
+
+	for _, f := range outputs {
+		if err := os.WriteFile(f.path, []byte(f.content), 0644); err != nil {
+			return r.fail(err)
+		}
+	}
+	r.flush()
+	return 0
+}
+
+// cliFlags はコマンドラインで指定されたフラグと位置引数
+type cliFlags struct {
+	dirs, excludes, imports, funcs     stringList
+	pkg, out                           string
+	html, embed, sharedTypes, renderer bool
+	check                              bool
+	format                             string
+	configPath                         string
+	patterns                           []string        // 位置引数の glob パターン
+	set                                map[string]bool // 明示的に指定されたフラグ名
+}
+
+// parseFlags はコマンドライン引数を解析する
+// 位置引数は glob パターン（カンマ区切りで複数指定も可）として扱う
+// 解析エラーと -h の使い方は output に出力する
+func parseFlags(args []string, output io.Writer) (*cliFlags, error) {
+	fl := &cliFlags{set: make(map[string]bool)}
+	fs := flag.NewFlagSet("tmpltype", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.Var(&fl.dirs, "dir", "template directory, scanned recursively (repeatable)")
+	fs.Var(&fl.excludes, "exclude", "skip template files or directories matching the pattern (repeatable)")
+	fs.Var(&fl.imports, "import", "make a package available to @param types as name=path, or path to use the package's own name (repeatable)")
+	fs.Var(&fl.funcs, "funcs", "function or variable that defines the template.FuncMap, as <import path>.<name>; its signatures are used to infer and check arguments (repeatable)")
+	fs.StringVar(&fl.pkg, "pkg", "", "output package name (required unless set in the config file)")
+	fs.StringVar(&fl.out, "out", "", "output .go file path (required unless set in the config file)")
+	fs.BoolVar(&fl.html, "html", false, "generate code using html/template (auto-enabled for *.html.tmpl)")
+	fs.BoolVar(&fl.embed, "embed", false, "embed the original .tmpl files with //go:embed instead of copying them into string literals")
+	fs.BoolVar(&fl.sharedTypes, "shared-types", false, "generate one shared type for named types with the same name and structure across templates")
+	fs.BoolVar(&fl.renderer, "renderer", false, "generate a Renderer type that owns its templates and options; package-level functions use a default instance")
+	fs.BoolVar(&fl.check, "check", false, "do not write files; print a diff and exit with status 1 if the generated files are out of date")
+	fs.StringVar(&fl.format, "format", formatText, "diagnostics output format: text or json")
+	fs.StringVar(&fl.configPath, "config", "", "config file (default: tmpltype.yaml, tmpltype.yml or tmpltype.toml in the current directory, if present)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	fs.Visit(func(f *flag.Flag) { fl.set[f.Name] = true })
+
+	for _, arg := range fs.Args() {
+		for _, p := range strings.Split(arg, ",") {
+			if p != "" {
+				fl.patterns = append(fl.patterns, p)
+			}
+		}
 	}
+	return fl, nil
+}
+
+// inputsOverridden は -dir または位置引数でテンプレートの入力が指定されたかを返す
+func (fl *cliFlags) inputsOverridden() bool {
+	return len(fl.dirs) > 0 || len(fl.patterns) > 0
+}
+
+// applyFlags は明示的に指定されたフラグで設定ファイルの値を上書きする
+// -dir と位置引数は、どちらか一方でも指定されると dirs と patterns の両方を置き換える
+func applyFlags(cfg *config.Config, fl *cliFlags) {
+	if fl.set["pkg"] {
+		cfg.Package = fl.pkg
+	}
+	if fl.set["out"] {
+		cfg.Output = fl.out
+	}
+	if fl.inputsOverridden() {
+		cfg.Dirs, cfg.Patterns = fl.dirs, fl.patterns
+	}
+	if fl.set["exclude"] {
+		cfg.Exclude = fl.excludes
+	}
+	if fl.set["import"] {
+		// -import は名前を省略できるため、設定のマップには入れずに importOptions で渡す
+		cfg.Imports = nil
+	}
+	if fl.set["funcs"] {
+		cfg.Funcs = fl.funcs
+	}
+	if fl.set["html"] {
+		cfg.HTML = fl.html
+	}
+	if fl.set["embed"] {
+		cfg.Embed = fl.embed
+	}
+	if fl.set["shared-types"] {
+		cfg.SharedTypes = fl.sharedTypes
+	}
+	if fl.set["renderer"] {
+		cfg.Renderer = fl.renderer
+	}
+}
+
+// importOptions は -import の値（name=path または path）をコード生成オプションに変換する
+func (fl *cliFlags) importOptions() []gen.Option {
+	var opts []gen.Option
+	for _, imp := range fl.imports {
+		name, path, ok := strings.Cut(imp, "=")
+		if !ok {
+			name, path = "", imp
+		}
+		opts = append(opts, gen.WithImport(name, path))
+	}
+	return opts
+}
+
+// usage は使い方を w に表示し、終了ステータス2を返す
+func usage(w io.Writer) int {
+	fmt.Fprintln(w, "usage: tmpltype [-config <file>] [-dir <directory>]... -pkg <name> -out <file> [-exclude <pattern>]... [-import [<name>=]<path>]... [-funcs <path>.<name>]... [-html] [-embed] [-shared-types] [-renderer] [-check] [-format=text|json] [pattern ...]")
+	return 2
+}
+
+// loadConfig は設定ファイルを読み込む
+// path が空ならカレントディレクトリの設定ファイルを探し、なければ空の設定を返す
+func loadConfig(path string) (*config.Config, error) {
+	if path == "" {
+		found, err := config.Find(".")
+		if err != nil {
+			return nil, err
+		}
+		if found == "" {
+			return &config.Config{}, nil
+		}
+		path = found
+	}
+	return config.Load(path)
+}
+
+// relocateDiagnostic は出力ディレクトリからの相対パスで記録された Diagnostic のファイルを、
+// カレントディレクトリからのパスに直す（TemplateSpec.FilePath は出力ディレクトリ基準のため）
+func relocateDiagnostic(d *diag.Diagnostic, outDir string) *diag.Diagnostic {
+	if d.File != "" && !filepath.IsAbs(d.File) {
+		d.File = filepath.Join(outDir, d.File)
+	}
+	return d
+}
+
+// generatedFile は書き込み対象の生成ファイル
+type generatedFile struct {
+	path    string
+	content string
+}
+
+// checkGeneratedFiles は生成結果をディスク上のファイルと比較し、差分を unified diff 形式で w に出力する
+// 内容が異なるファイルのパスを返す。存在しないファイルは空のファイルとして比較する
+func checkGeneratedFiles(w io.Writer, files []generatedFile) ([]string, error) {
+	var stale []string
+	for _, f := range files {
+		current, err := os.ReadFile(f.path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read %s: %w", f.path, err)
+		}
+
+		name := filepath.ToSlash(f.path)
+		if d := diff.Unified("a/"+name, "b/"+name, string(current), f.content); d != "" {
+			fmt.Fprint(w, d)
+			stale = append(stale, f.path)
+		}
+	}
+	return stale, nil
 }
 
 // generateSourcesPath は出力ファイルパスからテンプレート文字列リテラルファイルのパスを生成する
@@ -119,26 +336,141 @@ func generateSourcesPath(outPath string) string {
 	return filepath.Join(dir, sourcesName+ext)
 }
 
-// scanTemplateFiles はディレクトリから.tmplファイルをスキャンする
-// dir/*.tmpl (フラット) と dir/*/*.tmpl (グループ) のみを対象とする
-func scanTemplateFiles(dir string) ([]string, error) {
-	var files []string
+// stringList は繰り返し指定できる文字列フラグ
+type stringList []string
 
-	// フラットなテンプレート: dir/*.tmpl
-	flatPattern := filepath.Join(dir, "*.tmpl")
-	flatFiles, err := filepath.Glob(flatPattern)
-	if err != nil {
-		return nil, fmt.Errorf("failed to scan flat templates: %w", err)
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// templateFile は入力として集めたテンプレートファイル
+// テンプレート名は base からの相対パスで決まる
+type templateFile struct {
+	path string
+	base string
+}
+
+// collectTemplateFiles は -dir のディレクトリと位置引数の glob パターンからテンプレートファイルを集める
+// excludes に一致するファイル・ディレクトリは除外し、複数の入力から見つかった同じファイルは1つにまとめる
+func collectTemplateFiles(dirs, patterns, excludes []string) ([]templateFile, error) {
+	var files []templateFile
+	seen := make(map[string]bool)
+	add := func(path, base string) {
+		path = filepath.Clean(path)
+		if seen[path] || isExcluded(path, excludes) {
+			return
+		}
+		seen[path] = true
+		files = append(files, templateFile{path: path, base: base})
+	}
+
+	for _, dir := range dirs {
+		// ディレクトリの存在確認
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			return nil, fmt.Errorf("directory not found: %s", dir)
+		}
+
+		// テンプレートファイルをスキャン
+		paths, err := scanTemplateFiles(dir, excludes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan directory: %w", err)
+		}
+		for _, path := range paths {
+			add(path, dir)
+		}
+	}
+
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("pattern %q matched no files", pattern)
+		}
+		base := globBase(pattern)
+		for _, path := range matches {
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				add(path, base)
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// globBase はパターンのうちワイルドカードを含まない先頭のディレクトリ部分を返す
+// ワイルドカード部分に含まれるディレクトリはグループになる
+// 例: "templates/*.tmpl" -> "templates", "templates/*/*.tmpl" -> "templates", "a.tmpl" -> "."
+func globBase(pattern string) string {
+	base := filepath.Dir(pattern)
+	for base != "." && base != string(filepath.Separator) && hasMeta(base) {
+		base = filepath.Dir(base)
+	}
+	if hasMeta(base) {
+		return "."
+	}
+	return base
+}
+
+// hasMeta はパスに filepath.Match のワイルドカード文字が含まれるかを判定する
+func hasMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[\`)
+}
+
+// isExcluded はパスが除外パターンのどれかに一致するかを判定する
+// "/" を含むパターンはパス自身とその親ディレクトリのパスと、含まないパターンはパスの各要素（ファイル名・ディレクトリ名）と照合する
+// パターンとパスはどちらも filepath.Clean で正規化する（"./templates/x.tmpl" や末尾の "/" を許す）
+func isExcluded(path string, excludes []string) bool {
+	elems := strings.Split(filepath.ToSlash(filepath.Clean(path)), "/")
+	for _, pattern := range excludes {
+		pattern = filepath.ToSlash(filepath.Clean(pattern))
+		if strings.Contains(pattern, "/") {
+			for i := range elems {
+				if ok, _ := filepath.Match(pattern, strings.Join(elems[:i+1], "/")); ok {
+					return true
+				}
+			}
+			continue
+		}
+		for _, elem := range elems {
+			if ok, _ := filepath.Match(pattern, elem); ok {
+				return true
+			}
+		}
 	}
-	files = append(files, flatFiles...)
+	return false
+}
 
-	// グループ化されたテンプレート: dir/*/*.tmpl (1階層のみ)
-	groupPattern := filepath.Join(dir, "*", "*.tmpl")
-	groupFiles, err := filepath.Glob(groupPattern)
+// scanTemplateFiles はディレクトリを再帰的に走査して.tmplファイルをスキャンする
+// サブディレクトリは任意の深さまでグループとして扱う
+// "." で始まる隠しディレクトリ・隠しファイルと、除外パターンに一致するディレクトリはスキップする
+func scanTemplateFiles(dir string, excludes []string) ([]string, error) {
+	var files []string
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && (strings.HasPrefix(d.Name(), ".") || isExcluded(path, excludes)) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && filepath.Ext(path) == ".tmpl" {
+			files = append(files, path)
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to scan grouped templates: %w", err)
+		return nil, fmt.Errorf("failed to scan templates: %w", err)
 	}
-	files = append(files, groupFiles...)
 
 	return files, nil
 }
@@ -147,6 +479,7 @@ func scanTemplateFiles(dir string) ([]string, error) {
 // basedir からの相対パスでグループ判定を行う
 // 例: basedir="templates", path="templates/footer.tmpl" -> "footer" (フラット)
 // 例: basedir="templates", path="templates/email/welcome.tmpl" -> "email/welcome" (グループ)
+// 例: basedir="templates", path="templates/mail/invite/html.tmpl" -> "mail/invite/html" (ネストしたグループ)
 func extractTemplateName(path string, basedir string) (string, error) {
 	// basedir からの相対パスを取得
 	absPath, err := filepath.Abs(path)
@@ -163,8 +496,9 @@ func extractTemplateName(path string, basedir string) (string, error) {
 		return "", fmt.Errorf("path %s is not under basedir %s", path, basedir)
 	}
 
-	// 拡張子を削除
+	// 拡張子を削除（"email.html.tmpl" の場合は ".html" も削除）
 	pathWithoutExt := strings.TrimSuffix(relPath, filepath.Ext(relPath))
+	pathWithoutExt = strings.TrimSuffix(pathWithoutExt, htmlSuffix)
 
 	// ディレクトリ区切りで分割
 	parts := strings.Split(filepath.ToSlash(pathWithoutExt), "/")
@@ -174,15 +508,18 @@ func extractTemplateName(path string, basedir string) (string, error) {
 		parts[i] = cleanName(part)
 	}
 
-	// 階層チェック（フラット=1パーツ、グループ=2パーツ、それ以上はエラー）
-	if len(parts) > 2 {
-		return "", fmt.Errorf("template nesting too deep: %s (max 1 level of grouping)", relPath)
-	}
-
 	// パスとして結合
 	return strings.Join(parts, "/"), nil
 }
 
+// htmlSuffix は html/template として扱うテンプレートファイルの拡張子の前半部分
+const htmlSuffix = ".html"
+
+// isHTMLTemplate はファイル名が *.html.tmpl かどうかを判定する
+func isHTMLTemplate(path string) bool {
+	return strings.HasSuffix(path, htmlSuffix+".tmpl")
+}
+
 // cleanName は名前から数字プレフィックスを削除し、ハイフンをアンダースコアに変換する
 func cleanName(name string) string {
 	// 数字プレフィックスを削除（例: "01_header" -> "header", "1-mail" -> "mail"）
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bellwood4486/tmpltype/internal/config"
+)
+
+func TestIsExcluded(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		excludes []string
+		want     bool
+	}{
+		{name: "name pattern matches file", path: "templates/x_test.tmpl", excludes: []string{"*_test.tmpl"}, want: true},
+		{name: "name pattern matches directory element", path: "templates/drafts/x.tmpl", excludes: []string{"drafts"}, want: true},
+		{name: "path pattern matches file", path: "templates/x.tmpl", excludes: []string{"templates/x.tmpl"}, want: true},
+		{name: "path pattern is cleaned", path: "templates/x.tmpl", excludes: []string{"./templates/x.tmpl"}, want: true},
+		{name: "path pattern matches parent directory", path: "templates/legacy/x.tmpl", excludes: []string{"templates/legacy"}, want: true},
+		{name: "path pattern with trailing slash", path: "templates/legacy/x.tmpl", excludes: []string{"templates/legacy/"}, want: true},
+		{name: "path pattern does not match sibling", path: "templates/legacy2/x.tmpl", excludes: []string{"templates/legacy"}, want: false},
+		{name: "path pattern is not matched against elements", path: "other/templates/legacy/x.tmpl", excludes: []string{"templates/legacy"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isExcluded(tt.path, tt.excludes); got != tt.want {
+				t.Errorf("isExcluded(%q, %q) = %v, want %v", tt.path, tt.excludes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollectTemplateFiles_ExcludeDirectoryPath(t *testing.T) {
+	t.Chdir(t.TempDir())
+	for _, path := range []string{
+		"templates/a.tmpl",
+		"templates/legacy/b.tmpl",
+		"templates/legacy/old/c.tmpl",
+		"templates/x.tmpl",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("{{ .Name }}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 走査の段階で "/" を含むパターンに一致するディレクトリに入らないこと
+	paths, err := scanTemplateFiles("./templates", []string{"templates/legacy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var scanned []string
+	for _, path := range paths {
+		scanned = append(scanned, filepath.ToSlash(path))
+	}
+	wantScanned := []string{"templates/a.tmpl", "templates/x.tmpl"}
+	if !reflect.DeepEqual(scanned, wantScanned) {
+		t.Errorf("scanTemplateFiles() = %q, want %q", scanned, wantScanned)
+	}
+
+	files, err := collectTemplateFiles([]string{"./templates"}, nil, []string{"templates/legacy", "./templates/x.tmpl"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range files {
+		got = append(got, filepath.ToSlash(f.path))
+	}
+	want := []string{"templates/a.tmpl"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("collectTemplateFiles() = %q, want %q", got, want)
+	}
+}
+
+// configYAML と configTOML は同じ内容の設定ファイル
+const configYAML = `package: views
+output: gen/template_gen.go
+dirs: [templates]
+exclude: ["*_test.tmpl"]
+html: true
+embed: true
+shared_types: true
+renderer: true
+imports:
+  models: example.com/app/models
+funcs: [example.com/app/views.Funcs]
+types:
+  User: models.User
+`
+
+const configTOML = `package = "views"
+output = "gen/template_gen.go"
+dirs = ["templates"]
+exclude = ["*_test.tmpl"]
+html = true
+embed = true
+shared_types = true
+renderer = true
+funcs = ["example.com/app/views.Funcs"]
+
+[imports]
+models = "example.com/app/models"
+
+[types]
+User = "models.User"
+`
+
+func TestApplyFlags(t *testing.T) {
+	tests := []struct {
+		name           string
+		args           []string
+		want           func(c *config.Config)
+		wantOverridden bool
+	}{
+		{
+			name: "config only",
+			args: nil,
+			want: func(c *config.Config) {},
+		},
+		{
+			name: "string flags replace settings",
+			args: []string{"-pkg", "preview", "-out", "preview/template_gen.go"},
+			want: func(c *config.Config) {
+				c.Package = "preview"
+				c.Output = "preview/template_gen.go"
+			},
+		},
+		{
+			name: "bool flags set to false replace settings",
+			args: []string{"-html=false", "-embed=false", "-shared-types=false", "-renderer=false"},
+			want: func(c *config.Config) {
+				c.HTML, c.Embed, c.SharedTypes, c.Renderer = false, false, false, false
+			},
+		},
+		{
+			name: "-dir replaces dirs",
+			args: []string{"-dir", "other"},
+			want: func(c *config.Config) {
+				c.Dirs = []string{"other"}
+			},
+			wantOverridden: true,
+		},
+		{
+			name: "pattern arguments replace dirs and patterns",
+			args: []string{"templates/shared/*.tmpl,templates/mail/*.tmpl"},
+			want: func(c *config.Config) {
+				c.Dirs = nil
+				c.Patterns = []string{"templates/shared/*.tmpl", "templates/mail/*.tmpl"}
+			},
+			wantOverridden: true,
+		},
+		{
+			name: "-exclude replaces exclude",
+			args: []string{"-exclude", "drafts", "-exclude", "*.bak.tmpl"},
+			want: func(c *config.Config) {
+				c.Exclude = []string{"drafts", "*.bak.tmpl"}
+			},
+		},
+		{
+			name: "-import replaces imports",
+			args: []string{"-import", "example.com/app/other"},
+			want: func(c *config.Config) {
+				c.Imports = nil
+			},
+		},
+		{
+			name: "-funcs replaces funcs",
+			args: []string{"-funcs", "example.com/app/other.Funcs"},
+			want: func(c *config.Config) {
+				c.Funcs = []string{"example.com/app/other.Funcs"}
+			},
+		},
+	}
+
+	for _, format := range []struct{ file, content string }{
+		{"tmpltype.yaml", configYAML},
+		{"tmpltype.toml", configTOML},
+	} {
+		for _, tt := range tests {
+			t.Run(format.file+"/"+tt.name, func(t *testing.T) {
+				t.Chdir(t.TempDir())
+				if err := os.Mkdir("conf", 0o755); err != nil {
+					t.Fatal(err)
+				}
+				path := filepath.Join("conf", format.file)
+				if err := os.WriteFile(path, []byte(format.content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+
+				fl, err := parseFlags(append([]string{"-config", path}, tt.args...), io.Discard)
+				if err != nil {
+					t.Fatal(err)
+				}
+				cfg, err := loadConfig(fl.configPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				applyFlags(cfg, fl)
+
+				// 設定ファイルのパスは設定ファイルのディレクトリ基準、フラグのパスはカレントディレクトリ基準
+				want, err := config.Load(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want.Package != "views" || !reflect.DeepEqual(want.Dirs, []string{filepath.Join("conf", "templates")}) {
+					t.Fatalf("config.Load() = %+v", *want)
+				}
+				tt.want(want)
+				if !reflect.DeepEqual(*cfg, *want) {
+					t.Errorf("applyFlags() = %+v, want %+v", *cfg, *want)
+				}
+				if got := fl.inputsOverridden(); got != tt.wantOverridden {
+					t.Errorf("inputsOverridden() = %v, want %v", got, tt.wantOverridden)
+				}
+			})
+		}
+	}
+}
+
+// checkArgs は -check のテストで使うコマンドライン引数
+var checkArgs = []string{"-dir", "templates", "-pkg", "views", "-out", "views/template_gen.go"}
+
+func TestRun_Check(t *testing.T) {
+	tests := []struct {
+		name       string
+		modify     func(t *testing.T) // 生成後、-check の前に行う変更
+		wantStatus int
+		wantStdout []string // 標準出力（差分）に含まれる文字列
+		wantStderr []string // 標準エラー出力（診断）に含まれる文字列
+	}{
+		{
+			name:       "up to date",
+			modify:     func(t *testing.T) {},
+			wantStatus: 0,
+		},
+		{
+			name: "stale generated file",
+			modify: func(t *testing.T) {
+				writeTestFile(t, "templates/page.tmpl", "{{ .Title }} {{ .Body }}")
+			},
+			wantStatus: 1,
+			wantStdout: []string{"--- a/views/template_gen.go\n+++ b/views/template_gen.go\n@@ ", "+\tBody  string"},
+			wantStderr: []string{filepath.Join("views", "template_gen.go") + ": error: generated code is out of date; run go generate"},
+		},
+		{
+			name: "edited generated file",
+			modify: func(t *testing.T) {
+				writeTestFile(t, "views/template_gen.go", "// edited by hand\n")
+			},
+			wantStatus: 1,
+			wantStdout: []string{"--- a/views/template_gen.go\n+++ b/views/template_gen.go\n@@ -1 +1,", "-// edited by hand\n"},
+			wantStderr: []string{filepath.Join("views", "template_gen.go") + ": error: generated code is out of date"},
+		},
+		{
+			name: "missing output file",
+			modify: func(t *testing.T) {
+				if err := os.Remove("views/template_sources_gen.go"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantStatus: 1,
+			wantStdout: []string{"--- a/views/template_sources_gen.go\n+++ b/views/template_sources_gen.go\n@@ -0,0 +1,"},
+			wantStderr: []string{filepath.Join("views", "template_sources_gen.go") + ": error: generated code is out of date"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			writeTestFile(t, "templates/page.tmpl", "{{ .Title }}")
+			if err := os.Mkdir("views", 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if status := run(checkArgs, io.Discard, io.Discard); status != 0 {
+				t.Fatalf("run() = %d, want 0", status)
+			}
+			tt.modify(t)
+			before := readTree(t, "views")
+
+			var stdout, stderr bytes.Buffer
+			status := run(append([]string{"-check"}, checkArgs...), &stdout, &stderr)
+			if status != tt.wantStatus {
+				t.Errorf("run(-check) = %d, want %d\nstderr:\n%s", status, tt.wantStatus, stderr.String())
+			}
+			if len(tt.wantStdout) == 0 && stdout.Len() > 0 {
+				t.Errorf("stdout = %q, want no diff", stdout.String())
+			}
+			for _, want := range tt.wantStdout {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("stdout does not contain %q:\n%s", want, stdout.String())
+				}
+			}
+			for _, want := range tt.wantStderr {
+				if !strings.Contains(stderr.String(), want) {
+					t.Errorf("stderr does not contain %q:\n%s", want, stderr.String())
+				}
+			}
+
+			// -check はファイルを書き換えない
+			if after := readTree(t, "views"); !reflect.DeepEqual(after, before) {
+				t.Errorf("-check modified files:\nbefore: %q\nafter:  %q", before, after)
+			}
+		})
+	}
+}
+
+// writeTestFile は親ディレクトリを作成してファイルを書き込む
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readTree は dir 以下のファイルの内容をパスごとに返す
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[path] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
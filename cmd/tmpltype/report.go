@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/bellwood4486/tmpltype/internal/diag"
+)
+
+// -format で指定できる診断の出力形式
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// reporter は -format に従って警告とエラーを出力する
+// text: 発生した順に "file:line:col: severity: message" の形式で標準エラー出力に出力する
+// json: 実行の最後に、すべての診断を1つの JSON 配列として標準出力に出力する
+type reporter struct {
+	format string
+	stdout io.Writer
+	stderr io.Writer
+	diags  []*diag.Diagnostic
+}
+
+// report は診断を1件出力する（json の場合は flush まで保持する）
+func (r *reporter) report(d *diag.Diagnostic) {
+	if r.format == formatJSON {
+		r.diags = append(r.diags, d)
+		return
+	}
+	fmt.Fprintln(r.stderr, d)
+}
+
+// fail は err を報告し、終了ステータス1を返す
+func (r *reporter) fail(err error) int {
+	r.report(diag.FromError(err))
+	r.flush()
+	return 1
+}
+
+// flush は json の場合に保持している診断を出力する
+// 診断がなくても空の配列を出力する
+func (r *reporter) flush() {
+	if r.format != formatJSON {
+		return
+	}
+	diags := r.diags
+	if diags == nil {
+		diags = []*diag.Diagnostic{}
+	}
+	enc := json.NewEncoder(r.stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(diags); err != nil {
+		fmt.Fprintln(r.stderr, err)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun_FormatJSON(t *testing.T) {
+	tests := []struct {
+		name       string
+		template   string
+		args       []string
+		wantStatus int
+		golden     string // 標準出力の JSON と比較するファイル
+		wantLog    bool   // 標準エラー出力にログが出ること
+	}{
+		{
+			name:       "success prints empty array",
+			template:   "{{ .Title }}",
+			wantStatus: 0,
+			golden:     "report_success.golden",
+			wantLog:    true,
+		},
+		{
+			name:       "warnings mixed with errors",
+			template:   "{{ .Title }} `code`",
+			args:       []string{"-check"},
+			wantStatus: 1,
+			golden:     "report_warnings_and_errors.golden",
+			wantLog:    true,
+		},
+		{
+			name:       "template error",
+			template:   "{{ .Title }\n",
+			wantStatus: 1,
+			golden:     "report_error.golden",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			golden, err := filepath.Abs(filepath.Join("testdata", tt.golden))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Chdir(t.TempDir())
+			writeTestFile(t, "templates/page.tmpl", tt.template)
+			if err := os.Mkdir("views", 0o755); err != nil {
+				t.Fatal(err)
+			}
+
+			var stdout, stderr bytes.Buffer
+			args := append([]string{"-format=json"}, tt.args...)
+			status := run(append(args, checkArgs...), &stdout, &stderr)
+			if status != tt.wantStatus {
+				t.Errorf("run() = %d, want %d", status, tt.wantStatus)
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("failed to read golden: %v", err)
+			}
+			if stdout.String() != string(want) {
+				t.Errorf("stdout mismatch\n--- want\n%s\n--- got\n%s", want, stdout.String())
+			}
+
+			// ログは標準エラー出力に出し、標準出力には JSON 以外を出さない
+			if got := strings.Contains(stderr.String(), "[template] page"); got != tt.wantLog {
+				t.Errorf("log in stderr = %v, want %v\nstderr:\n%s", got, tt.wantLog, stderr.String())
+			}
+			if strings.Contains(stderr.String(), `"rule"`) {
+				t.Errorf("stderr contains diagnostics JSON:\n%s", stderr.String())
+			}
+		})
+	}
+}
+
+func TestReporter_Text(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	r := &reporter{format: formatText, stdout: &stdout, stderr: &stderr}
+	if status := r.fail(io.ErrUnexpectedEOF); status != 1 {
+		t.Errorf("fail() = %d, want 1", status)
+	}
+	if stdout.Len() > 0 {
+		t.Errorf("stdout = %q, want empty", stdout.String())
+	}
+	if want := "error: unexpected EOF\n"; stderr.String() != want {
+		t.Errorf("stderr = %q, want %q", stderr.String(), want)
+	}
+}
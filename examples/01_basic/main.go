@@ -7,7 +7,9 @@ import (
 
 func main() {
 	// Initialize templates (required before rendering)
-	InitTemplates()
+	if err := InitTemplates(); err != nil {
+		panic(err)
+	}
 
 	// Example 1: Using generic Render with map[string]any
 	fmt.Println("=== Example 1: Render (dynamic) ===")
@@ -26,4 +28,15 @@ func main() {
 		Message: "Hello from type-safe params!",
 	})
 	fmt.Println(buf2.String())
+
+	// Example 3: Rendering straight to a string
+	fmt.Println("=== Example 3: RenderEmailString ===")
+	s, err := RenderEmailString(Email{
+		User:    EmailUser{Name: "Carol"},
+		Message: "No buffer needed!",
+	})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(s)
 }
@@ -6,7 +6,9 @@ import (
 )
 
 func main() {
-	InitTemplates()
+	if err := InitTemplates(); err != nil {
+		panic(err)
+	}
 
 	fmt.Println("=== Example: Multi-template support ===")
 
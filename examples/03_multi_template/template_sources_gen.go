@@ -1,43 +1,23 @@
 // Code generated by tmpltype; DO NOT EDIT.
 package main
 
-var footerTplSource = `{{- /* @param Year int */ -}}
-{{- /* @param Links []struct{Text string; URL string} */ -}}
-    <footer>
-        <div class="links">
-            {{ range .Links }}
-            <a href="{{ .URL }}">{{ .Text }}</a>
-            {{ end }}
-        </div>
-        <p>&copy; {{ .Year }} {{ .CompanyName }}. All rights reserved.</p>
-    </footer>
-</body>
-</html>`
+import "embed"
 
-var headerTplSource = `{{- /* @param Subtitle *string */ -}}
-<!DOCTYPE html>
-<html>
-<head>
-    <title>{{ .Title }}</title>
-</head>
-<body>
-    <header>
-        <h1>{{ .Title }}</h1>
-        {{ if .Subtitle }}<h2>{{ .Subtitle }}</h2>{{ end }}
-    </header>`
+//go:embed templates/footer.tmpl
+//go:embed templates/header.tmpl
+//go:embed templates/nav.tmpl
+var templateFS embed.FS
 
-var navTplSource = `{{- /* @param Items []struct{Name string; Link string; Active bool} */ -}}
-{{- /* @param CurrentUser.IsAdmin bool */ -}}
-<nav>
-    <ul>
-    {{ range .Items }}
-        <li{{ if .Active }} class="active"{{ end }}>
-            <a href="{{ .Link }}">{{ .Name }}</a>
-        </li>
-    {{ end }}
-    </ul>
-    <div class="user-info">
-        Logged in as: {{ .CurrentUser.Name }}
-        {{ if .CurrentUser.IsAdmin }}(Admin){{ end }}
-    </div>
-</nav>`
+var footerTplSource = mustReadTemplate("templates/footer.tmpl")
+
+var headerTplSource = mustReadTemplate("templates/header.tmpl")
+
+var navTplSource = mustReadTemplate("templates/nav.tmpl")
+
+func mustReadTemplate(path string) string {
+	b, err := templateFS.ReadFile(path)
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
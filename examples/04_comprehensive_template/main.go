@@ -6,7 +6,9 @@ import (
 )
 
 func main() {
-	InitTemplates()
+	if err := InitTemplates(); err != nil {
+		panic(err)
+	}
 	// Example: Using type-safe render functions with comprehensive template features
 	fmt.Println("=== Comprehensive Template Example ===")
 	fmt.Println()
@@ -28,7 +30,7 @@ func main() {
 
 	// 2. Render control_flow template
 	fmt.Println("--- Template 2: control_flow ---")
-	fmt.Println("Features: 3. Conditional (if) & 4. With Statement and Else Clause")
+	fmt.Println("Features: 3. Conditional (if) & 4. With Statement and Else Clause, plus comparisons")
 	fmt.Println()
 	var buf2 bytes.Buffer
 	_ = RenderControlFlow(&buf2, ControlFlow{
@@ -38,6 +40,13 @@ func main() {
 			LastUpdated: "2024-12-31",
 		},
 		DefaultMessage: "No summary provided.",
+		Stats: ControlFlowStats{
+			Comments: 12,
+			Rating:   4.8,
+			Featured: true,
+			Archived: false,
+			Average:  3.75,
+		},
 	})
 	fmt.Println(buf2.String())
 	fmt.Println()
@@ -154,6 +154,19 @@ var control_flowTplSource = `<!DOCTYPE html>
         {{ end }}
     </section>
 
+    {{/* Comparisons and boolean logic (infers int, float64 and bool) */}}
+    <section id="comparisons">
+        <h2>Comparisons and Boolean Logic</h2>
+        {{ if eq .Stats.Comments 0 }}
+        <p>No comments yet</p>
+        {{ else }}
+        <p>{{ .Stats.Comments }} comments</p>
+        {{ end }}
+        {{ if ge .Stats.Rating 4.5 }}<p>Top rated</p>{{ end }}
+        {{ if and .Stats.Featured (not .Stats.Archived) }}<p>Featured</p>{{ end }}
+        <p>Average: {{ .Stats.Average | printf "%.1f" }}</p>
+    </section>
+
     <footer>
         <p>Generated by tmpltype - Control Flow Template</p>
     </footer>
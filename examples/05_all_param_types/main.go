@@ -6,7 +6,9 @@ import (
 )
 
 func main() {
-	InitTemplates()
+	if err := InitTemplates(); err != nil {
+		panic(err)
+	}
 	// Helper functions to create pointer values
 	strPtr := func(s string) *string { return &s }
 	intPtr := func(i int) *int { return &i }
@@ -2,10 +2,21 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"text/template"
+	"text/template/parse"
+	"time"
 )
 
 // TemplateName is a type-safe template name
@@ -32,7 +43,9 @@ var Template = struct {
 type TemplateOption func(*templateConfig)
 
 type templateConfig struct {
-	funcs template.FuncMap
+	funcs          template.FuncMap
+	reloadDir      string
+	bufferedOutput bool
 }
 
 // WithFuncs sets custom template functions
@@ -42,8 +55,64 @@ func WithFuncs(funcs template.FuncMap) TemplateOption {
 	}
 }
 
+// WithReloadFromDir re-reads template files from disk whenever they change,
+// instead of using the sources compiled into the binary.
+// dir is the directory of the generated package; template file paths are resolved relative to it.
+// Every render checks the file modification times, so use this for development only.
+func WithReloadFromDir(dir string) TemplateOption {
+	return func(c *templateConfig) {
+		c.reloadDir = dir
+	}
+}
+
+// WithBufferedOutput makes the render functions that write to an io.Writer
+// execute the template into an internal buffer and write the output only if
+// execution succeeds, so a failing template never leaves partial output.
+// Execution errors are returned as *RenderError.
+func WithBufferedOutput() TemplateOption {
+	return func(c *templateConfig) {
+		c.bufferedOutput = true
+	}
+}
+
+// RequiredFunc is a custom template function and the templates that use it
+type RequiredFunc struct {
+	Name      string
+	Templates []TemplateName
+}
+
+// RequiredFuncs lists the custom functions used by the templates, in name order.
+// InitTemplates fails unless WithFuncs provides all of them.
+var RequiredFuncs = []RequiredFunc{}
+
+// checkRequiredFuncs reports the functions of RequiredFuncs that funcs does not provide
+func checkRequiredFuncs(funcs template.FuncMap) error {
+	missing := ""
+	for _, f := range RequiredFuncs {
+		if _, ok := funcs[f.Name]; ok {
+			continue
+		}
+		if missing != "" {
+			missing += ", "
+		}
+		missing += f.Name + " (used by"
+		for _, name := range f.Templates {
+			missing += fmt.Sprintf(" %q", name)
+		}
+		missing += ")"
+	}
+	if missing != "" {
+		return fmt.Errorf("missing template functions: %s; provide them with WithFuncs", missing)
+	}
+	return nil
+}
+
 var templates map[TemplateName]*template.Template
-var initOnce sync.Once
+
+var (
+	initMu     sync.Mutex
+	initConfig *templateConfig // options of the first successful InitTemplates call
+)
 
 // InitTemplates initializes all templates with the given options.
 // Must be called before using any render functions.
@@ -52,47 +121,532 @@ var initOnce sync.Once
 //
 //	InitTemplates() // without custom functions
 //	InitTemplates(WithFuncs(GetTemplateFuncs())) // with custom functions
-func InitTemplates(opts ...TemplateOption) {
-	initOnce.Do(func() {
-		config := &templateConfig{}
-		for _, opt := range opts {
-			opt(config)
+//	InitTemplates(WithReloadFromDir(".")) // reload templates from disk during development
+//
+// It returns an error, without initializing, if WithFuncs does not provide
+// every function listed in RequiredFuncs, if the FuncMap is invalid, or if
+// a template fails to parse. Once initialized, calling it again with the
+// same options does nothing, and calling it with different options is an error.
+// Functions are compared by identity, so closures created from one function
+// literal count as the same function even if they capture different values.
+func InitTemplates(opts ...TemplateOption) error {
+	config := newTemplateConfig(opts)
+	if err := checkRequiredFuncs(config.funcs); err != nil {
+		return err
+	}
+
+	initMu.Lock()
+	defer initMu.Unlock()
+	if initConfig != nil {
+		if !sameConfig(initConfig, config) {
+			return fmt.Errorf("templates already initialized with different options")
 		}
+		return nil
+	}
 
-		templates = map[TemplateName]*template.Template{
-			Template.BasicTypes:   newTemplate(Template.BasicTypes, basic_typesTplSource, config),
-			Template.ComplexTypes: newTemplate(Template.ComplexTypes, complex_typesTplSource, config),
-			Template.MapTypes:     newTemplate(Template.MapTypes, map_typesTplSource, config),
-			Template.PointerTypes: newTemplate(Template.PointerTypes, pointer_typesTplSource, config),
-			Template.SliceTypes:   newTemplate(Template.SliceTypes, slice_typesTplSource, config),
-			Template.StructTypes:  newTemplate(Template.StructTypes, struct_typesTplSource, config),
+	parsed, err := parseTemplates(config)
+	if err != nil {
+		return err
+	}
+	initConfig = config
+	templates = parsed
+	if config.reloadDir != "" {
+		reloader = &templateReloader{config: config, templates: parsed}
+	}
+	return nil
+}
+
+// newTemplateConfig applies the options to an empty configuration
+func newTemplateConfig(opts []TemplateOption) *templateConfig {
+	config := &templateConfig{}
+	for _, opt := range opts {
+		opt(config)
+	}
+	return config
+}
+
+// parseTemplates parses all templates into one set, reporting every template that fails to parse
+func parseTemplates(config *templateConfig) (map[TemplateName]*template.Template, error) {
+	set, err := newTemplateSet(config)
+	if err != nil {
+		return nil, err
+	}
+	parsed := make(map[TemplateName]*template.Template)
+	var errs []error
+	for _, src := range []struct {
+		name   TemplateName
+		source string
+	}{
+		{Template.BasicTypes, basic_typesTplSource},
+		{Template.ComplexTypes, complex_typesTplSource},
+		{Template.MapTypes, map_typesTplSource},
+		{Template.PointerTypes, pointer_typesTplSource},
+		{Template.SliceTypes, slice_typesTplSource},
+		{Template.StructTypes, struct_typesTplSource},
+	} {
+		tmpl, err := set.New(string(src.name)).Parse(src.source)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to parse template %q: %w", src.name, err))
+			continue
 		}
-	})
+		parsed[src.name] = tmpl
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return parsed, nil
 }
 
-func newTemplate(name TemplateName, source string, config *templateConfig) *template.Template {
-	t := template.New(string(name))
+// newTemplateSet returns an empty template set with the custom functions of config
+func newTemplateSet(config *templateConfig) (set *template.Template, err error) {
+	set = template.New("").Option("missingkey=error")
 	if config.funcs != nil {
-		t = t.Funcs(config.funcs)
+		// Funcs panics if a value is not a function with one or two results
+		defer func() {
+			if r := recover(); r != nil {
+				set, err = nil, fmt.Errorf("invalid FuncMap: %v", r)
+			}
+		}()
+		set = set.Funcs(config.funcs)
 	}
-	return template.Must(t.Option("missingkey=error").Parse(source))
+	return set, nil
 }
 
-// Templates returns a map of all templates
+// sameConfig reports whether two configurations initialize the templates the same way
+func sameConfig(a, b *templateConfig) bool {
+	if a.reloadDir != b.reloadDir || a.bufferedOutput != b.bufferedOutput || len(a.funcs) != len(b.funcs) {
+		return false
+	}
+	for name, fn := range a.funcs {
+		other, ok := b.funcs[name]
+		if !ok || !sameFunc(fn, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameFunc reports whether two FuncMap values are the same function.
+// Closures created from one function literal share their code and compare equal.
+func sameFunc(a, b any) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	return va.Kind() == reflect.Func && vb.Kind() == reflect.Func && va.Pointer() == vb.Pointer()
+}
+
+// Templates returns a map of all templates.
+// With WithReloadFromDir, it is the set parsed by the latest reload.
 func Templates() map[TemplateName]*template.Template {
+	if reloader != nil {
+		return reloader.current()
+	}
 	return templates
 }
 
 // Render renders a template by name with the given data
 func Render(w io.Writer, name TemplateName, data any) error {
+	tmpl, err := lookupTemplate(name)
+	if err != nil {
+		return err
+	}
+	return execute(context.Background(), tmpl, w, data, initConfig)
+}
+
+// lookupTemplate returns the template for name, reloading it from disk first
+// when WithReloadFromDir is set
+func lookupTemplate(name TemplateName) (*template.Template, error) {
 	if templates == nil {
-		return fmt.Errorf("templates not initialized: call InitTemplates() first")
+		return nil, ErrNotInitialized
+	}
+	if reloader != nil {
+		return reloader.lookup(name)
 	}
 	tmpl, ok := templates[name]
 	if !ok {
-		return fmt.Errorf("template %q not found", name)
+		return nil, fmt.Errorf("%w: %q", ErrTemplateNotFound, name)
+	}
+	return tmpl, nil
+}
+
+// TypedTemplate is a template together with the type of its data.
+// Generic code, such as an HTTP handler factory, can take a TypedTemplate[T]
+// and render any template without losing the data type.
+type TypedTemplate[T any] struct {
+	name TemplateName
+}
+
+// Name returns the name of the template
+func (t TypedTemplate[T]) Name() TemplateName {
+	return t.name
+}
+
+// Execute renders the template with data
+func (t TypedTemplate[T]) Execute(w io.Writer, data T) error {
+	return Render(w, t.name, data)
+}
+
+// ExecuteContext renders the template with data, stopping once ctx is done
+func (t TypedTemplate[T]) ExecuteContext(ctx context.Context, w io.Writer, data T) error {
+	tmpl, err := lookupTemplate(t.name)
+	if err != nil {
+		return err
 	}
-	return tmpl.Execute(w, data)
+	return execute(ctx, tmpl, w, data, initConfig)
+}
+
+// templateFiles lists the template source files, relative to the generated package directory
+var templateFiles = []struct {
+	name TemplateName
+	path string
+}{
+	{Template.BasicTypes, "templates/basic_types.tmpl"},
+	{Template.ComplexTypes, "templates/complex_types.tmpl"},
+	{Template.MapTypes, "templates/map_types.tmpl"},
+	{Template.PointerTypes, "templates/pointer_types.tmpl"},
+	{Template.SliceTypes, "templates/slice_types.tmpl"},
+	{Template.StructTypes, "templates/struct_types.tmpl"},
+}
+
+var reloader *templateReloader
+
+// templateReloader re-parses the template set when a template file changes on disk
+// templates starts as the set parsed at initialization
+type templateReloader struct {
+	mu        sync.Mutex
+	config    *templateConfig
+	templates map[TemplateName]*template.Template
+	modTimes  map[string]time.Time
+}
+
+func (r *templateReloader) lookup(name TemplateName) (*template.Template, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.reloadIfChanged(); err != nil {
+		return nil, err
+	}
+	tmpl, ok := r.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrTemplateNotFound, name)
+	}
+	return tmpl, nil
+}
+
+// current returns the template set parsed by the latest reload
+func (r *templateReloader) current() map[TemplateName]*template.Template {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.templates
+}
+
+func (r *templateReloader) reloadIfChanged() error {
+	changed := r.templates == nil
+	modTimes := make(map[string]time.Time, len(templateFiles))
+	for _, f := range templateFiles {
+		info, err := os.Stat(filepath.Join(r.config.reloadDir, filepath.FromSlash(f.path)))
+		if err != nil {
+			return fmt.Errorf("failed to reload template %q: %w", f.name, err)
+		}
+		if !info.ModTime().Equal(r.modTimes[f.path]) {
+			changed = true
+		}
+		modTimes[f.path] = info.ModTime()
+	}
+	if !changed {
+		return nil
+	}
+
+	set, err := newTemplateSet(r.config)
+	if err != nil {
+		return err
+	}
+	next := make(map[TemplateName]*template.Template, len(r.templates))
+	for _, f := range templateFiles {
+		source, err := os.ReadFile(filepath.Join(r.config.reloadDir, filepath.FromSlash(f.path)))
+		if err != nil {
+			return fmt.Errorf("failed to reload template %q: %w", f.name, err)
+		}
+		tmpl, err := set.New(string(f.name)).Parse(string(source))
+		if err != nil {
+			return fmt.Errorf("failed to reload template %q: %w", f.name, err)
+		}
+		next[f.name] = tmpl
+	}
+	for name := range r.templates {
+		if _, ok := next[name]; ok {
+			continue
+		}
+		tmpl := set.Lookup(string(name))
+		if tmpl == nil {
+			return fmt.Errorf("failed to reload template %q: no longer defined", name)
+		}
+		next[name] = tmpl
+	}
+
+	r.templates = next
+	r.modTimes = modTimes
+	return nil
+}
+
+// execute executes tmpl into w with the options of config.
+// Once ctx is done, the next write fails and the error is ctx.Err() wrapped
+// with the template name. With WithBufferedOutput, the output is written to w
+// only if execution succeeds, and execution errors are wrapped in *RenderError.
+func execute(ctx context.Context, tmpl *template.Template, w io.Writer, data any, config *templateConfig) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("template %q: %w", tmpl.Name(), err)
+	}
+	out := w
+	var buf *bytes.Buffer
+	if config.bufferedOutput {
+		buf = getBuffer()
+		defer putBuffer(buf)
+		out = buf
+	}
+	// a context that is never done, such as context.Background(), needs no checks
+	if ctx.Done() != nil {
+		out = &contextWriter{ctx: ctx, w: out}
+	}
+	if err := tmpl.Execute(out, data); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("template %q: %w", tmpl.Name(), ctxErr)
+		}
+		err = newExecError(tmpl, err)
+		if buf != nil {
+			return newRenderError(tmpl, err)
+		}
+		return err
+	}
+	if buf == nil {
+		return nil
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// contextWriter fails every write once ctx is done
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (cw *contextWriter) Write(p []byte) (int, error) {
+	if err := cw.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cw.w.Write(p)
+}
+
+// ErrNotInitialized is returned by the render functions until InitTemplates succeeds
+var ErrNotInitialized = errors.New("templates not initialized: call InitTemplates() first")
+
+// ErrTemplateNotFound is returned by Render for a name that is not a generated template
+var ErrTemplateNotFound = errors.New("template not found")
+
+// ExecError is returned by the render functions when a template fails to execute.
+//
+// File, Line and Col locate the failing node in the source that defines it,
+// which is another template's source when the failure is inside a {{ template }} call.
+// Field is relative to the dot of that template: a failure on {{ .Name }} inside
+// {{ template "user" .User }} gives "Name", not "User.Name".
+type ExecError struct {
+	Template TemplateName // template that was rendered
+	File     string       // template file of the failing node, relative to the generated package directory, or "" if unknown
+	Line     int          // line of the failing node, or 0 if unknown
+	Col      int          // byte offset of the failing node within the line, or 0 if unknown
+	Field    string       // field path the failing node refers to, relative to the dot of the template that contains it, or "" if none
+	Err      error        // error returned by the template package
+}
+
+func (e *ExecError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExecError) Unwrap() error {
+	return e.Err
+}
+
+// RenderError is returned by the render functions that write to an io.Writer
+// when WithBufferedOutput is set and the template fails to execute.
+// Nothing has been written to the writer. Err is usually an *ExecError.
+type RenderError struct {
+	Template TemplateName // template that was rendered
+	Line     int          // line of the failing node, or 0 if unknown
+	Col      int          // byte offset of the failing node within the line, or 0 if unknown
+	Err      error
+}
+
+func (e *RenderError) Error() string {
+	return fmt.Sprintf("failed to render template %q: %v", e.Template, e.Err)
+}
+
+func (e *RenderError) Unwrap() error {
+	return e.Err
+}
+
+// newRenderError wraps an execution error of tmpl with the position of the failing node
+func newRenderError(tmpl *template.Template, err error) *RenderError {
+	e := &RenderError{Template: TemplateName(tmpl.Name()), Err: err}
+	var execErr *ExecError
+	if errors.As(err, &execErr) {
+		e.Line, e.Col = execErr.Line, execErr.Col
+	}
+	return e
+}
+
+// execErrorLocation matches the location in execution errors, as in
+// "template: email:3:14: executing ..."
+var execErrorLocation = regexp.MustCompile(`^template: (.*?):(\d+):(\d+): `)
+
+// newExecError wraps an execution error of tmpl in an *ExecError.
+// Other errors, such as write errors, are returned as is.
+func newExecError(tmpl *template.Template, err error) error {
+	var execErr template.ExecError
+	if !errors.As(err, &execErr) {
+		return err
+	}
+	e := &ExecError{Template: TemplateName(tmpl.Name()), Err: err}
+	m := execErrorLocation.FindStringSubmatch(err.Error())
+	if m == nil {
+		return e
+	}
+	e.Line, _ = strconv.Atoi(m[2])
+	e.Col, _ = strconv.Atoi(m[3])
+	// the location names the template whose source contains the node
+	for _, f := range templateFiles {
+		if string(f.name) == m[1] {
+			e.File = f.path
+		}
+	}
+	location := m[1] + ":" + m[2] + ":" + m[3]
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil && t.Tree.ParseName == m[1] {
+			if e.Field = fieldAt(t.Tree, t.Tree.Root, location); e.Field != "" {
+				break
+			}
+		}
+	}
+	return e
+}
+
+// fieldAt returns the path of the field node at location, or of the first field
+// argument of the command at location, or "" if there is none.
+// The error message shortens the node, so the full path is read from the parse tree.
+func fieldAt(tree *parse.Tree, node parse.Node, location string) string {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return ""
+		}
+		for _, child := range n.Nodes {
+			if field := fieldAt(tree, child, location); field != "" {
+				return field
+			}
+		}
+	case *parse.ActionNode:
+		return fieldAt(tree, n.Pipe, location)
+	case *parse.PipeNode:
+		if n == nil {
+			return ""
+		}
+		for _, cmd := range n.Cmds {
+			if field := fieldAt(tree, cmd, location); field != "" {
+				return field
+			}
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			if field := fieldAt(tree, arg, location); field != "" {
+				return field
+			}
+		}
+		if loc, _ := tree.ErrorContext(n); loc == location {
+			for _, arg := range n.Args {
+				if f, ok := arg.(*parse.FieldNode); ok {
+					return f.String()[1:]
+				}
+			}
+		}
+	case *parse.FieldNode:
+		if loc, _ := tree.ErrorContext(n); loc == location {
+			return n.String()[1:]
+		}
+	case *parse.IfNode:
+		return fieldAtBranch(tree, &n.BranchNode, location)
+	case *parse.RangeNode:
+		return fieldAtBranch(tree, &n.BranchNode, location)
+	case *parse.WithNode:
+		return fieldAtBranch(tree, &n.BranchNode, location)
+	case *parse.TemplateNode:
+		return fieldAt(tree, n.Pipe, location)
+	}
+	return ""
+}
+
+func fieldAtBranch(tree *parse.Tree, n *parse.BranchNode, location string) string {
+	for _, child := range []parse.Node{n.Pipe, n.List, n.ElseList} {
+		if field := fieldAt(tree, child, location); field != "" {
+			return field
+		}
+	}
+	return ""
+}
+
+// bufferPool reuses the buffers of the RenderXxxString and RenderXxxBytes functions
+// and of WithBufferedOutput
+var bufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// averageOutputSize is a running average of the rendered output sizes, used to size buffers
+var averageOutputSize atomic.Int64
+
+// minPooledBufferSize is the capacity a pooled buffer may always keep;
+// larger buffers are kept only up to four times the average output size
+const minPooledBufferSize = 64 << 10
+
+// executeString executes tmpl into a pooled buffer and returns the output as a string
+func executeString(tmpl *template.Template, data any) (string, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := tmpl.Execute(buf, data); err != nil {
+		return "", newExecError(tmpl, err)
+	}
+	return buf.String(), nil
+}
+
+// executeBytes executes tmpl into a pooled buffer and returns a copy of the output
+func executeBytes(tmpl *template.Template, data any) ([]byte, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := tmpl.Execute(buf, data); err != nil {
+		return nil, newExecError(tmpl, err)
+	}
+	return bytes.Clone(buf.Bytes()), nil
+}
+
+// getBuffer returns an empty buffer with room for an average output
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	buf.Grow(int(averageOutputSize.Load()))
+	return buf
+}
+
+// putBuffer records the output size and returns buf to the pool,
+// unless it grew much larger than the average output
+func putBuffer(buf *bytes.Buffer) {
+	size := int64(buf.Len())
+	for {
+		avg := averageOutputSize.Load()
+		next := size
+		if avg > 0 {
+			next = avg + (size-avg)/8
+		}
+		if averageOutputSize.CompareAndSwap(avg, next) {
+			break
+		}
+	}
+	if buf.Cap() > minPooledBufferSize && int64(buf.Cap()) > 4*averageOutputSize.Load() {
+		return
+	}
+	bufferPool.Put(buf)
 }
 
 // ============================================================
@@ -110,26 +664,47 @@ type BasicTypes struct {
 
 // RenderBasicTypes renders the basic_types template
 func RenderBasicTypes(w io.Writer, p BasicTypes) error {
-	if templates == nil {
-		return fmt.Errorf("templates not initialized: call InitTemplates() first")
+	tmpl, err := lookupTemplate(Template.BasicTypes)
+	if err != nil {
+		return err
 	}
-	tmpl, ok := templates[Template.BasicTypes]
-	if !ok {
-		return fmt.Errorf("template %q not found", Template.BasicTypes)
+	return execute(context.Background(), tmpl, w, p, initConfig)
+}
+
+// RenderBasicTypesContext renders the basic_types template, stopping once ctx is done
+func RenderBasicTypesContext(ctx context.Context, w io.Writer, p BasicTypes) error {
+	tmpl, err := lookupTemplate(Template.BasicTypes)
+	if err != nil {
+		return err
 	}
-	return tmpl.Execute(w, p)
+	return execute(ctx, tmpl, w, p, initConfig)
 }
 
+// RenderBasicTypesString renders the basic_types template to a string
+func RenderBasicTypesString(p BasicTypes) (string, error) {
+	tmpl, err := lookupTemplate(Template.BasicTypes)
+	if err != nil {
+		return "", err
+	}
+	return executeString(tmpl, p)
+}
+
+// RenderBasicTypesBytes renders the basic_types template to a byte slice
+func RenderBasicTypesBytes(p BasicTypes) ([]byte, error) {
+	tmpl, err := lookupTemplate(Template.BasicTypes)
+	if err != nil {
+		return nil, err
+	}
+	return executeBytes(tmpl, p)
+}
+
+// BasicTypesTemplate is the basic_types template with its data type, for generic code
+var BasicTypesTemplate = TypedTemplate[BasicTypes]{name: Template.BasicTypes}
+
 // ============================================================
 // complex_types template
 // ============================================================
 
-type ComplexTypesRecordsItem struct {
-	Age   int
-	Name  string
-	Score *int
-}
-
 type ComplexTypesItemsItem struct {
 	ID    int64
 	Price float64
@@ -137,6 +712,12 @@ type ComplexTypesItemsItem struct {
 	Title string
 }
 
+type ComplexTypesRecordsItem struct {
+	Age   int
+	Name  string
+	Score *int
+}
+
 // ComplexTypes represents parameters for complex_types template
 type ComplexTypes struct {
 	Items         []ComplexTypesItemsItem
@@ -146,16 +727,43 @@ type ComplexTypes struct {
 
 // RenderComplexTypes renders the complex_types template
 func RenderComplexTypes(w io.Writer, p ComplexTypes) error {
-	if templates == nil {
-		return fmt.Errorf("templates not initialized: call InitTemplates() first")
+	tmpl, err := lookupTemplate(Template.ComplexTypes)
+	if err != nil {
+		return err
 	}
-	tmpl, ok := templates[Template.ComplexTypes]
-	if !ok {
-		return fmt.Errorf("template %q not found", Template.ComplexTypes)
+	return execute(context.Background(), tmpl, w, p, initConfig)
+}
+
+// RenderComplexTypesContext renders the complex_types template, stopping once ctx is done
+func RenderComplexTypesContext(ctx context.Context, w io.Writer, p ComplexTypes) error {
+	tmpl, err := lookupTemplate(Template.ComplexTypes)
+	if err != nil {
+		return err
 	}
-	return tmpl.Execute(w, p)
+	return execute(ctx, tmpl, w, p, initConfig)
 }
 
+// RenderComplexTypesString renders the complex_types template to a string
+func RenderComplexTypesString(p ComplexTypes) (string, error) {
+	tmpl, err := lookupTemplate(Template.ComplexTypes)
+	if err != nil {
+		return "", err
+	}
+	return executeString(tmpl, p)
+}
+
+// RenderComplexTypesBytes renders the complex_types template to a byte slice
+func RenderComplexTypesBytes(p ComplexTypes) ([]byte, error) {
+	tmpl, err := lookupTemplate(Template.ComplexTypes)
+	if err != nil {
+		return nil, err
+	}
+	return executeBytes(tmpl, p)
+}
+
+// ComplexTypesTemplate is the complex_types template with its data type, for generic code
+var ComplexTypesTemplate = TypedTemplate[ComplexTypes]{name: Template.ComplexTypes}
+
 // ============================================================
 // map_types template
 // ============================================================
@@ -170,16 +778,43 @@ type MapTypes struct {
 
 // RenderMapTypes renders the map_types template
 func RenderMapTypes(w io.Writer, p MapTypes) error {
-	if templates == nil {
-		return fmt.Errorf("templates not initialized: call InitTemplates() first")
+	tmpl, err := lookupTemplate(Template.MapTypes)
+	if err != nil {
+		return err
 	}
-	tmpl, ok := templates[Template.MapTypes]
-	if !ok {
-		return fmt.Errorf("template %q not found", Template.MapTypes)
+	return execute(context.Background(), tmpl, w, p, initConfig)
+}
+
+// RenderMapTypesContext renders the map_types template, stopping once ctx is done
+func RenderMapTypesContext(ctx context.Context, w io.Writer, p MapTypes) error {
+	tmpl, err := lookupTemplate(Template.MapTypes)
+	if err != nil {
+		return err
+	}
+	return execute(ctx, tmpl, w, p, initConfig)
+}
+
+// RenderMapTypesString renders the map_types template to a string
+func RenderMapTypesString(p MapTypes) (string, error) {
+	tmpl, err := lookupTemplate(Template.MapTypes)
+	if err != nil {
+		return "", err
+	}
+	return executeString(tmpl, p)
+}
+
+// RenderMapTypesBytes renders the map_types template to a byte slice
+func RenderMapTypesBytes(p MapTypes) ([]byte, error) {
+	tmpl, err := lookupTemplate(Template.MapTypes)
+	if err != nil {
+		return nil, err
 	}
-	return tmpl.Execute(w, p)
+	return executeBytes(tmpl, p)
 }
 
+// MapTypesTemplate is the map_types template with its data type, for generic code
+var MapTypesTemplate = TypedTemplate[MapTypes]{name: Template.MapTypes}
+
 // ============================================================
 // pointer_types template
 // ============================================================
@@ -194,16 +829,43 @@ type PointerTypes struct {
 
 // RenderPointerTypes renders the pointer_types template
 func RenderPointerTypes(w io.Writer, p PointerTypes) error {
-	if templates == nil {
-		return fmt.Errorf("templates not initialized: call InitTemplates() first")
+	tmpl, err := lookupTemplate(Template.PointerTypes)
+	if err != nil {
+		return err
 	}
-	tmpl, ok := templates[Template.PointerTypes]
-	if !ok {
-		return fmt.Errorf("template %q not found", Template.PointerTypes)
+	return execute(context.Background(), tmpl, w, p, initConfig)
+}
+
+// RenderPointerTypesContext renders the pointer_types template, stopping once ctx is done
+func RenderPointerTypesContext(ctx context.Context, w io.Writer, p PointerTypes) error {
+	tmpl, err := lookupTemplate(Template.PointerTypes)
+	if err != nil {
+		return err
 	}
-	return tmpl.Execute(w, p)
+	return execute(ctx, tmpl, w, p, initConfig)
 }
 
+// RenderPointerTypesString renders the pointer_types template to a string
+func RenderPointerTypesString(p PointerTypes) (string, error) {
+	tmpl, err := lookupTemplate(Template.PointerTypes)
+	if err != nil {
+		return "", err
+	}
+	return executeString(tmpl, p)
+}
+
+// RenderPointerTypesBytes renders the pointer_types template to a byte slice
+func RenderPointerTypesBytes(p PointerTypes) ([]byte, error) {
+	tmpl, err := lookupTemplate(Template.PointerTypes)
+	if err != nil {
+		return nil, err
+	}
+	return executeBytes(tmpl, p)
+}
+
+// PointerTypesTemplate is the pointer_types template with its data type, for generic code
+var PointerTypesTemplate = TypedTemplate[PointerTypes]{name: Template.PointerTypes}
+
 // ============================================================
 // slice_types template
 // ============================================================
@@ -218,16 +880,43 @@ type SliceTypes struct {
 
 // RenderSliceTypes renders the slice_types template
 func RenderSliceTypes(w io.Writer, p SliceTypes) error {
-	if templates == nil {
-		return fmt.Errorf("templates not initialized: call InitTemplates() first")
+	tmpl, err := lookupTemplate(Template.SliceTypes)
+	if err != nil {
+		return err
 	}
-	tmpl, ok := templates[Template.SliceTypes]
-	if !ok {
-		return fmt.Errorf("template %q not found", Template.SliceTypes)
+	return execute(context.Background(), tmpl, w, p, initConfig)
+}
+
+// RenderSliceTypesContext renders the slice_types template, stopping once ctx is done
+func RenderSliceTypesContext(ctx context.Context, w io.Writer, p SliceTypes) error {
+	tmpl, err := lookupTemplate(Template.SliceTypes)
+	if err != nil {
+		return err
 	}
-	return tmpl.Execute(w, p)
+	return execute(ctx, tmpl, w, p, initConfig)
 }
 
+// RenderSliceTypesString renders the slice_types template to a string
+func RenderSliceTypesString(p SliceTypes) (string, error) {
+	tmpl, err := lookupTemplate(Template.SliceTypes)
+	if err != nil {
+		return "", err
+	}
+	return executeString(tmpl, p)
+}
+
+// RenderSliceTypesBytes renders the slice_types template to a byte slice
+func RenderSliceTypesBytes(p SliceTypes) ([]byte, error) {
+	tmpl, err := lookupTemplate(Template.SliceTypes)
+	if err != nil {
+		return nil, err
+	}
+	return executeBytes(tmpl, p)
+}
+
+// SliceTypesTemplate is the slice_types template with its data type, for generic code
+var SliceTypesTemplate = TypedTemplate[SliceTypes]{name: Template.SliceTypes}
+
 // ============================================================
 // struct_types template
 // ============================================================
@@ -252,12 +941,39 @@ type StructTypes struct {
 
 // RenderStructTypes renders the struct_types template
 func RenderStructTypes(w io.Writer, p StructTypes) error {
-	if templates == nil {
-		return fmt.Errorf("templates not initialized: call InitTemplates() first")
+	tmpl, err := lookupTemplate(Template.StructTypes)
+	if err != nil {
+		return err
 	}
-	tmpl, ok := templates[Template.StructTypes]
-	if !ok {
-		return fmt.Errorf("template %q not found", Template.StructTypes)
+	return execute(context.Background(), tmpl, w, p, initConfig)
+}
+
+// RenderStructTypesContext renders the struct_types template, stopping once ctx is done
+func RenderStructTypesContext(ctx context.Context, w io.Writer, p StructTypes) error {
+	tmpl, err := lookupTemplate(Template.StructTypes)
+	if err != nil {
+		return err
 	}
-	return tmpl.Execute(w, p)
+	return execute(ctx, tmpl, w, p, initConfig)
 }
+
+// RenderStructTypesString renders the struct_types template to a string
+func RenderStructTypesString(p StructTypes) (string, error) {
+	tmpl, err := lookupTemplate(Template.StructTypes)
+	if err != nil {
+		return "", err
+	}
+	return executeString(tmpl, p)
+}
+
+// RenderStructTypesBytes renders the struct_types template to a byte slice
+func RenderStructTypesBytes(p StructTypes) ([]byte, error) {
+	tmpl, err := lookupTemplate(Template.StructTypes)
+	if err != nil {
+		return nil, err
+	}
+	return executeBytes(tmpl, p)
+}
+
+// StructTypesTemplate is the struct_types template with its data type, for generic code
+var StructTypesTemplate = TypedTemplate[StructTypes]{name: Template.StructTypes}
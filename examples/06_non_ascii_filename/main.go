@@ -6,7 +6,9 @@ import (
 )
 
 func main() {
-	InitTemplates()
+	if err := InitTemplates(); err != nil {
+		panic(err)
+	}
 	// Example: Using template with Japanese filename
 	fmt.Println("=== Example: Template with Japanese filename (メール.tmpl) ===")
 	var buf bytes.Buffer
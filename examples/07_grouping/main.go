@@ -6,7 +6,9 @@ import (
 )
 
 func main() {
-	InitTemplates()
+	if err := InitTemplates(); err != nil {
+		panic(err)
+	}
 	fmt.Println("=== Example: Template Grouping (Mixed Flat + Grouped) ===")
 	fmt.Println()
 
@@ -57,6 +59,25 @@ func main() {
 	fmt.Println("Title:", articleTitleBuf.String())
 	fmt.Println()
 
+	// Use nested groups (templates/notification/password_reset/*.tmpl)
+	fmt.Println("--- Notification Password Reset (Nested Groups) ---")
+	var resetHTMLBuf, resetTextBuf bytes.Buffer
+	_ = RenderNotificationPasswordResetHTML(&resetHTMLBuf, NotificationPasswordResetHTML{
+		Username:  "bob123",
+		ResetURL:  "https://myapp.com/reset/xyz789",
+		ExpiresIn: "24 hours",
+	})
+	fmt.Println("HTML:", resetHTMLBuf.String())
+
+	_ = Render(&resetTextBuf, Template.Notification.PasswordReset.Text, NotificationPasswordResetText{
+		Username:  "bob123",
+		ResetURL:  "https://myapp.com/reset/xyz789",
+		ExpiresIn: "24 hours",
+	})
+	fmt.Println("Text:")
+	fmt.Println(resetTextBuf.String())
+	fmt.Println()
+
 	// Use flat template
 	fmt.Println("--- Footer (Flat Template) ---")
 	var footerBuf bytes.Buffer
@@ -49,3 +49,11 @@ Best regards,
 The {{ .SiteName }} Team`
 
 var mail_invite_titleTplSource = `{{ .SiteName }}: Invitation from {{ .InviterName }}`
+
+var notification_password_reset_htmlTplSource = `<p>Hi {{ .Username }},</p>
+<p><a href="{{ .ResetURL }}">Reset your password</a> (expires in {{ .ExpiresIn }})</p>`
+
+var notification_password_reset_textTplSource = `Hi {{ .Username }},
+
+Reset your password: {{ .ResetURL }}
+This link expires in {{ .ExpiresIn }}.`
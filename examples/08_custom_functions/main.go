@@ -8,7 +8,9 @@ import (
 
 func main() {
 	// Initialize templates with custom functions
-	InitTemplates(WithFuncs(GetTemplateFuncs()))
+	if err := InitTemplates(WithFuncs(GetTemplateFuncs())); err != nil {
+		panic(err)
+	}
 
 	fmt.Println("=== Custom Functions Example ===")
 	fmt.Println("This example demonstrates custom template functions, including")
@@ -34,13 +36,15 @@ func main() {
 
 	fmt.Println(buf.String())
 
-	// Example without custom functions (should fail with clear error)
-	fmt.Println("\n=== Without initialization ===")
-	testWithoutInit()
+	// Example without custom functions (fails with a clear error)
+	fmt.Println("\n=== Without custom functions ===")
+	testWithoutFuncs()
 }
 
-func testWithoutInit() {
-	// Reset for demonstration (in real code, don't do this)
-	// This simulates what happens if InitTemplates is not called
-	fmt.Println("Note: In a real application, forgetting to call InitTemplates() will result in a clear error message.")
+func testWithoutFuncs() {
+	// The templates use functions that are not given with WithFuncs,
+	// so InitTemplates reports them instead of panicking while parsing
+	if err := InitTemplates(); err != nil {
+		fmt.Println("Error:", err)
+	}
 }
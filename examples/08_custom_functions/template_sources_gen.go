@@ -1,9 +1,7 @@
 // Code generated by tmpltype; DO NOT EDIT.
 package main
 
-var emailTplSource = `{{- /* @param CreatedAt time.Time */ -}}
-{{- /* @param Price int */ -}}
-<!DOCTYPE html>
+var emailTplSource = `<!DOCTYPE html>
 <html>
 <head>
     <title>{{ .Title | upper }}</title>
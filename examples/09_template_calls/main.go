@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+func main() {
+	if err := InitTemplates(); err != nil {
+		panic(err)
+	}
+
+	fmt.Println("=== Example: Template calls across files ===")
+
+	// page.tmpl calls "header", "post_summary" and "footer" defined in partials.tmpl.
+	// The fields used by the partials are merged into the Page type.
+	var pageBuf bytes.Buffer
+	err := RenderPage(&pageBuf, Page{
+		Site: PageSite{Name: "My Blog"},
+		Posts: []PagePostsItem{
+			{Title: "Hello, World", Author: PageAuthor{Name: "Alice"}},
+			{Title: "Second Post", Author: PageAuthor{Name: "Bob"}},
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("Page output:")
+	fmt.Println(pageBuf.String())
+
+	// Each {{ define }} block also gets its own type and render function.
+	var summaryBuf bytes.Buffer
+	err = RenderPostSummary(&summaryBuf, PostSummary{
+		Title:  "Standalone Post",
+		Author: PostSummaryAuthor{Name: "Carol"},
+	})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("PostSummary output:")
+	fmt.Println(summaryBuf.String())
+}
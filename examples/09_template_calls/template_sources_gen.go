@@ -0,0 +1,18 @@
+// Code generated by tmpltype; DO NOT EDIT.
+package main
+
+var pageTplSource = `{{ template "header" .Site }}
+<main>
+{{- range .Posts }}
+{{ template "post_summary" . }}
+{{- end }}
+</main>
+{{ template "footer" .Site }}
+`
+
+var partialsTplSource = `{{- define "header" }}<header><h1>{{ .Name }}</h1></header>{{ end -}}
+
+{{- define "post_summary" }}<article><h2>{{ .Title }}</h2><p>by {{ .Author.Name }}</p></article>{{ end -}}
+
+{{- define "footer" }}<footer>&copy; {{ .Name }}</footer>{{ end -}}
+`
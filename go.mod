@@ -1,3 +1,14 @@
 module github.com/bellwood4486/tmpltype
 
 go 1.25.1
+
+require (
+	github.com/BurntSushi/toml v1.6.0
+	golang.org/x/tools v0.40.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	golang.org/x/mod v0.31.0 // indirect
+	golang.org/x/sync v0.19.0 // indirect
+)
@@ -0,0 +1,240 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/token"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/bellwood4486/tmpltype/internal/diag"
+	"github.com/bellwood4486/tmpltype/internal/gen"
+	"github.com/bellwood4486/tmpltype/internal/typing/magic"
+)
+
+// FileNames は Find が探す設定ファイル名
+var FileNames = []string{"tmpltype.yaml", "tmpltype.yml", "tmpltype.toml"}
+
+// Config は設定ファイルの内容
+// Dirs・Patterns・Output と "/" を含む Exclude は、読み込み時に設定ファイルのディレクトリを基準にしたパスに変換される
+type Config struct {
+	Package     string              `yaml:"package" toml:"package"`           // 出力パッケージ名（-pkg）
+	Output      string              `yaml:"output" toml:"output"`             // 出力する .go ファイル（-out）
+	Dirs        []string            `yaml:"dirs" toml:"dirs"`                 // テンプレートディレクトリ（-dir）
+	Patterns    []string            `yaml:"patterns" toml:"patterns"`         // テンプレートファイルの glob パターン（位置引数）
+	Exclude     []string            `yaml:"exclude" toml:"exclude"`           // 除外パターン（-exclude）
+	HTML        bool                `yaml:"html" toml:"html"`                 // 全テンプレートを html/template で生成する（-html）
+	Embed       bool                `yaml:"embed" toml:"embed"`               // go:embed で埋め込む（-embed）
+	SharedTypes bool                `yaml:"shared_types" toml:"shared_types"` // 同じ構造の名前付き型をテンプレート間で共有する（-shared-types）
+	Renderer    bool                `yaml:"renderer" toml:"renderer"`         // Renderer 型を生成する（-renderer）
+	Imports     map[string]string   `yaml:"imports" toml:"imports"`           // 型表現で使うパッケージ（パッケージ名 -> インポートパス、-import）
+	Funcs       []string            `yaml:"funcs" toml:"funcs"`               // カスタム関数の FuncMap の定義（"<import path>.<name>"、-funcs）
+	Types       map[string]string   `yaml:"types" toml:"types"`               // 全テンプレート共通の型マッピング（パス -> 型）
+	Templates   map[string]Template `yaml:"templates" toml:"templates"`       // テンプレート名ごとの設定
+
+	path string // 読み込んだ設定ファイルのパス
+}
+
+// Template はテンプレートごとの設定
+type Template struct {
+	Params map[string]string `yaml:"params" toml:"params"` // @param と同じ型の上書き（パス -> 型）
+}
+
+// Find は dir にある設定ファイルのパスを返す
+// 見つからない場合は空文字列を返し、複数ある場合はどれを使うか決められないためエラーにする
+func Find(dir string) (string, error) {
+	var found []string
+	for _, name := range FileNames {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			found = append(found, path)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", nil
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("multiple config files found: %s", strings.Join(found, ", "))
+	}
+}
+
+// Load は設定ファイルを読み込む
+// 形式は拡張子（.yaml / .yml / .toml）で判定し、未知のキーや不正な型表現はエラーにする
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	c := &Config{path: path}
+	switch ext := filepath.Ext(path); ext {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return nil, yamlDiagnostic(path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), c)
+		if err != nil {
+			return nil, tomlDiagnostic(path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return nil, diag.Errorf(diag.CodeConfig, path, 0, 0, "unknown field %q", undecoded[0].String())
+		}
+	default:
+		return nil, diag.Errorf(diag.CodeConfig, path, 0, 0, "unsupported config format %q (use .yaml, .yml or .toml)", ext)
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	c.resolvePaths()
+	return c, nil
+}
+
+// Apply はテンプレートに対応する設定を spec に反映する
+// 型の上書きは types、templates.<name>.params、spec に設定済みの Params の順に優先度が高くなる
+func (c *Config) Apply(spec *gen.TemplateSpec) {
+	t := c.Templates[spec.Name]
+	spec.HTML = spec.HTML || c.HTML
+
+	if len(c.Types) == 0 && len(t.Params) == 0 {
+		return
+	}
+	params := make(map[string]string, len(c.Types)+len(t.Params)+len(spec.Params))
+	maps.Copy(params, c.Types)
+	maps.Copy(params, t.Params)
+	maps.Copy(params, spec.Params)
+	spec.Params = params
+}
+
+// Options は設定に対応するコード生成オプションを返す
+func (c *Config) Options() []gen.Option {
+	var opts []gen.Option
+	if c.Embed {
+		opts = append(opts, gen.WithEmbed())
+	}
+	if c.SharedTypes {
+		opts = append(opts, gen.WithSharedTypes())
+	}
+	if c.Renderer {
+		opts = append(opts, gen.WithRenderer())
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Imports)) {
+		opts = append(opts, gen.WithImport(name, c.Imports[name]))
+	}
+	for _, ref := range c.Funcs {
+		opts = append(opts, gen.WithFuncMap(ref))
+	}
+	return opts
+}
+
+// CheckTemplates は templates に書かれたテンプレート名が names のどれかと一致するかを検証する
+// テンプレート名の書き間違いで設定が黙って無視されるのを防ぐ
+func (c *Config) CheckTemplates(names []string) error {
+	for _, name := range slices.Sorted(maps.Keys(c.Templates)) {
+		if !slices.Contains(names, name) {
+			return diag.Errorf(diag.CodeConfig, c.path, 0, 0, "templates.%s does not match any template", name)
+		}
+	}
+	return nil
+}
+
+// validate はパッケージ名と型マッピングの型表現を検証する
+func (c *Config) validate() error {
+	for _, name := range slices.Sorted(maps.Keys(c.Imports)) {
+		if !token.IsIdentifier(name) {
+			return diag.Errorf(diag.CodeConfig, c.path, 0, 0, "imports.%s: invalid package name %q", name, name)
+		}
+		if c.Imports[name] == "" {
+			return diag.Errorf(diag.CodeConfig, c.path, 0, 0, "imports.%s: missing import path", name)
+		}
+	}
+
+	check := func(prefix string, params map[string]string) error {
+		for _, path := range slices.Sorted(maps.Keys(params)) {
+			if _, err := magic.ParseParam(path, params[path]); err != nil {
+				return diag.Errorf(diag.CodeConfig, c.path, 0, 0, "%s.%s: %v", prefix, path, err)
+			}
+		}
+		return nil
+	}
+
+	if err := check("types", c.Types); err != nil {
+		return err
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Templates)) {
+		if err := check("templates."+name+".params", c.Templates[name].Params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolvePaths は相対パスを設定ファイルのディレクトリ基準に変換する
+func (c *Config) resolvePaths() {
+	dir := filepath.Dir(c.path)
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(dir, p)
+	}
+
+	c.Output = resolve(c.Output)
+	for i, d := range c.Dirs {
+		c.Dirs[i] = resolve(d)
+	}
+	for i, p := range c.Patterns {
+		c.Patterns[i] = resolve(p)
+	}
+	// "/" を含まない除外パターンはファイル名・ディレクトリ名と照合されるため変換しない
+	for i, p := range c.Exclude {
+		if strings.Contains(p, "/") {
+			c.Exclude[i] = filepath.ToSlash(resolve(p))
+		}
+	}
+}
+
+// yamlLineRegex は yaml.v3 のエラーメッセージに含まれる行番号にマッチする
+var yamlLineRegex = regexp.MustCompile(`line (\d+): (.*)`)
+
+// yamlDiagnostic は yaml.v3 のエラーを行番号付きの Diagnostic に変換する
+// 複数のエラーがある場合は最初のものを使う
+func yamlDiagnostic(path string, err error) *diag.Diagnostic {
+	msg := err.Error()
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) && len(typeErr.Errors) > 0 {
+		msg = typeErr.Errors[0]
+	}
+	msg = strings.TrimPrefix(msg, "yaml: ")
+	if m := yamlLineRegex.FindStringSubmatch(msg); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return diag.Errorf(diag.CodeConfig, path, line, 0, "%s", m[2])
+	}
+	return diag.Errorf(diag.CodeConfig, path, 0, 0, "%s", msg)
+}
+
+// tomlDiagnostic は TOML のパースエラーを行・列付きの Diagnostic に変換する
+func tomlDiagnostic(path string, err error) *diag.Diagnostic {
+	var parseErr toml.ParseError
+	if errors.As(err, &parseErr) {
+		return diag.Errorf(diag.CodeConfig, path, parseErr.Position.Line, parseErr.Position.Col, "%s", parseErr.Message)
+	}
+	return diag.Errorf(diag.CodeConfig, path, 0, 0, "%s", err.Error())
+}
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bellwood4486/tmpltype/internal/gen"
+)
+
+// writeFile はテスト用の設定ファイルを書き込み、そのパスを返す
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_YAMLAndTOMLAreEquivalent(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := writeFile(t, dir, "tmpltype.yaml", `
+package: views
+output: gen/template_gen.go
+dirs: [templates, shared]
+patterns: ["extra/*.tmpl"]
+exclude: ["*_test.tmpl", "templates/legacy/*.tmpl"]
+html: true
+embed: true
+shared_types: true
+renderer: true
+imports:
+  models: github.com/acme/app/models
+funcs:
+  - github.com/acme/app/views.Funcs
+types:
+  CreatedAt: time.Time
+templates:
+  email:
+    params:
+      User.Age: int
+`)
+	tomlPath := writeFile(t, dir, "tmpltype.toml", `
+package = "views"
+output = "gen/template_gen.go"
+dirs = ["templates", "shared"]
+patterns = ["extra/*.tmpl"]
+exclude = ["*_test.tmpl", "templates/legacy/*.tmpl"]
+html = true
+embed = true
+shared_types = true
+renderer = true
+funcs = ["github.com/acme/app/views.Funcs"]
+
+[imports]
+models = "github.com/acme/app/models"
+
+[types]
+CreatedAt = "time.Time"
+
+[templates.email.params]
+"User.Age" = "int"
+`)
+
+	fromYAML, err := Load(yamlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromTOML, err := Load(tomlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fromYAML.path, fromTOML.path = "", ""
+	if !reflect.DeepEqual(fromYAML, fromTOML) {
+		t.Fatalf("YAML and TOML configs differ:\nyaml: %+v\ntoml: %+v", fromYAML, fromTOML)
+	}
+
+	// 相対パスは設定ファイルのディレクトリ基準になる
+	if want := filepath.Join(dir, "gen", "template_gen.go"); fromYAML.Output != want {
+		t.Errorf("Output = %q, want %q", fromYAML.Output, want)
+	}
+	if want := []string{filepath.Join(dir, "templates"), filepath.Join(dir, "shared")}; !reflect.DeepEqual(fromYAML.Dirs, want) {
+		t.Errorf("Dirs = %v, want %v", fromYAML.Dirs, want)
+	}
+	if want := []string{"*_test.tmpl", filepath.ToSlash(filepath.Join(dir, "templates/legacy/*.tmpl"))}; !reflect.DeepEqual(fromYAML.Exclude, want) {
+		t.Errorf("Exclude = %v, want %v", fromYAML.Exclude, want)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+	}{
+		{
+			name:    "unknown yaml field",
+			file:    "tmpltype.yaml",
+			content: "package: views\npkg: views\n",
+			want:    "tmpltype.yaml:2: error: field pkg not found in type config.Config",
+		},
+		{
+			name:    "unknown toml field",
+			file:    "tmpltype.toml",
+			content: "package = \"views\"\npkg = \"views\"\n",
+			want:    `tmpltype.toml: error: unknown field "pkg"`,
+		},
+		{
+			name:    "toml syntax error",
+			file:    "tmpltype.toml",
+			content: "package = \n",
+			want:    "tmpltype.toml:1:",
+		},
+		{
+			name:    "invalid type",
+			file:    "tmpltype.yaml",
+			content: "templates:\n  email:\n    params:\n      User.Age: \"[]\"\n",
+			want:    `tmpltype.yaml: error: templates.email.params.User.Age: invalid type expression "[]"`,
+		},
+		{
+			name:    "invalid package name",
+			file:    "tmpltype.yaml",
+			content: "imports:\n  app-models: github.com/acme/app/models\n",
+			want:    `tmpltype.yaml: error: imports.app-models: invalid package name "app-models"`,
+		},
+		{
+			name:    "unsupported format",
+			file:    "tmpltype.json",
+			content: "{}",
+			want:    `unsupported config format ".json"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := writeFile(t, dir, tt.file, tt.content)
+			_, err := Load(path)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			got := strings.TrimPrefix(err.Error(), dir+string(filepath.Separator))
+			if !strings.Contains(got, tt.want) {
+				t.Fatalf("error = %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad_EmptyFile(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "tmpltype.yaml", "")
+	if _, err := Load(path); err != nil {
+		t.Fatalf("empty config should load, got %v", err)
+	}
+}
+
+func TestFind(t *testing.T) {
+	dir := t.TempDir()
+	if path, err := Find(dir); err != nil || path != "" {
+		t.Fatalf("Find() with no config = %q, %v", path, err)
+	}
+
+	yamlPath := writeFile(t, dir, "tmpltype.yaml", "")
+	if path, err := Find(dir); err != nil || path != yamlPath {
+		t.Fatalf("Find() = %q, %v, want %q", path, err, yamlPath)
+	}
+
+	writeFile(t, dir, "tmpltype.toml", "")
+	if _, err := Find(dir); err == nil || !strings.Contains(err.Error(), "multiple config files") {
+		t.Fatalf("expected multiple config files error, got %v", err)
+	}
+}
+
+func TestConfig_Apply(t *testing.T) {
+	c := &Config{
+		Types: map[string]string{"CreatedAt": "time.Time", "User.Age": "int64"},
+		Templates: map[string]Template{
+			"email": {Params: map[string]string{"User.Age": "int"}},
+		},
+	}
+
+	email := gen.TemplateSpec{Name: "email", Params: map[string]string{"CreatedAt": "*time.Time"}}
+	c.Apply(&email)
+	want := map[string]string{"CreatedAt": "*time.Time", "User.Age": "int"}
+	if !reflect.DeepEqual(email.Params, want) {
+		t.Errorf("email params = %v, want %v", email.Params, want)
+	}
+
+	footer := gen.TemplateSpec{Name: "footer"}
+	c.Apply(&footer)
+	if want := c.Types; !reflect.DeepEqual(footer.Params, want) {
+		t.Errorf("footer params = %v, want %v", footer.Params, want)
+	}
+}
+
+func TestConfig_CheckTemplates(t *testing.T) {
+	c := &Config{path: "tmpltype.yaml", Templates: map[string]Template{"emial": {}}}
+	err := c.CheckTemplates([]string{"email", "footer"})
+	if err == nil || err.Error() != "tmpltype.yaml: error: templates.emial does not match any template" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.CheckTemplates([]string{"emial"}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,24 @@
+// Package config は tmpltype の設定ファイル（tmpltype.yaml / tmpltype.toml）を読み込みます。
+//
+// 設定ファイルには入力ディレクトリ・出力先・パッケージ名・生成オプションに加えて、
+// 全テンプレート共通の型マッピングとテンプレートごとの @param を記述できます。
+// 読み込んだ設定は Apply で gen.TemplateSpec に反映します。
+//
+// 設定ファイルの例:
+//
+//	package: views
+//	output: template_gen.go
+//	dirs:
+//	  - templates
+//	exclude:
+//	  - "*_test.tmpl"
+//	types:
+//	  CreatedAt: time.Time
+//	templates:
+//	  email:
+//	    params:
+//	      User.Age: int
+//
+// 設定ファイル内の相対パスは設定ファイルのあるディレクトリを基準に解決されます。
+// CLI のフラグは設定ファイルの値より優先されます。
+package config
@@ -0,0 +1,131 @@
+package diag
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Severity は診断の重大度
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+// String は "error" または "warning" を返す
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// MarshalText は JSON で重大度を文字列として出力するために実装する
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Code は診断の種類を表す識別子
+type Code string
+
+const (
+	CodeParse             Code = "parse"              // テンプレートの構文エラー
+	CodeUndefinedTemplate Code = "undefined-template" // 定義されていないテンプレートの呼び出し
+	CodeDuplicateTemplate Code = "duplicate-template" // 同じ名前のテンプレートが複数定義されている
+	CodeParamSyntax       Code = "param-syntax"       // @param の型表現が不正
+	CodeParamType         Code = "param-type"         // @param の型がテンプレートでの使われ方と矛盾する
+	CodeTypeDecl          Code = "type-decl"          // @type 宣言の誤り（構文・重複・テンプレートでの使われ方との矛盾）
+	CodeImport            Code = "import"             // @import・-import の誤り（読み込めないパッケージ・未宣言のパッケージ・存在しない型）
+	CodeModel             Code = "model"              // @model の誤り（存在しない型・型にないフィールドの参照）
+	CodeFunc              Code = "func"               // カスタム関数の誤り（-funcs の FuncMap を読み込めない・引数の数や型が一致しない）
+	CodeInvalidName       Code = "invalid-name"       // テンプレート名から型名を導出できない
+	CodeNameConflict      Code = "name-conflict"      // 生成される型名・名前空間が衝突する
+	CodeTemplatePackage   Code = "template-package"   // text/template と html/template の混在
+	CodeEmbed             Code = "embed"              // go:embed で埋め込めないファイル
+	CodeBacktick          Code = "backtick"           // バッククォートを含むテンプレート（警告）
+	CodeStale             Code = "stale"              // 生成コードがテンプレートと一致しない（-check）
+	CodeConfig            Code = "config"             // 設定ファイル（tmpltype.yaml など）の誤り
+	CodeGeneric           Code = "generic"            // 上記以外のエラー（ファイルの読み込みなど）
+)
+
+// Diagnostic はテンプレート上の位置を持つエラーまたは警告
+// 位置が分からない項目はゼロ値のままにする
+// JSON のフィールド名は CI やボットが解釈するため変更しないこと
+type Diagnostic struct {
+	File     string   `json:"file"`     // テンプレートファイルのパス
+	Line     int      `json:"line"`     // 1始まりの行番号
+	Col      int      `json:"column"`   // 1始まりの列番号（バイト単位）
+	Severity Severity `json:"severity"` // "error" または "warning"
+	Code     Code     `json:"rule"`     // 診断の種類
+	Message  string   `json:"message"`
+}
+
+// Errorf は重大度 error の Diagnostic を作成する
+func Errorf(code Code, file string, line, col int, format string, args ...any) *Diagnostic {
+	return &Diagnostic{
+		File:     file,
+		Line:     line,
+		Col:      col,
+		Severity: SeverityError,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+// Warningf は重大度 warning の Diagnostic を作成する
+func Warningf(code Code, file string, line, col int, format string, args ...any) *Diagnostic {
+	d := Errorf(code, file, line, col, format, args...)
+	d.Severity = SeverityWarning
+	return d
+}
+
+// Position は "file:line:col" 形式の位置を返す（分からない項目は省略する）
+func (d *Diagnostic) Position() string {
+	var parts []string
+	if d.File != "" {
+		parts = append(parts, d.File)
+	}
+	if d.Line > 0 {
+		parts = append(parts, strconv.Itoa(d.Line))
+		if d.Col > 0 {
+			parts = append(parts, strconv.Itoa(d.Col))
+		}
+	}
+	return strings.Join(parts, ":")
+}
+
+// String は "file:line:col: severity: message" 形式の文字列を返す
+func (d *Diagnostic) String() string {
+	if pos := d.Position(); pos != "" {
+		return fmt.Sprintf("%s: %s: %s", pos, d.Severity, d.Message)
+	}
+	return fmt.Sprintf("%s: %s", d.Severity, d.Message)
+}
+
+// Error は error インターフェースを実装する
+func (d *Diagnostic) Error() string {
+	return d.String()
+}
+
+// FromError は err に含まれる Diagnostic を返す
+// Diagnostic を含まない場合は、位置なしの CodeGeneric の Diagnostic に変換する
+func FromError(err error) *Diagnostic {
+	var d *Diagnostic
+	if errors.As(err, &d) {
+		return d
+	}
+	return Errorf(CodeGeneric, "", 0, 0, "%s", err.Error())
+}
+
+// InFile は err に含まれる Diagnostic のファイルが未設定なら file を設定する
+// Diagnostic を含まない err はそのまま返す
+func InFile(err error, file string) error {
+	var d *Diagnostic
+	if errors.As(err, &d) && d.File == "" {
+		d.File = file
+	}
+	return err
+}
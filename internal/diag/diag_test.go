@@ -0,0 +1,65 @@
+package diag
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestDiagnostic_String(t *testing.T) {
+	tests := []struct {
+		name string
+		d    *Diagnostic
+		want string
+	}{
+		{name: "full position", d: Errorf(CodeParse, "templates/email.tmpl", 12, 5, "unexpected %q", "}"), want: `templates/email.tmpl:12:5: error: unexpected "}"`},
+		{name: "line only", d: Errorf(CodeParse, "a.tmpl", 3, 0, "bad"), want: "a.tmpl:3: error: bad"},
+		{name: "file only", d: Warningf(CodeBacktick, "a.tmpl", 0, 0, "backticks"), want: "a.tmpl: warning: backticks"},
+		{name: "no position", d: Errorf(CodeNameConflict, "", 0, 0, "conflict"), want: "error: conflict"},
+		{name: "no file", d: Errorf(CodeParamType, "", 2, 1, "mismatch"), want: "2:1: error: mismatch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.d.String(); got != tt.want {
+				t.Fatalf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInFile(t *testing.T) {
+	d := Errorf(CodeParamType, "", 2, 1, "mismatch")
+	err := InFile(fmt.Errorf("failed to resolve types for page: %w", d), "page.tmpl")
+
+	var got *Diagnostic
+	if !errors.As(err, &got) || got.File != "page.tmpl" {
+		t.Fatalf("file not set: %v", err)
+	}
+
+	// 既に設定されているファイルは上書きしない
+	InFile(err, "other.tmpl")
+	if got.File != "page.tmpl" {
+		t.Fatalf("file overwritten: %s", got.File)
+	}
+
+	// Diagnostic を含まないエラーはそのまま返す
+	plain := errors.New("plain")
+	if InFile(plain, "page.tmpl") != plain {
+		t.Fatal("plain error was changed")
+	}
+}
+
+func TestDiagnostic_JSON(t *testing.T) {
+	d := Warningf(CodeBacktick, "templates/email.tmpl", 12, 5, "backticks")
+	b, err := json.Marshal([]*Diagnostic{d})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// フィールド名は外部のツールが使うため固定
+	want := `[{"file":"templates/email.tmpl","line":12,"column":5,"severity":"warning","rule":"backtick","message":"backticks"}]`
+	if string(b) != want {
+		t.Fatalf("json = %s, want %s", b, want)
+	}
+}
@@ -0,0 +1,10 @@
+// Package diag はテンプレートのファイル・行・列を指す診断メッセージを提供します。
+//
+// scan・typing・gen の各パッケージはエラーを *Diagnostic として返し、
+// 上位のパッケージは fmt.Errorf の %w でラップして伝播します。
+// CLI は errors.As で Diagnostic を取り出し、エディタや CI が解釈できる
+// "templates/email.tmpl:12:5: error: ..." の形式で出力します。
+//
+// テンプレート本文しか知らないパッケージ（typing など）は行・列だけを設定し、
+// ファイルパスは InFile で呼び出し側が補います。
+package diag
@@ -0,0 +1,228 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextLines は各ハンクの前後に表示する変更のない行数
+const contextLines = 3
+
+// opKind は編集操作の種類
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+// edit は編集スクリプトの1操作
+// a, b はそれぞれの入力での行位置（削除・挿入の場合、もう一方は直前までに消費した行数）
+type edit struct {
+	kind opKind
+	a, b int
+}
+
+// Unified は oldText から newText への差分を unified diff 形式で返す
+// 差分がない場合は空文字列を返す
+func Unified(oldName, newName, oldText, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+
+	a := splitLines(oldText)
+	b := splitLines(newText)
+	edits := editScript(a, b)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n", oldName)
+	fmt.Fprintf(&sb, "+++ %s\n", newName)
+	for _, h := range hunks(edits) {
+		writeHunk(&sb, edits[h[0]:h[1]], a, b)
+	}
+	return sb.String()
+}
+
+// splitLines はテキストを改行を含む行に分割する
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// editScript は Myers のアルゴリズムで a を b に変換する最短の編集スクリプトを求める
+// 経路全体を保存せずに中央のスネークで分割していく線形空間版を使うため、差分が大きくてもメモリは入力の長さに比例する
+func editScript(a, b []string) []edit {
+	var edits []edit
+	compare(a, b, 0, len(a), 0, len(b), &edits)
+	return edits
+}
+
+// compare は a[aLo:aHi] を b[bLo:bHi] に変換する編集スクリプトを edits に追加する
+func compare(a, b []string, aLo, aHi, bLo, bHi int, edits *[]edit) {
+	// 先頭と末尾の共通行はそのまま一致として扱う
+	for aLo < aHi && bLo < bHi && a[aLo] == b[bLo] {
+		*edits = append(*edits, edit{kind: opEqual, a: aLo, b: bLo})
+		aLo++
+		bLo++
+	}
+	tail := 0
+	for aLo < aHi-tail && bLo < bHi-tail && a[aHi-tail-1] == b[bHi-tail-1] {
+		tail++
+	}
+	aHi -= tail
+	bHi -= tail
+
+	switch {
+	case aLo == aHi:
+		for y := bLo; y < bHi; y++ {
+			*edits = append(*edits, edit{kind: opInsert, a: aLo, b: y})
+		}
+	case bLo == bHi:
+		for x := aLo; x < aHi; x++ {
+			*edits = append(*edits, edit{kind: opDelete, a: x, b: bLo})
+		}
+	default:
+		// 共通の先頭・末尾を除いたため編集距離は2以上あり、中央のスネークの前後はどちらも元より小さい問題になる
+		x, y, u, v := middleSnake(a[aLo:aHi], b[bLo:bHi])
+		compare(a, b, aLo, aLo+x, bLo, bLo+y, edits)
+		for i := range u - x {
+			*edits = append(*edits, edit{kind: opEqual, a: aLo + x + i, b: bLo + y + i})
+		}
+		compare(a, b, aLo+u, aHi, bLo+v, bHi, edits)
+	}
+
+	for i := range tail {
+		*edits = append(*edits, edit{kind: opEqual, a: aHi + i, b: bHi + i})
+	}
+}
+
+// middleSnake は a から b への最短の編集経路の中央にあるスネーク（一致する行が続く対角線）を求め、
+// 始点 (x, y) と終点 (u, v) を返す
+// 先頭からの探索と末尾からの探索を1ステップずつ交互に進め、両者が同じ対角線上で重なった位置を中央とする
+func middleSnake(a, b []string) (x, y, u, v int) {
+	n, m := len(a), len(b)
+	delta := n - m
+	odd := delta%2 != 0
+	maxD := (n + m + 1) / 2
+	offset := maxD + 1
+
+	// fwd[k] は先頭から対角線 k = x - y 上で到達した x の最大値
+	// bwd[k] は末尾から逆向きの座標（a, b を反転したもの）で対角線 k 上で到達した x の最大値
+	fwd := make([]int, 2*offset+1)
+	bwd := make([]int, 2*offset+1)
+	for d := 0; d <= maxD; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && fwd[offset+k-1] < fwd[offset+k+1]) {
+				x = fwd[offset+k+1]
+			} else {
+				x = fwd[offset+k-1] + 1
+			}
+			y := x - k
+			sx, sy := x, y
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			fwd[offset+k] = x
+			// 編集距離が奇数なら、先頭からの d ステップ目と末尾からの d-1 ステップ目で重なる
+			if rk := delta - k; odd && -(d-1) <= rk && rk <= d-1 && x+bwd[offset+rk] >= n {
+				return sx, sy, x, y
+			}
+		}
+		for rk := -d; rk <= d; rk += 2 {
+			var x int
+			if rk == -d || (rk != d && bwd[offset+rk-1] < bwd[offset+rk+1]) {
+				x = bwd[offset+rk+1]
+			} else {
+				x = bwd[offset+rk-1] + 1
+			}
+			y := x - rk
+			sx, sy := x, y
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+			bwd[offset+rk] = x
+			// 編集距離が偶数なら、どちらも d ステップ目で重なる
+			if k := delta - rk; !odd && -d <= k && k <= d && fwd[offset+k]+x >= n {
+				return n - x, m - y, n - sx, m - sy
+			}
+		}
+	}
+	// 両方向の探索は maxD ステップまでに必ず重なる
+	panic("diff: middle snake not found")
+}
+
+// hunks は変更箇所を前後の文脈行とともにまとめ、各ハンクの edits 上の範囲 [start, end) を返す
+// 文脈行が重なる近い変更は1つのハンクにまとめる
+func hunks(edits []edit) [][2]int {
+	var result [][2]int
+	for i, e := range edits {
+		if e.kind == opEqual {
+			continue
+		}
+		start := max(0, i-contextLines)
+		end := min(len(edits), i+1+contextLines)
+		if n := len(result); n > 0 && result[n-1][1] >= start {
+			result[n-1][1] = end
+		} else {
+			result = append(result, [2]int{start, end})
+		}
+	}
+	return result
+}
+
+// writeHunk は1つのハンクをヘッダー付きで書き出す
+func writeHunk(sb *strings.Builder, edits []edit, a, b []string) {
+	var aLen, bLen int
+	for _, e := range edits {
+		if e.kind != opInsert {
+			aLen++
+		}
+		if e.kind != opDelete {
+			bLen++
+		}
+	}
+	fmt.Fprintf(sb, "@@ -%s +%s @@\n", hunkRange(edits[0].a, aLen), hunkRange(edits[0].b, bLen))
+
+	for _, e := range edits {
+		switch e.kind {
+		case opEqual:
+			writeLine(sb, ' ', a[e.a])
+		case opDelete:
+			writeLine(sb, '-', a[e.a])
+		case opInsert:
+			writeLine(sb, '+', b[e.b])
+		}
+	}
+}
+
+// hunkRange はハンクヘッダーの "開始行,行数" を返す
+// 行数が0の場合、開始行は直前の行番号になる (GNU diff と同じ)
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+// writeLine はプレフィックス付きで1行を書き出す
+// 末尾に改行がない行には "\ No newline at end of file" を続ける
+func writeLine(sb *strings.Builder, prefix byte, line string) {
+	sb.WriteByte(prefix)
+	sb.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		sb.WriteString("\n\\ No newline at end of file\n")
+	}
+}
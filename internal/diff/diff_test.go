@@ -0,0 +1,144 @@
+package diff
+
+import (
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name string
+		old  string
+		new  string
+		want string
+	}{
+		{name: "identical", old: "a\nb\n", new: "a\nb\n", want: ""},
+		{
+			name: "replace middle line",
+			old:  "a\nb\nc\n",
+			new:  "a\nB\nc\n",
+			want: "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			name: "create file",
+			old:  "",
+			new:  "a\nb\n",
+			want: "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "delete file",
+			old:  "a\n",
+			new:  "",
+			want: "--- old\n+++ new\n@@ -1 +0,0 @@\n-a\n",
+		},
+		{
+			name: "context is limited to three lines",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			new:  "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			want: "--- old\n+++ new\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name: "distant changes are separate hunks",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			new:  "one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n",
+			want: "--- old\n+++ new\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+ten\n",
+		},
+		{
+			name: "nearby changes are merged",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n",
+			new:  "one\n2\n3\n4\n5\n6\n7\neight\n",
+			want: "--- old\n+++ new\n@@ -1,8 +1,8 @@\n-1\n+one\n 2\n 3\n 4\n 5\n 6\n 7\n-8\n+eight\n",
+		},
+		{
+			name: "missing trailing newline",
+			old:  "a\nb",
+			new:  "a\nb\n",
+			want: "--- old\n+++ new\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Unified("old", "new", tt.old, tt.new)
+			if got != tt.want {
+				t.Fatalf("Unified() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditScript_Minimal(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	randomLines := func() []string {
+		lines := make([]string, rng.IntN(30))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.IntN(4)))
+		}
+		return lines
+	}
+
+	for i := range 1000 {
+		a, b := randomLines(), randomLines()
+		edits := editScript(a, b)
+
+		// 編集スクリプトを適用すると a と b がそれぞれ復元できること
+		var gotA, gotB []string
+		equal := 0
+		for _, e := range edits {
+			switch e.kind {
+			case opEqual:
+				if a[e.a] != b[e.b] {
+					t.Fatalf("case %d: a[%d] != b[%d] in equal edit", i, e.a, e.b)
+				}
+				equal++
+				gotA = append(gotA, a[e.a])
+				gotB = append(gotB, b[e.b])
+			case opDelete:
+				gotA = append(gotA, a[e.a])
+			case opInsert:
+				gotB = append(gotB, b[e.b])
+			}
+		}
+		if strings.Join(gotA, ",") != strings.Join(a, ",") || strings.Join(gotB, ",") != strings.Join(b, ",") {
+			t.Fatalf("case %d: edit script does not reproduce inputs\na=%q\nb=%q", i, a, b)
+		}
+		// 一致する行数が最長共通部分列と同じなら、編集スクリプトは最短
+		if want := lcsLen(a, b); equal != want {
+			t.Fatalf("case %d: %d equal lines, want %d\na=%q\nb=%q", i, equal, want, a, b)
+		}
+	}
+}
+
+func TestEditScript_LargeDifference(t *testing.T) {
+	// 全行が異なる入力は、編集距離が最大になり全行の削除と挿入になること
+	const n = 2000
+	a := make([]string, n)
+	b := make([]string, n)
+	for i := range n {
+		a[i] = "a"
+		b[i] = "b"
+	}
+	edits := editScript(a, b)
+	if len(edits) != 2*n {
+		t.Fatalf("len(edits) = %d, want %d", len(edits), 2*n)
+	}
+}
+
+// lcsLen は動的計画法で最長共通部分列の長さを求める
+func lcsLen(a, b []string) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else {
+				dp[i][j] = max(dp[i+1][j], dp[i][j+1])
+			}
+		}
+	}
+	return dp[0][0]
+}
@@ -0,0 +1,10 @@
+// Package diff はテキストの行単位の差分を unified diff 形式で出力する機能を提供します。
+//
+// 主に `tmpltype -check` で、ディスク上の生成コードと再生成結果の差分を表示するために使用されます。
+//
+// 使用例:
+//
+//	if d := diff.Unified("a/template_gen.go", "b/template_gen.go", old, new); d != "" {
+//	    fmt.Print(d)
+//	}
+package diff
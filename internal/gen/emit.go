@@ -4,12 +4,18 @@ import (
 	"fmt"
 	"go/format"
 	"maps"
+	"path"
+	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
+	"unicode"
 
+	"github.com/bellwood4486/tmpltype/internal/diag"
 	"github.com/bellwood4486/tmpltype/internal/logger"
 	"github.com/bellwood4486/tmpltype/internal/scan"
 	"github.com/bellwood4486/tmpltype/internal/typing"
+	"github.com/bellwood4486/tmpltype/internal/typing/magic"
 	"github.com/bellwood4486/tmpltype/internal/util"
 )
 
@@ -24,17 +30,89 @@ func logTemplate(name string) {
 
 // TemplateSpec は単一のテンプレート仕様
 type TemplateSpec struct {
-	Name     string // テンプレート名 (例: "footer", "mail_invite/title")
+	Name     string // テンプレート名 (例: "footer", "mail_invite/title", "mail/invite/html")
 	Pkg      string // 出力パッケージ名
-	FilePath string // テンプレートファイルパス（情報として保持）
+	FilePath string // テンプレートファイルパス（出力パッケージのディレクトリからの相対パス、-embed で使用）
 	Source   string // テンプレート本文
+	HTML     bool   // html/template で生成するか（コンテキストに応じた自動エスケープ）
+
+	// Params はテンプレート外（設定ファイルなど）で指定する @param（パス -> 型、例: "User.Age" -> "int"）
+	// テンプレートで使われているパスにだけ適用され、同じパスはテンプレート内の @param が優先される
+	Params map[string]string
 }
 
 // EmitResult はコード生成の結果を保持する
 type EmitResult struct {
-	MainCode    string   // 型定義とRender関数
-	SourcesCode string   // テンプレート文字列リテラル
-	Warnings    []string // 警告メッセージ
+	MainCode    string             // 型定義とRender関数
+	SourcesCode string             // テンプレート文字列リテラル
+	Warnings    []*diag.Diagnostic // 警告
+}
+
+// Option はコード生成の設定を変更する
+type Option func(*options)
+
+// options はコード生成の設定
+type options struct {
+	embed       bool               // テンプレート本文を文字列リテラルではなく go:embed で埋め込むか
+	sharedTypes bool               // 構造が同じ名前付き型をテンプレート間で共有するか
+	imports     []magic.ImportDecl // テンプレート外で宣言された @import
+	packageDir  string             // @import のパッケージを解決する基準のディレクトリ（空ならカレントディレクトリ）
+	funcMaps    []string           // カスタム関数の FuncMap の定義（"<import path>.<name>"）
+	renderer    bool               // パッケージのグローバル変数の代わりに Renderer 型のインスタンスがテンプレートを持つか
+}
+
+// WithEmbed はテンプレート本文を文字列リテラルとしてコピーする代わりに、
+// 元の .tmpl ファイルを指す //go:embed ディレクティブを生成する
+// 各 TemplateSpec.FilePath は出力パッケージのディレクトリ配下を指している必要がある
+func WithEmbed() Option {
+	return func(o *options) {
+		o.embed = true
+	}
+}
+
+// WithSharedTypes は複数のテンプレートで同じ名前・同じ構造になる名前付き型を、
+// テンプレート名のプレフィックスを付けない1つの共有型として生成する
+// 例: email と header の両方で User{Email, Name} が使われる場合、EmailUser と HeaderUser の代わりに User を生成する
+func WithSharedTypes() Option {
+	return func(o *options) {
+		o.sharedTypes = true
+	}
+}
+
+// WithRenderer はテンプレートのマップとオプションを持つ Renderer 型と NewRenderer を生成する
+// Renderer ごとに異なる FuncMap を使えるようになり、RenderXxx などのパッケージ関数は
+// InitTemplates が作る既定の Renderer に委譲する
+func WithRenderer() Option {
+	return func(o *options) {
+		o.renderer = true
+	}
+}
+
+// WithImport は @import と同じように、型表現で name.Type として参照できるパッケージを宣言する
+// name が空の場合はパッケージ自身の名前で参照する
+// 例: WithImport("models", "github.com/acme/app/models") で @param User models.User が使える
+func WithImport(name, path string) Option {
+	return func(o *options) {
+		o.imports = append(o.imports, magic.ImportDecl{Name: name, Path: path})
+	}
+}
+
+// WithPackageDir は @import したパッケージを dir のモジュールから解決する
+// 通常は出力パッケージのディレクトリを指定する。省略時はカレントディレクトリ
+func WithPackageDir(dir string) Option {
+	return func(o *options) {
+		o.packageDir = dir
+	}
+}
+
+// WithFuncMap はテンプレートに渡す template.FuncMap を定義する関数または変数を指定する
+// ref は "<import path>.<name>" の形式で、パッケージは WithPackageDir のディレクトリを基準に解決する
+// 関数のシグネチャから引数に渡すフィールドの型を推論し、呼び出しの引数の数や型の誤りを報告する
+// 例: WithFuncMap("github.com/acme/app/views.GetTemplateFuncs")
+func WithFuncMap(ref string) Option {
+	return func(o *options) {
+		o.funcMaps = append(o.funcMaps, ref)
+	}
 }
 
 // ============================================================
@@ -44,35 +122,50 @@ type EmitResult struct {
 // tmpl は単一テンプレートのコード生成に必要な情報
 type tmpl struct {
 	name       string              // テンプレート名
-	groupName  string              // グループ名（空ならフラット）
+	namespace  []string            // Template 名前空間でのグループのパス（空ならフラット、例: ["Mail", "Invite"]）
+	localName  string              // 名前空間内のフィールド名（例: "HTML"）
 	typeName   string              // 生成する型名
 	sourcePath string              // テンプレートファイルパス（embedでは使わないが、情報として保持）
 	varName    string              // テンプレート変数名
 	source     string              // テンプレート本文
+	define     bool                // {{ define }} で定義された名前付きテンプレートか（ソース変数を持たない）
 	typed      *typing.TypedSchema // 型情報
+	model      string              // @model で指定された既存の型（例: "models.Invoice"）。空でなければ型を生成しない
+	funcs      []string            // パースに必要なカスタム関数の名前（define では空。定義元のテンプレートが持つ）
 }
 
 // tmplGroup はテンプレートグループのコード生成に必要な情報
+// サブディレクトリごとに入れ子のグループになる
 type tmplGroup struct {
-	name      string // グループ名
-	typeName  string // 生成する型名
-	templates []tmpl // グループ内のテンプレート
+	typeName  string      // Template 名前空間でのフィールド名
+	templates []tmpl      // グループ直下のテンプレート
+	groups    []tmplGroup // サブグループ
 }
 
 // emitPrepared は解析・準備が完了したコード生成のための情報
 type emitPrepared struct {
 	pkg           string
+	templatePkg   string // "text/template" または "html/template"
 	imports       map[string]struct{}
-	groups        []tmplGroup // グループ
-	flatTemplates []tmpl      // フラットなテンプレート
+	importNames   map[string]string // インポートパス -> import 文に書く名前（パッケージ自身の名前と同じなら空）
+	groups        []tmplGroup       // グループ
+	flatTemplates []tmpl            // フラットなテンプレート
+	sharedTypes   []sharedType      // テンプレート間で共有する型（@type と WithSharedTypes）
+	shared        map[string]bool   // 共有型の名前（テンプレート名のプレフィックスを付けない）
+	renderer      bool              // Renderer 型を生成するか（WithRenderer）
 }
 
 // allTemplates はフラットとグループ内の全テンプレートを返す
 func (p *emitPrepared) allTemplates() []tmpl {
-	all := make([]tmpl, 0, len(p.flatTemplates)+len(p.groups)*2)
-	all = append(all, p.flatTemplates...)
-	for _, g := range p.groups {
-		all = append(all, g.templates...)
+	root := tmplGroup{templates: p.flatTemplates, groups: p.groups}
+	return root.allTemplates()
+}
+
+// allTemplates はグループとそのサブグループ内の全テンプレートを深さ優先で返す
+func (g tmplGroup) allTemplates() []tmpl {
+	all := slices.Clone(g.templates)
+	for _, sub := range g.groups {
+		all = append(all, sub.allTemplates()...)
 	}
 	return all
 }
@@ -83,9 +176,14 @@ func (p *emitPrepared) allTemplates() []tmpl {
 
 // Emit は複数のテンプレートから2つの統合Goファイルを生成する
 // 単一テンプレートの場合も同じフォーマットで生成される
-func Emit(specs []TemplateSpec) (*EmitResult, error) {
+func Emit(specs []TemplateSpec, opts ...Option) (*EmitResult, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
 	// Phase 1: データ収集と準備
-	prepared, err := prepare(specs)
+	prepared, err := prepare(specs, o)
 	if err != nil {
 		return nil, err
 	}
@@ -93,19 +191,35 @@ func Emit(specs []TemplateSpec) (*EmitResult, error) {
 	// Phase 2: メインコード生成
 	var mainBuilder strings.Builder
 	generateHeader(&mainBuilder, prepared.pkg)
-	generateMainImports(&mainBuilder, prepared.imports)
+	generateMainImports(&mainBuilder, prepared.imports, prepared.importNames)
 	generateTemplateNamespace(&mainBuilder, prepared)
 	generateTemplateOptions(&mainBuilder)
+	generateRequiredFuncs(&mainBuilder, prepared.allTemplates())
 	generateInitFunction(&mainBuilder, prepared)
-	generateTemplatesFunction(&mainBuilder)
-	generateGenericRenderFunction(&mainBuilder)
-	generateTemplateBlocks(&mainBuilder, prepared.allTemplates())
+	if prepared.renderer {
+		generateRendererType(&mainBuilder)
+	}
+	generateTemplatesFunction(&mainBuilder, prepared.renderer)
+	generateGenericRenderFunction(&mainBuilder, prepared.renderer)
+	generateTypedTemplateType(&mainBuilder, prepared.renderer)
+	generateReloadSupport(&mainBuilder, prepared.allTemplates(), prepared.renderer)
+	generateExecuteSupport(&mainBuilder)
+	generateErrorTypes(&mainBuilder, prepared.templatePkg)
+	generateBufferSupport(&mainBuilder)
+	generateSharedTypes(&mainBuilder, prepared.sharedTypes)
+	generateTemplateBlocks(&mainBuilder, prepared.allTemplates(), prepared.shared, prepared.renderer)
 
 	// Phase 3: テンプレート文字列リテラルファイル生成
 	var sourcesBuilder strings.Builder
-	var warnings []string
+	var warnings []*diag.Diagnostic
 	generateHeader(&sourcesBuilder, prepared.pkg)
-	warnings = generateSourcesCode(&sourcesBuilder, prepared.allTemplates())
+	if o.embed {
+		if err := generateEmbedSourcesCode(&sourcesBuilder, prepared.allTemplates()); err != nil {
+			return nil, err
+		}
+	} else {
+		warnings = generateSourcesCode(&sourcesBuilder, prepared.allTemplates())
+	}
 
 	// Phase 4: フォーマット
 	mainCode, err := formatCode(mainBuilder.String())
@@ -129,57 +243,121 @@ func Emit(specs []TemplateSpec) (*EmitResult, error) {
 // ============================================================
 
 // prepare はテンプレートをスキャンし、型を解決して、コード生成に必要なデータを準備する
-func prepare(specs []TemplateSpec) (*emitPrepared, error) {
+func prepare(specs []TemplateSpec, o *options) (*emitPrepared, error) {
 	if len(specs) == 0 {
 		return nil, fmt.Errorf("no specs provided")
 	}
 
+	templatePkg, err := resolveTemplatePkg(specs)
+	if err != nil {
+		return nil, err
+	}
+
 	templates := make([]tmpl, 0, len(specs))
 	allImports := make(map[string]struct{})
 
 	// デフォルトのimport
 	allImports["io"] = struct{}{}
-	allImports["text/template"] = struct{}{}
+	allImports[templatePkg] = struct{}{}
 	allImports["fmt"] = struct{}{}
 
+	// 全テンプレートを1つの共有テンプレートセットとしてパース
+	// ({{ template "name" }} はファイルをまたいで解決される)
+	sources := make([]scan.Source, 0, len(specs))
+	sourcePaths := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		sources = append(sources, scan.Source{Name: spec.Name, Src: spec.Source, File: spec.FilePath})
+		sourcePaths[spec.Name] = spec.FilePath
+	}
+	funcs, err := loadFuncMaps(o.funcMaps, o.packageDir)
+	if err != nil {
+		return nil, err
+	}
+	set, err := scan.NewSet(sources, scan.WithFuncNames(slices.Sorted(maps.Keys(funcs))...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan templates: %w", err)
+	}
+
+	// @type 宣言はパッケージ全体で共有される
+	decls, err := collectTypeDecls(specs)
+	if err != nil {
+		return nil, err
+	}
+	// @import と WithImport で宣言されたパッケージと、@model の型を定義するパッケージを読み込む
+	models, err := collectModels(specs)
+	if err != nil {
+		return nil, err
+	}
+	importDecls, err := collectImportDecls(specs, o, models)
+	if err != nil {
+		return nil, err
+	}
+	imported, err := loadPackages(importDecls, o.packageDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDeclaredPackages(decls, imported); err != nil {
+		return nil, err
+	}
+	declaredImports(decls, imported, allImports)
+	types := typing.WithTypes(declaredTypeExprs(decls))
+	pkgs := typing.WithPackages(imported.byName)
+	funcSigs := typing.WithFuncs(funcs)
+
 	// 各テンプレートを処理
 	for _, spec := range specs {
 		// テンプレート名はコマンド側で決定済み
 		templateName := spec.Name
 
-		// グループ名を抽出 (スラッシュが含まれていればグループ)
-		var groupName string
-		var localName string
-		if strings.Contains(templateName, "/") {
-			parts := strings.Split(templateName, "/")
-			groupName = parts[0]
-			localName = parts[1]
-		} else {
-			localName = templateName
+		// スラッシュ区切りの各階層がグループになる
+		// 例: "mail/invite/html" -> 名前空間 ["Mail", "Invite"]、ローカル名 "HTML"
+		parts := strings.Split(templateName, "/")
+		namespace := make([]string, 0, len(parts)-1)
+		for _, part := range parts[:len(parts)-1] {
+			namespace = append(namespace, util.ExportName(part))
 		}
-
-		// 型名を生成 (例: "MailInviteTitle" または "Footer")
-		var typeName string
-		if groupName != "" {
-			typeName = util.Export(groupName) + util.Export(localName)
-		} else {
-			typeName = util.Export(localName)
+		localName := util.ExportName(parts[len(parts)-1])
+		if localName == "" || slices.Contains(namespace, "") {
+			return nil, diag.Errorf(diag.CodeInvalidName, spec.FilePath, 0, 0, "cannot derive a type name from template %q", templateName)
 		}
 
+		// 型名を生成 (例: "MailInviteHTML" または "Footer")
+		typeName := strings.Join(namespace, "") + localName
+
 		// embed変数名を生成 (スラッシュをアンダースコアに変換)
 		varName := strings.ReplaceAll(templateName, "/", "_") + "TplSource"
 
 		// テンプレートをスキャン
 		logTemplate(spec.Name)
-		sch, err := scan.ScanTemplate(spec.Source)
+		sch, err := set.Scan(spec.Name)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan template %s: %w", spec.Name, err)
 		}
 
-		// 型解決
-		typed, err := typing.Resolve(sch, spec.Source)
-		if err != nil {
-			return nil, fmt.Errorf("failed to resolve types for %s: %w", spec.Name, err)
+		var typed *typing.TypedSchema
+		var modelType string
+		if model := models[spec.Name]; model != nil {
+			// @model のテンプレートは型を生成せず、既存の型に対してフィールドの参照を検証する
+			modelType, err = resolveModel(spec, model, sch, imported, pkgs, funcSigs)
+			if err != nil {
+				return nil, err
+			}
+			typed = &typing.TypedSchema{
+				Fields:  map[string]*typing.TypedField{},
+				Imports: map[string]struct{}{model.Path: {}},
+			}
+		} else {
+			// テンプレート外で指定された @param
+			params, err := paramDirectives(spec)
+			if err != nil {
+				return nil, err
+			}
+
+			// 型解決
+			typed, err = typing.Resolve(sch, spec.Source, typing.WithParams(params...), types, pkgs, funcSigs)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve types for %s: %w", spec.Name, diag.InFile(err, spec.FilePath))
+			}
 		}
 
 		// 型解決で必要になったimportsをマージ
@@ -190,60 +368,304 @@ func prepare(specs []TemplateSpec) (*emitPrepared, error) {
 		// テンプレートデータを追加
 		templates = append(templates, tmpl{
 			name:       templateName,
-			groupName:  groupName,
+			namespace:  namespace,
+			localName:  localName,
 			typeName:   typeName,
 			sourcePath: spec.FilePath,
 			varName:    varName,
 			source:     spec.Source,
 			typed:      typed,
+			model:      modelType,
+			funcs:      set.Funcs(spec.Name),
 		})
 	}
 
-	// テンプレート名でソート（出力を安定させるため）
+	// {{ define }} / {{ block }} で定義された名前付きテンプレートを処理
+	// フラットなテンプレートとして扱い、型とRender関数を生成する
+	for _, d := range set.Defines() {
+		logTemplate(d.Name)
+		sch, err := set.Scan(d.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan template %s: %w", d.Name, err)
+		}
+
+		// @param は定義元ファイルのルートに対するものなので適用しない
+		typed, err := typing.Resolve(sch, "", types, pkgs, funcSigs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve types for %s: %w", d.Name, err)
+		}
+
+		for imp := range typed.Imports {
+			allImports[imp] = struct{}{}
+		}
+
+		typeName := defineTypeName(d.Name)
+		if typeName == "" {
+			return nil, diag.Errorf(diag.CodeInvalidName, sourcePaths[d.Source], 0, 0, "cannot derive a type name from template %q defined in %s", d.Name, d.Source)
+		}
+
+		templates = append(templates, tmpl{
+			name:       d.Name,
+			localName:  typeName,
+			typeName:   typeName,
+			sourcePath: sourcePaths[d.Source],
+			define:     true,
+			typed:      typed,
+		})
+	}
+
+	// テンプレート名でソート（出力とエラーメッセージを安定させるため）
 	slices.SortFunc(templates, func(a, b tmpl) int {
 		return strings.Compare(a.name, b.name)
 	})
 
+	// 共有型を決定
+	sharedTypes := declaredSharedTypes(decls)
+	if o.sharedTypes {
+		sharedTypes = append(sharedTypes, extractSharedTypes(templates, takenTypeNames(templates, decls))...)
+		slices.SortFunc(sharedTypes, func(a, b sharedType) int {
+			return strings.Compare(a.name, b.name)
+		})
+	}
+	shared := make(map[string]bool, len(sharedTypes))
+	for _, st := range sharedTypes {
+		shared[st.name] = true
+	}
+
+	// 型名の衝突をチェック
+	if err := checkTypeNameCollisions(templates, shared, decls); err != nil {
+		return nil, err
+	}
+
 	// グループ情報を整理
 	groups, flatTemplates := organizeGroups(templates)
 
+	// 名前空間のフィールド名の衝突をチェック
+	if err := checkNamespaceCollisions(tmplGroup{templates: flatTemplates, groups: groups}, "Template"); err != nil {
+		return nil, err
+	}
+
 	return &emitPrepared{
 		pkg:           specs[0].Pkg, // すべて同じパッケージ名のはず
+		templatePkg:   templatePkg,
 		imports:       allImports,
+		importNames:   imported.names,
 		groups:        groups,
 		flatTemplates: flatTemplates,
+		sharedTypes:   sharedTypes,
+		shared:        shared,
+		renderer:      o.renderer,
 	}, nil
 }
 
-// organizeGroups はテンプレートをグループとフラットに分類する
-func organizeGroups(templates []tmpl) ([]tmplGroup, []tmpl) {
-	groupMap := make(map[string][]tmpl)
-	var flatTemplates []tmpl
+// defineTypeName は {{ define }} の名前から型名を生成する
+// 英数字以外の文字を区切りとして扱う
+// 例: "header" -> "Header", "user-card" -> "UserCard", "mail/footer" -> "MailFooter"
+func defineTypeName(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var b strings.Builder
+	for _, part := range parts {
+		b.WriteString(util.ExportName(part))
+	}
+	return b.String()
+}
+
+// reservedNames は生成コードが固定で定義する識別子
+// テンプレートから生成される型名や関数名と衝突してはならない
+var reservedNames = map[string]bool{
+	"Template":            true,
+	"TemplateName":        true,
+	"TemplateOption":      true,
+	"Templates":           true,
+	"InitTemplates":       true,
+	"WithFuncs":           true,
+	"WithReloadFromDir":   true,
+	"WithBufferedOutput":  true,
+	"RequiredFunc":        true,
+	"RequiredFuncs":       true,
+	"Renderer":            true, // WithRenderer の有無で使えるテンプレート名が変わらないよう常に予約する
+	"NewRenderer":         true,
+	"Render":              true,
+	"RenderError":         true,
+	"ExecError":           true,
+	"ErrNotInitialized":   true,
+	"ErrTemplateNotFound": true,
+	"TypedTemplate":       true,
+}
+
+// checkTypeNameCollisions は異なるテンプレートから同じ型名が生成されないかチェックする
+// パラメータ型に加えて、ネストした名前付き型（例: "MailInvite" の "Title" → "MailInviteTitle"）と @type 宣言も対象にする
+func checkTypeNameCollisions(templates []tmpl, shared map[string]bool, decls map[string]declaredType) error {
+	seen := make(map[string]string, len(templates))
+	for _, t := range templates {
+		if reservedNames[t.typeName] || reservedNames["Render"+t.typeName] || reservedNames[t.typeName+"Template"] {
+			return diag.Errorf(diag.CodeNameConflict, t.sourcePath, 0, 0, "template %q generates type %s, which conflicts with generated code", t.name, t.typeName)
+		}
+		if other, ok := seen[t.typeName]; ok {
+			return diag.Errorf(diag.CodeNameConflict, t.sourcePath, 0, 0, "templates %q and %q both generate type %s", other, t.name, t.typeName)
+		}
+		seen[t.typeName] = t.name
+	}
+	// RenderXxx の派生関数（例: RenderEmailContext）が他のテンプレートの RenderXxx と衝突しないか
+	for _, t := range templates {
+		for _, suffix := range renderFuncSuffixes {
+			if other, ok := seen[t.typeName+suffix]; ok {
+				return diag.Errorf(diag.CodeNameConflict, t.sourcePath, 0, 0, "template %q generates function Render%s%s, which conflicts with the render function of template %q", t.name, t.typeName, suffix, other)
+			}
+		}
+	}
+
+	for _, t := range templates {
+		for _, namedType := range t.typed.NamedTypes {
+			if shared[namedType.Name] {
+				continue // プレフィックスを付けずに1つだけ生成される
+			}
+			typeName := t.typeName + namedType.Name
+			if other, ok := seen[typeName]; ok && other != t.name {
+				return diag.Errorf(diag.CodeNameConflict, t.sourcePath, 0, 0, "templates %q and %q both generate type %s", other, t.name, typeName)
+			}
+			seen[typeName] = t.name
+		}
+	}
 
+	// TypedTemplate の変数（例: EmailTemplate）が型名と衝突しないか
+	handles := make(map[string]string, len(templates))
 	for _, t := range templates {
-		if t.groupName != "" {
-			groupMap[t.groupName] = append(groupMap[t.groupName], t)
+		name := t.typeName + "Template"
+		if other, ok := seen[name]; ok {
+			return diag.Errorf(diag.CodeNameConflict, t.sourcePath, 0, 0, "template %q generates variable %s, which conflicts with type %s generated for template %q", t.name, name, name, other)
+		}
+		handles[name] = t.name
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(decls)) {
+		d := decls[name]
+		if reservedNames[name] {
+			return diag.Errorf(diag.CodeTypeDecl, d.file, d.decl.Line, d.decl.Col, "@type %s conflicts with generated code", name)
+		}
+		if other, ok := seen[name]; ok {
+			return diag.Errorf(diag.CodeTypeDecl, d.file, d.decl.Line, d.decl.Col, "@type %s conflicts with type %s generated for template %q", name, name, other)
+		}
+		if other, ok := handles[name]; ok {
+			return diag.Errorf(diag.CodeTypeDecl, d.file, d.decl.Line, d.decl.Col, "@type %s conflicts with variable %s generated for template %q", name, name, other)
+		}
+	}
+	return nil
+}
+
+// takenTypeNames は共有型の名前として使えない識別子を返す
+// 生成コードの固定の識別子、テンプレートの型名と TypedTemplate の変数名、プレフィックス付きの名前付き型、@type 宣言が対象
+func takenTypeNames(templates []tmpl, decls map[string]declaredType) map[string]bool {
+	taken := maps.Clone(reservedNames)
+	for _, t := range templates {
+		taken[t.typeName] = true
+		taken[t.typeName+"Template"] = true
+		for _, namedType := range t.typed.NamedTypes {
+			taken[t.typeName+namedType.Name] = true
+		}
+	}
+	for name := range decls {
+		taken[name] = true
+	}
+	return taken
+}
+
+// checkNamespaceCollisions は Template 名前空間の同じ階層でフィールド名が重複しないかチェックする
+// 例: "mail.tmpl" と "mail/invite.tmpl" はどちらも Template.Mail を必要とする
+func checkNamespaceCollisions(g tmplGroup, path string) error {
+	seen := make(map[string]string)
+	for _, t := range g.templates {
+		if other, ok := seen[t.localName]; ok {
+			return diag.Errorf(diag.CodeNameConflict, t.sourcePath, 0, 0, "%s.%s is used by both %s and template %q", path, t.localName, other, t.name)
+		}
+		seen[t.localName] = fmt.Sprintf("template %q", t.name)
+	}
+	for _, sub := range g.groups {
+		subPath := path + "." + sub.typeName
+		if other, ok := seen[sub.typeName]; ok {
+			return diag.Errorf(diag.CodeNameConflict, "", 0, 0, "%s is used by both %s and a template group", subPath, other)
+		}
+		seen[sub.typeName] = "a template group"
+		if err := checkNamespaceCollisions(sub, subPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// paramDirectives は TemplateSpec.Params をパス順の @param ディレクティブに変換する
+func paramDirectives(spec TemplateSpec) ([]magic.ParamDirective, error) {
+	directives := make([]magic.ParamDirective, 0, len(spec.Params))
+	for _, path := range slices.Sorted(maps.Keys(spec.Params)) {
+		d, err := magic.ParseParam(path, spec.Params[path])
+		if err != nil {
+			return nil, diag.Errorf(diag.CodeParamSyntax, spec.FilePath, 0, 0, "param %s: %v", path, err)
+		}
+		directives = append(directives, d)
+	}
+	return directives, nil
+}
+
+// resolveTemplatePkg は生成コードで使うテンプレートパッケージを決定する
+// 1つのパッケージ内で text/template と html/template を混在させることはできない
+func resolveTemplatePkg(specs []TemplateSpec) (string, error) {
+	var htmlSpec, textSpec string
+	var textFile string
+	for _, spec := range specs {
+		if spec.HTML {
+			htmlSpec = spec.Name
 		} else {
-			flatTemplates = append(flatTemplates, t)
+			textSpec = spec.Name
+			textFile = spec.FilePath
 		}
 	}
 
-	// グループ情報を構築
-	var groups []tmplGroup
-	for groupName, groupTemplates := range groupMap {
-		groups = append(groups, tmplGroup{
-			name:      groupName,
-			typeName:  util.Export(groupName),
-			templates: groupTemplates,
-		})
+	if htmlSpec != "" && textSpec != "" {
+		return "", diag.Errorf(diag.CodeTemplatePackage, textFile, 0, 0, "cannot mix html and text templates in one package: %s is html, %s is text", htmlSpec, textSpec)
+	}
+	if htmlSpec != "" {
+		return "html/template", nil
 	}
+	return "text/template", nil
+}
 
-	// グループ名でソート
-	slices.SortFunc(groups, func(a, b tmplGroup) int {
-		return strings.Compare(a.name, b.name)
-	})
+// organizeGroups はテンプレートを名前空間のパスに従ってグループの木とフラットに分類する
+// 同じ型名になるグループ（例: "mail" と "Mail"）は1つのグループにまとめる
+func organizeGroups(templates []tmpl) ([]tmplGroup, []tmpl) {
+	root := &tmplGroup{}
+	for _, t := range templates {
+		g := root
+		for _, name := range t.namespace {
+			g = g.subgroup(name)
+		}
+		g.templates = append(g.templates, t)
+	}
+	root.sortGroups()
+	return root.groups, root.templates
+}
+
+// subgroup は型名が typeName のサブグループを返す（なければ作成する）
+func (g *tmplGroup) subgroup(typeName string) *tmplGroup {
+	for i := range g.groups {
+		if g.groups[i].typeName == typeName {
+			return &g.groups[i]
+		}
+	}
+	g.groups = append(g.groups, tmplGroup{typeName: typeName})
+	return &g.groups[len(g.groups)-1]
+}
 
-	return groups, flatTemplates
+// sortGroups はサブグループを型名で再帰的にソートする
+func (g *tmplGroup) sortGroups() {
+	slices.SortFunc(g.groups, func(a, b tmplGroup) int {
+		return strings.Compare(a.typeName, b.typeName)
+	})
+	for i := range g.groups {
+		g.groups[i].sortGroups()
+	}
 }
 
 // ============================================================
@@ -269,7 +691,12 @@ func formatCode(code string) (string, error) {
 }
 
 // adjustTypeForTemplate は型名をテンプレート固有に調整する
-func adjustTypeForTemplate(goType string, templatePrefix string) string {
+// shared に含まれる共有型はパッケージで1つだけ生成されるため、プレフィックスを付けない
+func adjustTypeForTemplate(goType string, templatePrefix string, shared map[string]bool) string {
+	if shared[namedTypeRef(goType)] {
+		return goType
+	}
+
 	// 名前付き型への参照を調整
 	// 例: "[]ItemsItem" -> "[]UserItemsItem" (Userテンプレートの場合)
 	// これは簡略化された実装。実際にはより複雑な型の処理が必要
@@ -326,13 +753,38 @@ func generateHeader(b *strings.Builder, pkg string) {
 }
 
 // generateMainImports はメインファイルのimportセクションを生成する
-func generateMainImports(b *strings.Builder, imports map[string]struct{}) {
-	// sync パッケージを追加（InitTemplates で sync.Once を使用）
+// names にあるパッケージは、パッケージ自身の名前とは異なる名前で import する
+func generateMainImports(b *strings.Builder, imports map[string]struct{}, names map[string]string) {
+	// InitTemplates で使用（初期化の排他、パースエラーの集約、FuncMap の比較）
 	imports["sync"] = struct{}{}
+	imports["errors"] = struct{}{}
+	imports["reflect"] = struct{}{}
+	// RenderXxxContext で使用
+	imports["context"] = struct{}{}
+	// RenderXxxString / RenderXxxBytes と WithBufferedOutput のバッファのプールで使用
+	imports["bytes"] = struct{}{}
+	imports["sync/atomic"] = struct{}{}
+	// ExecError の位置をエラーメッセージから、フィールドをパースツリーから読み取るために使用
+	imports["regexp"] = struct{}{}
+	imports["strconv"] = struct{}{}
+	imports["text/template/parse"] = struct{}{}
+	if _, ok := imports["html/template"]; ok {
+		// html/template は ExecError を公開しないため text/template を別名で使う
+		imports["text/template"] = struct{}{}
+		names["text/template"] = "texttemplate"
+	}
+	// WithReloadFromDir でテンプレートファイルを読み直すために使用
+	imports["os"] = struct{}{}
+	imports["path/filepath"] = struct{}{}
+	imports["time"] = struct{}{}
 
 	write(b, "import (\n")
 	keys := slices.Sorted(maps.Keys(imports))
 	for _, k := range keys {
+		if name := names[k]; name != "" {
+			write(b, "\t%s %q\n", name, k)
+			continue
+		}
 		write(b, "\t%q\n", k)
 	}
 	write(b, ")\n\n")
@@ -343,51 +795,47 @@ func generateMainImports(b *strings.Builder, imports map[string]struct{}) {
 // ============================================================
 
 // generateTemplateNamespace はTemplateName型と名前空間を生成する
+// グループはディレクトリの階層に合わせて入れ子の構造体になる
 func generateTemplateNamespace(b *strings.Builder, p *emitPrepared) {
 	write(b, "// TemplateName is a type-safe template name\n")
 	write(b, "type TemplateName string\n\n")
 	write(b, "// Template provides type-safe access to template names\n")
-	write(b, "var Template = struct {\n")
-
-	// フラットなテンプレート
-	for _, t := range p.flatTemplates {
-		write(b, "\t%s TemplateName\n", t.typeName)
-	}
+	write(b, "var Template = ")
 
-	// グループ
-	for _, g := range p.groups {
-		write(b, "\t%s struct {\n", g.typeName)
-		for _, t := range g.templates {
-			// ローカル名（グループプレフィックスなし）を取得
-			localName := strings.TrimPrefix(t.typeName, g.typeName)
-			write(b, "\t\t%s TemplateName\n", localName)
-		}
-		write(b, "\t}\n")
-	}
+	root := tmplGroup{templates: p.flatTemplates, groups: p.groups}
+	writeNamespaceType(b, root)
+	writeNamespaceValue(b, root)
 
-	write(b, "}{\n")
+	write(b, "\n\n")
+}
 
-	// フラットなテンプレートの初期化
-	for _, t := range p.flatTemplates {
-		write(b, "\t%s: %q,\n", t.typeName, t.name)
+// writeNamespaceType は名前空間の構造体型を書き出す（インデントは formatCode で整える）
+func writeNamespaceType(b *strings.Builder, g tmplGroup) {
+	write(b, "struct {\n")
+	for _, t := range g.templates {
+		write(b, "%s TemplateName\n", t.localName)
 	}
-
-	// グループの初期化
-	for _, g := range p.groups {
-		write(b, "\t%s: struct {\n", g.typeName)
-		for _, t := range g.templates {
-			localName := strings.TrimPrefix(t.typeName, g.typeName)
-			write(b, "\t\t%s TemplateName\n", localName)
-		}
-		write(b, "\t}{\n")
-		for _, t := range g.templates {
-			localName := strings.TrimPrefix(t.typeName, g.typeName)
-			write(b, "\t\t%s: %q,\n", localName, t.name)
-		}
-		write(b, "\t},\n")
+	for _, sub := range g.groups {
+		write(b, "%s ", sub.typeName)
+		writeNamespaceType(b, sub)
+		write(b, "\n")
 	}
+	write(b, "}")
+}
 
-	write(b, "}\n\n")
+// writeNamespaceValue は名前空間の構造体リテラルの値を書き出す
+func writeNamespaceValue(b *strings.Builder, g tmplGroup) {
+	write(b, "{\n")
+	for _, t := range g.templates {
+		write(b, "%s: %q,\n", t.localName, t.name)
+	}
+	for _, sub := range g.groups {
+		write(b, "%s: ", sub.typeName)
+		writeNamespaceType(b, sub)
+		writeNamespaceValue(b, sub)
+		write(b, ",\n")
+	}
+	write(b, "}")
 }
 
 // ============================================================
@@ -395,14 +843,19 @@ func generateTemplateNamespace(b *strings.Builder, p *emitPrepared) {
 // ============================================================
 
 // generateSourcesCode は各テンプレートの文字列リテラルを生成する
-func generateSourcesCode(b *strings.Builder, templates []tmpl) []string {
-	var warnings []string
+func generateSourcesCode(b *strings.Builder, templates []tmpl) []*diag.Diagnostic {
+	var warnings []*diag.Diagnostic
 	for _, t := range templates {
+		// {{ define }} のテンプレートは定義元ファイルのソースに含まれる
+		if t.define {
+			continue
+		}
+
 		// 文字列リテラルとして埋め込む
 		// テンプレートにバッククォートが含まれる場合は、ダブルクォート文字列を使う
 		if strings.Contains(t.source, "`") {
 			// 警告メッセージを追加
-			warnings = append(warnings, fmt.Sprintf("Warn: template '%s' contains backticks, using escaped format", t.name))
+			warnings = append(warnings, diag.Warningf(diag.CodeBacktick, t.sourcePath, 0, 0, "template %q contains backticks, using escaped format", t.name))
 
 			// バッククォートが含まれる場合: ダブルクォートで囲み、必要な文字をエスケープ
 			// 注: バッククォート自体はエスケープ不要（ダブルクォート文字列内では有効な文字）
@@ -420,6 +873,67 @@ func generateSourcesCode(b *strings.Builder, templates []tmpl) []string {
 	return warnings
 }
 
+// generateEmbedSourcesCode は各テンプレートの元ファイルを go:embed で埋め込むコードを生成する
+// テンプレート変数は文字列リテラルの場合と同じ名前で、embed.FS から読み込んだ内容で初期化される
+func generateEmbedSourcesCode(b *strings.Builder, templates []tmpl) error {
+	var paths []string
+	for _, t := range templates {
+		if t.define {
+			continue
+		}
+		embedPath, err := embedPathFor(t)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, embedPath)
+	}
+
+	write(b, "import \"embed\"\n\n")
+	for _, p := range paths {
+		write(b, "//go:embed %s\n", quoteEmbedPath(p))
+	}
+	write(b, "var templateFS embed.FS\n\n")
+
+	i := 0
+	for _, t := range templates {
+		if t.define {
+			continue
+		}
+		write(b, "var %s = mustReadTemplate(%q)\n\n", t.varName, paths[i])
+		i++
+	}
+
+	write(b, "func mustReadTemplate(path string) string {\n")
+	write(b, "\tb, err := templateFS.ReadFile(path)\n")
+	write(b, "\tif err != nil {\n")
+	write(b, "\t\tpanic(err)\n")
+	write(b, "\t}\n")
+	write(b, "\treturn string(b)\n")
+	write(b, "}\n")
+	return nil
+}
+
+// embedPathFor はテンプレートファイルを go:embed で参照するパスを返す
+// go:embed はパッケージディレクトリ配下のファイルしか埋め込めないため、外を指すパスはエラーにする
+func embedPathFor(t tmpl) (string, error) {
+	if t.sourcePath == "" {
+		return "", diag.Errorf(diag.CodeEmbed, "", 0, 0, "template %s has no file path to embed", t.name)
+	}
+	p := path.Clean(filepath.ToSlash(t.sourcePath))
+	if p == ".." || strings.HasPrefix(p, "../") || path.IsAbs(p) {
+		return "", diag.Errorf(diag.CodeEmbed, t.sourcePath, 0, 0, "cannot embed template %s: %s is outside the output package directory", t.name, t.sourcePath)
+	}
+	return p, nil
+}
+
+// quoteEmbedPath は go:embed のパターンとして書けるようにパスを必要に応じてクォートする
+func quoteEmbedPath(p string) string {
+	if strings.ContainsAny(p, " \t\"`") {
+		return strconv.Quote(p)
+	}
+	return p
+}
+
 // ============================================================
 // Code Generation - Template Options (Functional Option Pattern)
 // ============================================================
@@ -430,7 +944,9 @@ func generateTemplateOptions(b *strings.Builder) {
 	write(b, "type TemplateOption func(*templateConfig)\n\n")
 
 	write(b, "type templateConfig struct {\n")
-	write(b, "\tfuncs template.FuncMap\n")
+	write(b, "\tfuncs          template.FuncMap\n")
+	write(b, "\treloadDir      string\n")
+	write(b, "\tbufferedOutput bool\n")
 	write(b, "}\n\n")
 
 	write(b, "// WithFuncs sets custom template functions\n")
@@ -439,6 +955,77 @@ func generateTemplateOptions(b *strings.Builder) {
 	write(b, "\t\tc.funcs = funcs\n")
 	write(b, "\t}\n")
 	write(b, "}\n\n")
+
+	write(b, "// WithReloadFromDir re-reads template files from disk whenever they change,\n")
+	write(b, "// instead of using the sources compiled into the binary.\n")
+	write(b, "// dir is the directory of the generated package; template file paths are resolved relative to it.\n")
+	write(b, "// Every render checks the file modification times, so use this for development only.\n")
+	write(b, "func WithReloadFromDir(dir string) TemplateOption {\n")
+	write(b, "\treturn func(c *templateConfig) {\n")
+	write(b, "\t\tc.reloadDir = dir\n")
+	write(b, "\t}\n")
+	write(b, "}\n\n")
+
+	write(b, "// WithBufferedOutput makes the render functions that write to an io.Writer\n")
+	write(b, "// execute the template into an internal buffer and write the output only if\n")
+	write(b, "// execution succeeds, so a failing template never leaves partial output.\n")
+	write(b, "// Execution errors are returned as *RenderError.\n")
+	write(b, "func WithBufferedOutput() TemplateOption {\n")
+	write(b, "\treturn func(c *templateConfig) {\n")
+	write(b, "\t\tc.bufferedOutput = true\n")
+	write(b, "\t}\n")
+	write(b, "}\n\n")
+}
+
+// ============================================================
+// Code Generation - Required Functions
+// ============================================================
+
+// generateRequiredFuncs はテンプレートが使うカスタム関数の一覧と、その確認関数を生成する
+// 関数ごとに、使っているテンプレートを名前順に並べる
+func generateRequiredFuncs(b *strings.Builder, templates []tmpl) {
+	users := make(map[string][]string)
+	for _, t := range templates {
+		for _, name := range t.funcs {
+			users[name] = append(users[name], templateFieldRef(t))
+		}
+	}
+
+	write(b, "// RequiredFunc is a custom template function and the templates that use it\n")
+	write(b, "type RequiredFunc struct {\n")
+	write(b, "\tName      string\n")
+	write(b, "\tTemplates []TemplateName\n")
+	write(b, "}\n\n")
+
+	write(b, "// RequiredFuncs lists the custom functions used by the templates, in name order.\n")
+	write(b, "// InitTemplates fails unless WithFuncs provides all of them.\n")
+	write(b, "var RequiredFuncs = []RequiredFunc{\n")
+	for _, name := range slices.Sorted(maps.Keys(users)) {
+		write(b, "\t{Name: %q, Templates: []TemplateName{%s}},\n", name, strings.Join(users[name], ", "))
+	}
+	write(b, "}\n\n")
+
+	write(b, "// checkRequiredFuncs reports the functions of RequiredFuncs that funcs does not provide\n")
+	write(b, "func checkRequiredFuncs(funcs template.FuncMap) error {\n")
+	write(b, "\tmissing := \"\"\n")
+	write(b, "\tfor _, f := range RequiredFuncs {\n")
+	write(b, "\t\tif _, ok := funcs[f.Name]; ok {\n")
+	write(b, "\t\t\tcontinue\n")
+	write(b, "\t\t}\n")
+	write(b, "\t\tif missing != \"\" {\n")
+	write(b, "\t\t\tmissing += \", \"\n")
+	write(b, "\t\t}\n")
+	write(b, "\t\tmissing += f.Name + \" (used by\"\n")
+	write(b, "\t\tfor _, name := range f.Templates {\n")
+	write(b, "\t\t\tmissing += fmt.Sprintf(\" %%q\", name)\n")
+	write(b, "\t\t}\n")
+	write(b, "\t\tmissing += \")\"\n")
+	write(b, "\t}\n")
+	write(b, "\tif missing != \"\" {\n")
+	write(b, "\t\treturn fmt.Errorf(\"missing template functions: %%s; provide them with WithFuncs\", missing)\n")
+	write(b, "\t}\n")
+	write(b, "\treturn nil\n")
+	write(b, "}\n\n")
 }
 
 // ============================================================
@@ -446,9 +1033,21 @@ func generateTemplateOptions(b *strings.Builder) {
 // ============================================================
 
 // generateInitFunction は InitTemplates 関数を生成する
+// パースの失敗や不正な FuncMap は panic せずにエラーとして返す
+// WithRenderer の場合、InitTemplates はパッケージ関数が使う既定の Renderer を作る
 func generateInitFunction(b *strings.Builder, p *emitPrepared) {
-	write(b, "var templates map[TemplateName]*template.Template\n")
-	write(b, "var initOnce sync.Once\n\n")
+	if p.renderer {
+		write(b, "var (\n")
+		write(b, "\tinitMu          sync.Mutex\n")
+		write(b, "\tdefaultRenderer *Renderer // renderer of the package-level functions, created by InitTemplates\n")
+		write(b, ")\n\n")
+	} else {
+		write(b, "var templates map[TemplateName]*template.Template\n\n")
+		write(b, "var (\n")
+		write(b, "\tinitMu     sync.Mutex\n")
+		write(b, "\tinitConfig *templateConfig // options of the first successful InitTemplates call\n")
+		write(b, ")\n\n")
+	}
 
 	write(b, "// InitTemplates initializes all templates with the given options.\n")
 	write(b, "// Must be called before using any render functions.\n")
@@ -457,43 +1056,229 @@ func generateInitFunction(b *strings.Builder, p *emitPrepared) {
 	write(b, "//\n")
 	write(b, "//\tInitTemplates() // without custom functions\n")
 	write(b, "//\tInitTemplates(WithFuncs(GetTemplateFuncs())) // with custom functions\n")
-	write(b, "func InitTemplates(opts ...TemplateOption) {\n")
-	write(b, "\tinitOnce.Do(func() {\n")
-	write(b, "\t\tconfig := &templateConfig{}\n")
-	write(b, "\t\tfor _, opt := range opts {\n")
-	write(b, "\t\t\topt(config)\n")
-	write(b, "\t\t}\n\n")
-
-	write(b, "\t\ttemplates = map[TemplateName]*template.Template{\n")
-
-	// フラットなテンプレート
-	for _, t := range p.flatTemplates {
-		fieldRef := "Template." + t.typeName
-		write(b, "\t\t\t%s: newTemplate(%s, %s, config),\n",
-			fieldRef, fieldRef, t.varName)
+	write(b, "//\tInitTemplates(WithReloadFromDir(\".\")) // reload templates from disk during development\n")
+	write(b, "//\n")
+	write(b, "// It returns an error, without initializing, if WithFuncs does not provide\n")
+	write(b, "// every function listed in RequiredFuncs, if the FuncMap is invalid, or if\n")
+	write(b, "// a template fails to parse. Once initialized, calling it again with the\n")
+	write(b, "// same options does nothing, and calling it with different options is an error.\n")
+	write(b, "// Functions are compared by identity, so closures created from one function\n")
+	write(b, "// literal count as the same function even if they capture different values.\n")
+	if p.renderer {
+		write(b, "// Use NewRenderer to render the templates with other options.\n")
 	}
+	write(b, "func InitTemplates(opts ...TemplateOption) error {\n")
+	write(b, "\tconfig := newTemplateConfig(opts)\n")
+	// 関数が足りないとパースに失敗するため、どの関数が足りないかを先に報告する
+	write(b, "\tif err := checkRequiredFuncs(config.funcs); err != nil {\n")
+	write(b, "\t\treturn err\n")
+	write(b, "\t}\n\n")
+	write(b, "\tinitMu.Lock()\n")
+	write(b, "\tdefer initMu.Unlock()\n")
+	if p.renderer {
+		write(b, "\tif defaultRenderer != nil {\n")
+		write(b, "\t\tif !sameConfig(defaultRenderer.config, config) {\n")
+	} else {
+		write(b, "\tif initConfig != nil {\n")
+		write(b, "\t\tif !sameConfig(initConfig, config) {\n")
+	}
+	write(b, "\t\t\treturn fmt.Errorf(\"templates already initialized with different options\")\n")
+	write(b, "\t\t}\n")
+	write(b, "\t\treturn nil\n")
+	write(b, "\t}\n\n")
+	if p.renderer {
+		write(b, "\tr, err := newRenderer(config)\n")
+		write(b, "\tif err != nil {\n")
+		write(b, "\t\treturn err\n")
+		write(b, "\t}\n")
+		write(b, "\tdefaultRenderer = r\n")
+		write(b, "\treturn nil\n")
+		write(b, "}\n\n")
+	} else {
+		write(b, "\tparsed, err := parseTemplates(config)\n")
+		write(b, "\tif err != nil {\n")
+		write(b, "\t\treturn err\n")
+		write(b, "\t}\n")
+		// Render 関数は templates で初期化済みかを判定してから initConfig を参照するため、先に設定する
+		write(b, "\tinitConfig = config\n")
+		write(b, "\ttemplates = parsed\n")
+		write(b, "\tif config.reloadDir != \"\" {\n")
+		write(b, "\t\treloader = &templateReloader{config: config, templates: parsed}\n")
+		write(b, "\t}\n")
+		write(b, "\treturn nil\n")
+		write(b, "}\n\n")
+	}
+
+	// newTemplateConfig helper function
+	write(b, "// newTemplateConfig applies the options to an empty configuration\n")
+	write(b, "func newTemplateConfig(opts []TemplateOption) *templateConfig {\n")
+	write(b, "\tconfig := &templateConfig{}\n")
+	write(b, "\tfor _, opt := range opts {\n")
+	write(b, "\t\topt(config)\n")
+	write(b, "\t}\n")
+	write(b, "\treturn config\n")
+	write(b, "}\n\n")
 
-	// グループ内のテンプレート
-	for _, g := range p.groups {
-		for _, t := range g.templates {
-			localName := strings.TrimPrefix(t.typeName, g.typeName)
-			fieldRef := "Template." + g.typeName + "." + localName
-			write(b, "\t\t\t%s: newTemplate(%s, %s, config),\n",
-				fieldRef, fieldRef, t.varName)
+	// parseTemplates helper function
+	// 全テンプレートを1つのセットにパースし、{{ template }} をファイル間で解決できるようにする
+	write(b, "// parseTemplates parses all templates into one set, reporting every template that fails to parse\n")
+	write(b, "func parseTemplates(config *templateConfig) (map[TemplateName]*template.Template, error) {\n")
+	write(b, "\tset, err := newTemplateSet(config)\n")
+	write(b, "\tif err != nil {\n")
+	write(b, "\t\treturn nil, err\n")
+	write(b, "\t}\n")
+	write(b, "\tparsed := make(map[TemplateName]*template.Template)\n")
+	write(b, "\tvar errs []error\n")
+	write(b, "\tfor _, src := range []struct {\n")
+	write(b, "\t\tname   TemplateName\n")
+	write(b, "\t\tsource string\n")
+	write(b, "\t}{\n")
+
+	var defines []string
+	for _, t := range p.allTemplates() {
+		fieldRef := templateFieldRef(t)
+		if t.define {
+			defines = append(defines, fieldRef)
+			continue
 		}
+		write(b, "\t\t{%s, %s},\n", fieldRef, t.varName)
 	}
 
+	write(b, "\t} {\n")
+	write(b, "\t\ttmpl, err := set.New(string(src.name)).Parse(src.source)\n")
+	write(b, "\t\tif err != nil {\n")
+	write(b, "\t\t\terrs = append(errs, fmt.Errorf(\"failed to parse template %%q: %%w\", src.name, err))\n")
+	write(b, "\t\t\tcontinue\n")
 	write(b, "\t\t}\n")
-	write(b, "\t})\n")
+	write(b, "\t\tparsed[src.name] = tmpl\n")
+	write(b, "\t}\n")
+	write(b, "\tif len(errs) > 0 {\n")
+	write(b, "\t\treturn nil, errors.Join(errs...)\n")
+	write(b, "\t}\n")
+
+	// {{ define }} のテンプレートは全ソースのパース後にセットから取り出す
+	for _, fieldRef := range defines {
+		write(b, "\tparsed[%s] = set.Lookup(string(%s))\n", fieldRef, fieldRef)
+	}
+	write(b, "\treturn parsed, nil\n")
 	write(b, "}\n\n")
 
-	// newTemplate helper function
-	write(b, "func newTemplate(name TemplateName, source string, config *templateConfig) *template.Template {\n")
-	write(b, "\tt := template.New(string(name))\n")
+	// newTemplateSet helper function
+	write(b, "// newTemplateSet returns an empty template set with the custom functions of config\n")
+	write(b, "func newTemplateSet(config *templateConfig) (set *template.Template, err error) {\n")
+	write(b, "\tset = template.New(\"\").Option(%q)\n", "missingkey=error")
 	write(b, "\tif config.funcs != nil {\n")
-	write(b, "\t\tt = t.Funcs(config.funcs)\n")
+	write(b, "\t\t// Funcs panics if a value is not a function with one or two results\n")
+	write(b, "\t\tdefer func() {\n")
+	write(b, "\t\t\tif r := recover(); r != nil {\n")
+	write(b, "\t\t\t\tset, err = nil, fmt.Errorf(\"invalid FuncMap: %%v\", r)\n")
+	write(b, "\t\t\t}\n")
+	write(b, "\t\t}()\n")
+	write(b, "\t\tset = set.Funcs(config.funcs)\n")
+	write(b, "\t}\n")
+	write(b, "\treturn set, nil\n")
+	write(b, "}\n\n")
+
+	// sameConfig helper function
+	// 関数はコードのポインタで比較する
+	// 同じ関数リテラルから作ったクロージャはキャプチャした値が違っても同じ関数とみなされる
+	write(b, "// sameConfig reports whether two configurations initialize the templates the same way\n")
+	write(b, "func sameConfig(a, b *templateConfig) bool {\n")
+	write(b, "\tif a.reloadDir != b.reloadDir || a.bufferedOutput != b.bufferedOutput || len(a.funcs) != len(b.funcs) {\n")
+	write(b, "\t\treturn false\n")
+	write(b, "\t}\n")
+	write(b, "\tfor name, fn := range a.funcs {\n")
+	write(b, "\t\tother, ok := b.funcs[name]\n")
+	write(b, "\t\tif !ok || !sameFunc(fn, other) {\n")
+	write(b, "\t\t\treturn false\n")
+	write(b, "\t\t}\n")
 	write(b, "\t}\n")
-	write(b, "\treturn template.Must(t.Option(%q).Parse(source))\n", "missingkey=error")
+	write(b, "\treturn true\n")
+	write(b, "}\n\n")
+
+	write(b, "// sameFunc reports whether two FuncMap values are the same function.\n")
+	write(b, "// Closures created from one function literal share their code and compare equal.\n")
+	write(b, "func sameFunc(a, b any) bool {\n")
+	write(b, "\tva, vb := reflect.ValueOf(a), reflect.ValueOf(b)\n")
+	write(b, "\treturn va.Kind() == reflect.Func && vb.Kind() == reflect.Func && va.Pointer() == vb.Pointer()\n")
+	write(b, "}\n\n")
+}
+
+// templateFieldRef は Template 名前空間でテンプレートを参照する式を返す
+// 例: "Template.Footer", "Template.MailInvite.Title", "Template.Mail.Invite.HTML"
+func templateFieldRef(t tmpl) string {
+	parts := append([]string{"Template"}, t.namespace...)
+	return strings.Join(append(parts, t.localName), ".")
+}
+
+// ============================================================
+// Code Generation - Renderer (WithRenderer)
+// ============================================================
+
+// generateRendererType は Renderer 型とそのコンストラクタ、汎用のメソッドを生成する
+// Renderer はテンプレートのマップとオプションを自身で持つため、異なる FuncMap のインスタンスを並べて使える
+func generateRendererType(b *strings.Builder) {
+	write(b, "// Renderer renders the templates with its own options.\n")
+	write(b, "// Renderers created with different options, such as per-locale functions,\n")
+	write(b, "// can be used side by side. The package-level render functions use the\n")
+	write(b, "// renderer created by InitTemplates.\n")
+	write(b, "type Renderer struct {\n")
+	write(b, "\tconfig    *templateConfig\n")
+	write(b, "\ttemplates map[TemplateName]*template.Template\n")
+	write(b, "\treloader  *templateReloader\n")
+	write(b, "}\n\n")
+
+	write(b, "// NewRenderer parses all templates with the given options.\n")
+	write(b, "// It accepts the same options as InitTemplates and returns the same errors.\n")
+	write(b, "func NewRenderer(opts ...TemplateOption) (*Renderer, error) {\n")
+	write(b, "\tconfig := newTemplateConfig(opts)\n")
+	write(b, "\tif err := checkRequiredFuncs(config.funcs); err != nil {\n")
+	write(b, "\t\treturn nil, err\n")
+	write(b, "\t}\n")
+	write(b, "\treturn newRenderer(config)\n")
+	write(b, "}\n\n")
+
+	write(b, "func newRenderer(config *templateConfig) (*Renderer, error) {\n")
+	write(b, "\tparsed, err := parseTemplates(config)\n")
+	write(b, "\tif err != nil {\n")
+	write(b, "\t\treturn nil, err\n")
+	write(b, "\t}\n")
+	write(b, "\tr := &Renderer{config: config, templates: parsed}\n")
+	write(b, "\tif config.reloadDir != \"\" {\n")
+	write(b, "\t\tr.reloader = &templateReloader{config: config, templates: parsed}\n")
+	write(b, "\t}\n")
+	write(b, "\treturn r, nil\n")
+	write(b, "}\n\n")
+
+	write(b, "// Templates returns a map of all templates of r.\n")
+	write(b, "// With WithReloadFromDir, it is the set parsed by the latest reload.\n")
+	write(b, "func (r *Renderer) Templates() map[TemplateName]*template.Template {\n")
+	write(b, "\tif r.reloader != nil {\n")
+	write(b, "\t\treturn r.reloader.current()\n")
+	write(b, "\t}\n")
+	write(b, "\treturn r.templates\n")
+	write(b, "}\n\n")
+
+	write(b, "// Render renders a template of r by name with the given data\n")
+	write(b, "func (r *Renderer) Render(w io.Writer, name TemplateName, data any) error {\n")
+	write(b, "\ttmpl, err := r.lookup(name)\n")
+	write(b, "\tif err != nil {\n")
+	write(b, "\t\treturn err\n")
+	write(b, "\t}\n")
+	write(b, "\treturn execute(context.Background(), tmpl, w, data, r.config)\n")
+	write(b, "}\n\n")
+
+	write(b, "// lookup returns the template for name, reloading it from disk first\n")
+	write(b, "// when WithReloadFromDir is set\n")
+	write(b, "func (r *Renderer) lookup(name TemplateName) (*template.Template, error) {\n")
+	write(b, "\tif r.reloader != nil {\n")
+	write(b, "\t\treturn r.reloader.lookup(name)\n")
+	write(b, "\t}\n")
+	write(b, "\ttmpl, ok := r.templates[name]\n")
+	write(b, "\tif !ok {\n")
+	write(b, "\t\treturn nil, fmt.Errorf(\"%%w: %%q\", ErrTemplateNotFound, name)\n")
+	write(b, "\t}\n")
+	write(b, "\treturn tmpl, nil\n")
 	write(b, "}\n\n")
 }
 
@@ -502,25 +1287,523 @@ func generateInitFunction(b *strings.Builder, p *emitPrepared) {
 // ============================================================
 
 // generateTemplatesFunction はTemplates()関数を生成する
-func generateTemplatesFunction(b *strings.Builder) {
-	write(b, "// Templates returns a map of all templates\n")
+func generateTemplatesFunction(b *strings.Builder, renderer bool) {
+	write(b, "// Templates returns a map of all templates.\n")
+	write(b, "// With WithReloadFromDir, it is the set parsed by the latest reload.\n")
 	write(b, "func Templates() map[TemplateName]*template.Template {\n")
-	write(b, "\treturn templates\n")
+	if renderer {
+		write(b, "\tif defaultRenderer == nil {\n")
+		write(b, "\t\treturn nil\n")
+		write(b, "\t}\n")
+		write(b, "\treturn defaultRenderer.Templates()\n")
+	} else {
+		write(b, "\tif reloader != nil {\n")
+		write(b, "\t\treturn reloader.current()\n")
+		write(b, "\t}\n")
+		write(b, "\treturn templates\n")
+	}
 	write(b, "}\n\n")
 }
 
 // generateGenericRenderFunction は汎用Render関数を生成する
-func generateGenericRenderFunction(b *strings.Builder) {
+func generateGenericRenderFunction(b *strings.Builder, renderer bool) {
+	if renderer {
+		write(b, "// Render renders a template by name with the given data\n")
+		write(b, "func Render(w io.Writer, name TemplateName, data any) error {\n")
+		write(b, "\tr, err := initializedRenderer()\n")
+		write(b, "\tif err != nil {\n")
+		write(b, "\t\treturn err\n")
+		write(b, "\t}\n")
+		write(b, "\treturn r.Render(w, name, data)\n")
+		write(b, "}\n\n")
+
+		// initializedRenderer helper function
+		write(b, "// initializedRenderer returns the renderer created by InitTemplates\n")
+		write(b, "func initializedRenderer() (*Renderer, error) {\n")
+		write(b, "\tif defaultRenderer == nil {\n")
+		write(b, "\t\treturn nil, ErrNotInitialized\n")
+		write(b, "\t}\n")
+		write(b, "\treturn defaultRenderer, nil\n")
+		write(b, "}\n\n")
+		return
+	}
+
 	write(b, "// Render renders a template by name with the given data\n")
 	write(b, "func Render(w io.Writer, name TemplateName, data any) error {\n")
+	write(b, "\ttmpl, err := lookupTemplate(name)\n")
+	write(b, "\tif err != nil {\n")
+	write(b, "\t\treturn err\n")
+	write(b, "\t}\n")
+	write(b, "\treturn execute(context.Background(), tmpl, w, data, initConfig)\n")
+	write(b, "}\n\n")
+
+	// lookupTemplate helper function
+	write(b, "// lookupTemplate returns the template for name, reloading it from disk first\n")
+	write(b, "// when WithReloadFromDir is set\n")
+	write(b, "func lookupTemplate(name TemplateName) (*template.Template, error) {\n")
 	write(b, "\tif templates == nil {\n")
-	write(b, "\t\treturn fmt.Errorf(\"templates not initialized: call InitTemplates() first\")\n")
+	write(b, "\t\treturn nil, ErrNotInitialized\n")
+	write(b, "\t}\n")
+	write(b, "\tif reloader != nil {\n")
+	write(b, "\t\treturn reloader.lookup(name)\n")
 	write(b, "\t}\n")
 	write(b, "\ttmpl, ok := templates[name]\n")
 	write(b, "\tif !ok {\n")
-	write(b, "\t\treturn fmt.Errorf(\"template %%q not found\", name)\n")
+	write(b, "\t\treturn nil, fmt.Errorf(\"%%w: %%q\", ErrTemplateNotFound, name)\n")
+	write(b, "\t}\n")
+	write(b, "\treturn tmpl, nil\n")
+	write(b, "}\n\n")
+}
+
+// ============================================================
+// Code Generation - Typed Templates (Generics)
+// ============================================================
+
+// generateTypedTemplateType はテンプレート名とデータの型を組にするジェネリック型を生成する
+// Render(w, name, data any) と違い、ハンドラのファクトリなどの汎用コードでもデータの型を保てる
+func generateTypedTemplateType(b *strings.Builder, renderer bool) {
+	write(b, "// TypedTemplate is a template together with the type of its data.\n")
+	write(b, "// Generic code, such as an HTTP handler factory, can take a TypedTemplate[T]\n")
+	write(b, "// and render any template without losing the data type.\n")
+	write(b, "type TypedTemplate[T any] struct {\n")
+	write(b, "\tname TemplateName\n")
+	write(b, "}\n\n")
+
+	write(b, "// Name returns the name of the template\n")
+	write(b, "func (t TypedTemplate[T]) Name() TemplateName {\n")
+	write(b, "\treturn t.name\n")
+	write(b, "}\n\n")
+
+	write(b, "// Execute renders the template with data\n")
+	write(b, "func (t TypedTemplate[T]) Execute(w io.Writer, data T) error {\n")
+	write(b, "\treturn Render(w, t.name, data)\n")
+	write(b, "}\n\n")
+
+	write(b, "// ExecuteContext renders the template with data, stopping once ctx is done\n")
+	write(b, "func (t TypedTemplate[T]) ExecuteContext(ctx context.Context, w io.Writer, data T) error {\n")
+	if renderer {
+		write(b, "\tr, err := initializedRenderer()\n")
+		write(b, "\tif err != nil {\n")
+		write(b, "\t\treturn err\n")
+		write(b, "\t}\n")
+		write(b, "\ttmpl, err := r.lookup(t.name)\n")
+		write(b, "\tif err != nil {\n")
+		write(b, "\t\treturn err\n")
+		write(b, "\t}\n")
+		write(b, "\treturn execute(ctx, tmpl, w, data, r.config)\n")
+	} else {
+		write(b, "\ttmpl, err := lookupTemplate(t.name)\n")
+		write(b, "\tif err != nil {\n")
+		write(b, "\t\treturn err\n")
+		write(b, "\t}\n")
+		write(b, "\treturn execute(ctx, tmpl, w, data, initConfig)\n")
+	}
+	write(b, "}\n\n")
+
+	if renderer {
+		write(b, "// ExecuteWith renders the template with data using r\n")
+		write(b, "func (t TypedTemplate[T]) ExecuteWith(r *Renderer, w io.Writer, data T) error {\n")
+		write(b, "\treturn r.Render(w, t.name, data)\n")
+		write(b, "}\n\n")
+	}
+}
+
+// ============================================================
+// Code Generation - Hot Reload
+// ============================================================
+
+// generateReloadSupport は WithReloadFromDir 用のファイル一覧と再読み込み処理を生成する
+// ファイルのどれかが更新されたらセット全体をパースし直す ({{ template }} がファイルをまたぐため)
+func generateReloadSupport(b *strings.Builder, templates []tmpl, renderer bool) {
+	write(b, "// templateFiles lists the template source files, relative to the generated package directory\n")
+	write(b, "var templateFiles = []struct {\n")
+	write(b, "\tname TemplateName\n")
+	write(b, "\tpath string\n")
+	write(b, "}{\n")
+	for _, t := range templates {
+		if t.define {
+			continue
+		}
+		write(b, "\t{%s, %q},\n", templateFieldRef(t), path.Clean(filepath.ToSlash(t.sourcePath)))
+	}
+	write(b, "}\n\n")
+
+	if !renderer {
+		write(b, "var reloader *templateReloader\n\n")
+	}
+
+	write(b, "// templateReloader re-parses the template set when a template file changes on disk\n")
+	write(b, "// templates starts as the set parsed at initialization\n")
+	write(b, "type templateReloader struct {\n")
+	write(b, "\tmu        sync.Mutex\n")
+	write(b, "\tconfig    *templateConfig\n")
+	write(b, "\ttemplates map[TemplateName]*template.Template\n")
+	write(b, "\tmodTimes  map[string]time.Time\n")
+	write(b, "}\n\n")
+
+	write(b, "func (r *templateReloader) lookup(name TemplateName) (*template.Template, error) {\n")
+	write(b, "\tr.mu.Lock()\n")
+	write(b, "\tdefer r.mu.Unlock()\n")
+	write(b, "\tif err := r.reloadIfChanged(); err != nil {\n")
+	write(b, "\t\treturn nil, err\n")
+	write(b, "\t}\n")
+	write(b, "\ttmpl, ok := r.templates[name]\n")
+	write(b, "\tif !ok {\n")
+	write(b, "\t\treturn nil, fmt.Errorf(\"%%w: %%q\", ErrTemplateNotFound, name)\n")
+	write(b, "\t}\n")
+	write(b, "\treturn tmpl, nil\n")
+	write(b, "}\n\n")
+
+	write(b, "// current returns the template set parsed by the latest reload\n")
+	write(b, "func (r *templateReloader) current() map[TemplateName]*template.Template {\n")
+	write(b, "\tr.mu.Lock()\n")
+	write(b, "\tdefer r.mu.Unlock()\n")
+	write(b, "\treturn r.templates\n")
+	write(b, "}\n\n")
+
+	write(b, "func (r *templateReloader) reloadIfChanged() error {\n")
+	write(b, "\tchanged := r.templates == nil\n")
+	write(b, "\tmodTimes := make(map[string]time.Time, len(templateFiles))\n")
+	write(b, "\tfor _, f := range templateFiles {\n")
+	write(b, "\t\tinfo, err := os.Stat(filepath.Join(r.config.reloadDir, filepath.FromSlash(f.path)))\n")
+	write(b, "\t\tif err != nil {\n")
+	write(b, "\t\t\treturn fmt.Errorf(\"failed to reload template %%q: %%w\", f.name, err)\n")
+	write(b, "\t\t}\n")
+	write(b, "\t\tif !info.ModTime().Equal(r.modTimes[f.path]) {\n")
+	write(b, "\t\t\tchanged = true\n")
+	write(b, "\t\t}\n")
+	write(b, "\t\tmodTimes[f.path] = info.ModTime()\n")
+	write(b, "\t}\n")
+	write(b, "\tif !changed {\n")
+	write(b, "\t\treturn nil\n")
+	write(b, "\t}\n\n")
+
+	write(b, "\tset, err := newTemplateSet(r.config)\n")
+	write(b, "\tif err != nil {\n")
+	write(b, "\t\treturn err\n")
+	write(b, "\t}\n")
+	write(b, "\tnext := make(map[TemplateName]*template.Template, len(r.templates))\n")
+	write(b, "\tfor _, f := range templateFiles {\n")
+	write(b, "\t\tsource, err := os.ReadFile(filepath.Join(r.config.reloadDir, filepath.FromSlash(f.path)))\n")
+	write(b, "\t\tif err != nil {\n")
+	write(b, "\t\t\treturn fmt.Errorf(\"failed to reload template %%q: %%w\", f.name, err)\n")
+	write(b, "\t\t}\n")
+	write(b, "\t\ttmpl, err := set.New(string(f.name)).Parse(string(source))\n")
+	write(b, "\t\tif err != nil {\n")
+	write(b, "\t\t\treturn fmt.Errorf(\"failed to reload template %%q: %%w\", f.name, err)\n")
+	write(b, "\t\t}\n")
+	write(b, "\t\tnext[f.name] = tmpl\n")
+	write(b, "\t}\n")
+	// {{ define }} のテンプレートはファイルを持たないので、パース後のセットから取り出す
+	write(b, "\tfor name := range r.templates {\n")
+	write(b, "\t\tif _, ok := next[name]; ok {\n")
+	write(b, "\t\t\tcontinue\n")
+	write(b, "\t\t}\n")
+	write(b, "\t\ttmpl := set.Lookup(string(name))\n")
+	write(b, "\t\tif tmpl == nil {\n")
+	write(b, "\t\t\treturn fmt.Errorf(\"failed to reload template %%q: no longer defined\", name)\n")
+	write(b, "\t\t}\n")
+	write(b, "\t\tnext[name] = tmpl\n")
+	write(b, "\t}\n\n")
+
+	write(b, "\tr.templates = next\n")
+	write(b, "\tr.modTimes = modTimes\n")
+	write(b, "\treturn nil\n")
+	write(b, "}\n\n")
+}
+
+// ============================================================
+// Code Generation - Execution (Context and Buffered Output)
+// ============================================================
+
+// generateExecuteSupport は io.Writer に書き込む Render 関数が共通で使う実行処理を生成する
+// text/template は実行を中断する手段を持たないため、書き込みのたびに ctx を確認する
+// WithBufferedOutput の場合はプールのバッファに実行し、成功したときだけ w に書き込む
+func generateExecuteSupport(b *strings.Builder) {
+	write(b, "// execute executes tmpl into w with the options of config.\n")
+	write(b, "// Once ctx is done, the next write fails and the error is ctx.Err() wrapped\n")
+	write(b, "// with the template name. With WithBufferedOutput, the output is written to w\n")
+	write(b, "// only if execution succeeds, and execution errors are wrapped in *RenderError.\n")
+	write(b, "func execute(ctx context.Context, tmpl *template.Template, w io.Writer, data any, config *templateConfig) error {\n")
+	write(b, "\tif err := ctx.Err(); err != nil {\n")
+	write(b, "\t\treturn fmt.Errorf(\"template %%q: %%w\", tmpl.Name(), err)\n")
+	write(b, "\t}\n")
+	write(b, "\tout := w\n")
+	write(b, "\tvar buf *bytes.Buffer\n")
+	write(b, "\tif config.bufferedOutput {\n")
+	write(b, "\t\tbuf = getBuffer()\n")
+	write(b, "\t\tdefer putBuffer(buf)\n")
+	write(b, "\t\tout = buf\n")
+	write(b, "\t}\n")
+	write(b, "\t// a context that is never done, such as context.Background(), needs no checks\n")
+	write(b, "\tif ctx.Done() != nil {\n")
+	write(b, "\t\tout = &contextWriter{ctx: ctx, w: out}\n")
+	write(b, "\t}\n")
+	write(b, "\tif err := tmpl.Execute(out, data); err != nil {\n")
+	write(b, "\t\tif ctxErr := ctx.Err(); ctxErr != nil {\n")
+	write(b, "\t\t\treturn fmt.Errorf(\"template %%q: %%w\", tmpl.Name(), ctxErr)\n")
+	write(b, "\t\t}\n")
+	write(b, "\t\terr = newExecError(tmpl, err)\n")
+	write(b, "\t\tif buf != nil {\n")
+	write(b, "\t\t\treturn newRenderError(tmpl, err)\n")
+	write(b, "\t\t}\n")
+	write(b, "\t\treturn err\n")
+	write(b, "\t}\n")
+	write(b, "\tif buf == nil {\n")
+	write(b, "\t\treturn nil\n")
+	write(b, "\t}\n")
+	write(b, "\t_, err := w.Write(buf.Bytes())\n")
+	write(b, "\treturn err\n")
+	write(b, "}\n\n")
+
+	write(b, "// contextWriter fails every write once ctx is done\n")
+	write(b, "type contextWriter struct {\n")
+	write(b, "\tctx context.Context\n")
+	write(b, "\tw   io.Writer\n")
+	write(b, "}\n\n")
+
+	write(b, "func (cw *contextWriter) Write(p []byte) (int, error) {\n")
+	write(b, "\tif err := cw.ctx.Err(); err != nil {\n")
+	write(b, "\t\treturn 0, err\n")
+	write(b, "\t}\n")
+	write(b, "\treturn cw.w.Write(p)\n")
+	write(b, "}\n\n")
+
+}
+
+// ============================================================
+// Code Generation - Errors
+// ============================================================
+
+// generateErrorTypes は Render 関数が返すエラーの型と、実行エラーから位置とフィールドを取り出す処理を生成する
+// html/template は text/template の ExecError を公開しないため、html の場合は text/template を別名で import する
+// 位置はエラーメッセージから、フィールドのパスはパースツリーから読み取る
+func generateErrorTypes(b *strings.Builder, templatePkg string) {
+	execErrorType := "template.ExecError"
+	if templatePkg == "html/template" {
+		execErrorType = "texttemplate.ExecError"
+	}
+
+	write(b, "// ErrNotInitialized is returned by the render functions until InitTemplates succeeds\n")
+	write(b, "var ErrNotInitialized = errors.New(\"templates not initialized: call InitTemplates() first\")\n\n")
+
+	write(b, "// ErrTemplateNotFound is returned by Render for a name that is not a generated template\n")
+	write(b, "var ErrTemplateNotFound = errors.New(\"template not found\")\n\n")
+
+	write(b, "// ExecError is returned by the render functions when a template fails to execute.\n")
+	write(b, "//\n")
+	write(b, "// File, Line and Col locate the failing node in the source that defines it,\n")
+	write(b, "// which is another template's source when the failure is inside a {{ template }} call.\n")
+	write(b, "// Field is relative to the dot of that template: a failure on {{ .Name }} inside\n")
+	write(b, "// {{ template \"user\" .User }} gives \"Name\", not \"User.Name\".\n")
+	write(b, "type ExecError struct {\n")
+	write(b, "\tTemplate TemplateName // template that was rendered\n")
+	write(b, "\tFile     string       // template file of the failing node, relative to the generated package directory, or \"\" if unknown\n")
+	write(b, "\tLine     int          // line of the failing node, or 0 if unknown\n")
+	write(b, "\tCol      int          // byte offset of the failing node within the line, or 0 if unknown\n")
+	write(b, "\tField    string       // field path the failing node refers to, relative to the dot of the template that contains it, or \"\" if none\n")
+	write(b, "\tErr      error        // error returned by the template package\n")
+	write(b, "}\n\n")
+
+	write(b, "func (e *ExecError) Error() string {\n")
+	write(b, "\treturn e.Err.Error()\n")
+	write(b, "}\n\n")
+
+	write(b, "func (e *ExecError) Unwrap() error {\n")
+	write(b, "\treturn e.Err\n")
+	write(b, "}\n\n")
+
+	write(b, "// RenderError is returned by the render functions that write to an io.Writer\n")
+	write(b, "// when WithBufferedOutput is set and the template fails to execute.\n")
+	write(b, "// Nothing has been written to the writer. Err is usually an *ExecError.\n")
+	write(b, "type RenderError struct {\n")
+	write(b, "\tTemplate TemplateName // template that was rendered\n")
+	write(b, "\tLine     int          // line of the failing node, or 0 if unknown\n")
+	write(b, "\tCol      int          // byte offset of the failing node within the line, or 0 if unknown\n")
+	write(b, "\tErr      error\n")
+	write(b, "}\n\n")
+
+	write(b, "func (e *RenderError) Error() string {\n")
+	write(b, "\treturn fmt.Sprintf(\"failed to render template %%q: %%v\", e.Template, e.Err)\n")
+	write(b, "}\n\n")
+
+	write(b, "func (e *RenderError) Unwrap() error {\n")
+	write(b, "\treturn e.Err\n")
+	write(b, "}\n\n")
+
+	write(b, "// newRenderError wraps an execution error of tmpl with the position of the failing node\n")
+	write(b, "func newRenderError(tmpl *template.Template, err error) *RenderError {\n")
+	write(b, "\te := &RenderError{Template: TemplateName(tmpl.Name()), Err: err}\n")
+	write(b, "\tvar execErr *ExecError\n")
+	write(b, "\tif errors.As(err, &execErr) {\n")
+	write(b, "\t\te.Line, e.Col = execErr.Line, execErr.Col\n")
+	write(b, "\t}\n")
+	write(b, "\treturn e\n")
+	write(b, "}\n\n")
+
+	write(b, "// execErrorLocation matches the location in execution errors, as in\n")
+	write(b, "// \"template: email:3:14: executing ...\"\n")
+	write(b, "var execErrorLocation = regexp.MustCompile(`^template: (.*?):(\\d+):(\\d+): `)\n\n")
+
+	write(b, "// newExecError wraps an execution error of tmpl in an *ExecError.\n")
+	write(b, "// Other errors, such as write errors, are returned as is.\n")
+	write(b, "func newExecError(tmpl *template.Template, err error) error {\n")
+	write(b, "\tvar execErr %s\n", execErrorType)
+	write(b, "\tif !errors.As(err, &execErr) {\n")
+	write(b, "\t\treturn err\n")
+	write(b, "\t}\n")
+	write(b, "\te := &ExecError{Template: TemplateName(tmpl.Name()), Err: err}\n")
+	write(b, "\tm := execErrorLocation.FindStringSubmatch(err.Error())\n")
+	write(b, "\tif m == nil {\n")
+	write(b, "\t\treturn e\n")
+	write(b, "\t}\n")
+	write(b, "\te.Line, _ = strconv.Atoi(m[2])\n")
+	write(b, "\te.Col, _ = strconv.Atoi(m[3])\n")
+	write(b, "\t// the location names the template whose source contains the node\n")
+	write(b, "\tfor _, f := range templateFiles {\n")
+	write(b, "\t\tif string(f.name) == m[1] {\n")
+	write(b, "\t\t\te.File = f.path\n")
+	write(b, "\t\t}\n")
+	write(b, "\t}\n")
+	write(b, "\tlocation := m[1] + \":\" + m[2] + \":\" + m[3]\n")
+	write(b, "\tfor _, t := range tmpl.Templates() {\n")
+	write(b, "\t\tif t.Tree != nil && t.Tree.ParseName == m[1] {\n")
+	write(b, "\t\t\tif e.Field = fieldAt(t.Tree, t.Tree.Root, location); e.Field != \"\" {\n")
+	write(b, "\t\t\t\tbreak\n")
+	write(b, "\t\t\t}\n")
+	write(b, "\t\t}\n")
 	write(b, "\t}\n")
-	write(b, "\treturn tmpl.Execute(w, data)\n")
+	write(b, "\treturn e\n")
+	write(b, "}\n\n")
+
+	write(b, "// fieldAt returns the path of the field node at location, or of the first field\n")
+	write(b, "// argument of the command at location, or \"\" if there is none.\n")
+	write(b, "// The error message shortens the node, so the full path is read from the parse tree.\n")
+	write(b, "func fieldAt(tree *parse.Tree, node parse.Node, location string) string {\n")
+	write(b, "\tswitch n := node.(type) {\n")
+	write(b, "\tcase *parse.ListNode:\n")
+	write(b, "\t\tif n == nil {\n")
+	write(b, "\t\t\treturn \"\"\n")
+	write(b, "\t\t}\n")
+	write(b, "\t\tfor _, child := range n.Nodes {\n")
+	write(b, "\t\t\tif field := fieldAt(tree, child, location); field != \"\" {\n")
+	write(b, "\t\t\t\treturn field\n")
+	write(b, "\t\t\t}\n")
+	write(b, "\t\t}\n")
+	write(b, "\tcase *parse.ActionNode:\n")
+	write(b, "\t\treturn fieldAt(tree, n.Pipe, location)\n")
+	write(b, "\tcase *parse.PipeNode:\n")
+	write(b, "\t\tif n == nil {\n")
+	write(b, "\t\t\treturn \"\"\n")
+	write(b, "\t\t}\n")
+	write(b, "\t\tfor _, cmd := range n.Cmds {\n")
+	write(b, "\t\t\tif field := fieldAt(tree, cmd, location); field != \"\" {\n")
+	write(b, "\t\t\t\treturn field\n")
+	write(b, "\t\t\t}\n")
+	write(b, "\t\t}\n")
+	write(b, "\tcase *parse.CommandNode:\n")
+	write(b, "\t\tfor _, arg := range n.Args {\n")
+	write(b, "\t\t\tif field := fieldAt(tree, arg, location); field != \"\" {\n")
+	write(b, "\t\t\t\treturn field\n")
+	write(b, "\t\t\t}\n")
+	write(b, "\t\t}\n")
+	write(b, "\t\tif loc, _ := tree.ErrorContext(n); loc == location {\n")
+	write(b, "\t\t\tfor _, arg := range n.Args {\n")
+	write(b, "\t\t\t\tif f, ok := arg.(*parse.FieldNode); ok {\n")
+	write(b, "\t\t\t\t\treturn f.String()[1:]\n")
+	write(b, "\t\t\t\t}\n")
+	write(b, "\t\t\t}\n")
+	write(b, "\t\t}\n")
+	write(b, "\tcase *parse.FieldNode:\n")
+	write(b, "\t\tif loc, _ := tree.ErrorContext(n); loc == location {\n")
+	write(b, "\t\t\treturn n.String()[1:]\n")
+	write(b, "\t\t}\n")
+	write(b, "\tcase *parse.IfNode:\n")
+	write(b, "\t\treturn fieldAtBranch(tree, &n.BranchNode, location)\n")
+	write(b, "\tcase *parse.RangeNode:\n")
+	write(b, "\t\treturn fieldAtBranch(tree, &n.BranchNode, location)\n")
+	write(b, "\tcase *parse.WithNode:\n")
+	write(b, "\t\treturn fieldAtBranch(tree, &n.BranchNode, location)\n")
+	write(b, "\tcase *parse.TemplateNode:\n")
+	write(b, "\t\treturn fieldAt(tree, n.Pipe, location)\n")
+	write(b, "\t}\n")
+	write(b, "\treturn \"\"\n")
+	write(b, "}\n\n")
+
+	write(b, "func fieldAtBranch(tree *parse.Tree, n *parse.BranchNode, location string) string {\n")
+	write(b, "\tfor _, child := range []parse.Node{n.Pipe, n.List, n.ElseList} {\n")
+	write(b, "\t\tif field := fieldAt(tree, child, location); field != \"\" {\n")
+	write(b, "\t\t\treturn field\n")
+	write(b, "\t\t}\n")
+	write(b, "\t}\n")
+	write(b, "\treturn \"\"\n")
+	write(b, "}\n")
+}
+
+// ============================================================
+// Code Generation - String and Bytes Rendering
+// ============================================================
+
+// generateBufferSupport は RenderXxxString / RenderXxxBytes と WithBufferedOutput が使うバッファのプールを生成する
+// 新しいバッファは過去の出力サイズの移動平均で確保し、再確保を減らす
+func generateBufferSupport(b *strings.Builder) {
+	write(b, "// bufferPool reuses the buffers of the RenderXxxString and RenderXxxBytes functions\n")
+	write(b, "// and of WithBufferedOutput\n")
+	write(b, "var bufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}\n\n")
+
+	write(b, "// averageOutputSize is a running average of the rendered output sizes, used to size buffers\n")
+	write(b, "var averageOutputSize atomic.Int64\n\n")
+
+	write(b, "// minPooledBufferSize is the capacity a pooled buffer may always keep;\n")
+	write(b, "// larger buffers are kept only up to four times the average output size\n")
+	write(b, "const minPooledBufferSize = 64 << 10\n\n")
+
+	write(b, "// executeString executes tmpl into a pooled buffer and returns the output as a string\n")
+	write(b, "func executeString(tmpl *template.Template, data any) (string, error) {\n")
+	write(b, "\tbuf := getBuffer()\n")
+	write(b, "\tdefer putBuffer(buf)\n")
+	write(b, "\tif err := tmpl.Execute(buf, data); err != nil {\n")
+	write(b, "\t\treturn \"\", newExecError(tmpl, err)\n")
+	write(b, "\t}\n")
+	write(b, "\treturn buf.String(), nil\n")
+	write(b, "}\n\n")
+
+	write(b, "// executeBytes executes tmpl into a pooled buffer and returns a copy of the output\n")
+	write(b, "func executeBytes(tmpl *template.Template, data any) ([]byte, error) {\n")
+	write(b, "\tbuf := getBuffer()\n")
+	write(b, "\tdefer putBuffer(buf)\n")
+	write(b, "\tif err := tmpl.Execute(buf, data); err != nil {\n")
+	write(b, "\t\treturn nil, newExecError(tmpl, err)\n")
+	write(b, "\t}\n")
+	write(b, "\treturn bytes.Clone(buf.Bytes()), nil\n")
+	write(b, "}\n\n")
+
+	write(b, "// getBuffer returns an empty buffer with room for an average output\n")
+	write(b, "func getBuffer() *bytes.Buffer {\n")
+	write(b, "\tbuf := bufferPool.Get().(*bytes.Buffer)\n")
+	write(b, "\tbuf.Reset()\n")
+	write(b, "\tbuf.Grow(int(averageOutputSize.Load()))\n")
+	write(b, "\treturn buf\n")
+	write(b, "}\n\n")
+
+	write(b, "// putBuffer records the output size and returns buf to the pool,\n")
+	write(b, "// unless it grew much larger than the average output\n")
+	write(b, "func putBuffer(buf *bytes.Buffer) {\n")
+	write(b, "\tsize := int64(buf.Len())\n")
+	write(b, "\tfor {\n")
+	write(b, "\t\tavg := averageOutputSize.Load()\n")
+	write(b, "\t\tnext := size\n")
+	write(b, "\t\tif avg > 0 {\n")
+	write(b, "\t\t\tnext = avg + (size-avg)/8\n")
+	write(b, "\t\t}\n")
+	write(b, "\t\tif averageOutputSize.CompareAndSwap(avg, next) {\n")
+	write(b, "\t\t\tbreak\n")
+	write(b, "\t\t}\n")
+	write(b, "\t}\n")
+	write(b, "\tif buf.Cap() > minPooledBufferSize && int64(buf.Cap()) > 4*averageOutputSize.Load() {\n")
+	write(b, "\t\treturn\n")
+	write(b, "\t}\n")
+	write(b, "\tbufferPool.Put(buf)\n")
 	write(b, "}\n\n")
 }
 
@@ -529,7 +1812,7 @@ func generateGenericRenderFunction(b *strings.Builder) {
 // ============================================================
 
 // generateTemplateBlocks は各テンプレートごとの型定義とRender関数を生成する
-func generateTemplateBlocks(b *strings.Builder, templates []tmpl) {
+func generateTemplateBlocks(b *strings.Builder, templates []tmpl, shared map[string]bool, renderer bool) {
 	generatedTypes := make(map[string]bool)
 
 	for _, t := range templates {
@@ -538,15 +1821,21 @@ func generateTemplateBlocks(b *strings.Builder, templates []tmpl) {
 		write(b, "// %s template\n", t.name)
 		write(b, "// ============================================================\n\n")
 
-		generateNamedTypes(b, t, generatedTypes)
-		generateParamType(b, t)
-		generateRenderFunction(b, t)
+		if t.model == "" {
+			generateNamedTypes(b, t, generatedTypes, shared)
+			generateParamType(b, t, shared)
+		}
+		generateRenderFunction(b, t, renderer)
+		generateTypedTemplateVar(b, t)
 	}
 }
 
 // generateNamedTypes は名前付き型を生成する
-func generateNamedTypes(b *strings.Builder, t tmpl, generatedTypes map[string]bool) {
+func generateNamedTypes(b *strings.Builder, t tmpl, generatedTypes map[string]bool, shared map[string]bool) {
 	for _, namedType := range t.typed.NamedTypes {
+		if shared[namedType.Name] {
+			continue // 共有型として生成済み
+		}
 		// 型名の衝突を避けるため、プレフィックスを付ける
 		typeName := t.typeName + namedType.Name
 		if generatedTypes[typeName] {
@@ -560,7 +1849,7 @@ func generateNamedTypes(b *strings.Builder, t tmpl, generatedTypes map[string]bo
 		for _, fieldName := range fieldNames {
 			field := namedType.Fields[fieldName]
 			// フィールドの型名も調整が必要な場合がある
-			goType := adjustTypeForTemplate(field.GoType, t.typeName)
+			goType := adjustTypeForTemplate(field.GoType, t.typeName, shared)
 			write(b, "\t%s %s\n", field.Name, goType)
 		}
 		write(b, "}\n\n")
@@ -568,7 +1857,7 @@ func generateNamedTypes(b *strings.Builder, t tmpl, generatedTypes map[string]bo
 }
 
 // generateParamType はメインのパラメータ型を生成する
-func generateParamType(b *strings.Builder, t tmpl) {
+func generateParamType(b *strings.Builder, t tmpl, shared map[string]bool) {
 	write(b, "// %s represents parameters for %s template\n", t.typeName, t.name)
 	write(b, "type %s struct {\n", t.typeName)
 	// トップレベルフィールドをソートして順序を安定化
@@ -576,35 +1865,129 @@ func generateParamType(b *strings.Builder, t tmpl) {
 	for _, fieldName := range topFieldNames {
 		field := t.typed.Fields[fieldName]
 		// フィールドの型名も調整が必要な場合がある
-		goType := adjustTypeForTemplate(field.GoType, t.typeName)
+		goType := adjustTypeForTemplate(field.GoType, t.typeName, shared)
 		write(b, "\t%s %s\n", field.Name, goType)
 	}
 	write(b, "}\n\n")
 }
 
+// renderFuncSuffixes は RenderXxx から派生する関数名の接尾辞（generateRenderFunction と合わせる）
+var renderFuncSuffixes = []string{"Context", "String", "Bytes"}
+
+// renderFunc は型安全な Render 関数の1つの種類
+// 本体はテンプレートを探して call を返すだけで、call の中では tmpl を使える
+type renderFunc struct {
+	name    string // 関数名（例: "RenderEmailContext"）
+	doc     string // ドキュメントコメントの "renders the <name> template" に続く説明
+	params  string // 引数リスト（例: "ctx context.Context, w io.Writer, p Email"）
+	args    string // 委譲時に渡す引数（例: "ctx, w, p"）
+	results string // 戻り値の型（空なら "error"）
+	zero    string // エラー時に err の前に返す値（例: `"", `）
+	call    string // テンプレートを実行する式（例: "executeString(tmpl, p)"）
+}
+
 // generateRenderFunction は型安全なRender関数を生成する
-func generateRenderFunction(b *strings.Builder, t tmpl) {
+// WithRenderer の場合は Renderer のメソッドと、既定の Renderer に委譲するパッケージ関数を生成する
+func generateRenderFunction(b *strings.Builder, t tmpl, renderer bool) {
 	funcName := "Render" + t.typeName
+	dataType := templateDataType(t)
+
+	// io.Writer に書き込む関数は WithBufferedOutput などのオプションを参照する
+	config := "initConfig"
+	if renderer {
+		config = "r.config"
+	}
+
+	funcs := []renderFunc{
+		{
+			name:   funcName,
+			params: fmt.Sprintf("w io.Writer, p %s", dataType),
+			args:   "w, p",
+			call:   fmt.Sprintf("execute(context.Background(), tmpl, w, p, %s)", config),
+		},
+		{
+			name:   funcName + "Context",
+			doc:    ", stopping once ctx is done",
+			params: fmt.Sprintf("ctx context.Context, w io.Writer, p %s", dataType),
+			args:   "ctx, w, p",
+			call:   fmt.Sprintf("execute(ctx, tmpl, w, p, %s)", config),
+		},
+		{
+			name:    funcName + "String",
+			doc:     " to a string",
+			params:  fmt.Sprintf("p %s", dataType),
+			args:    "p",
+			results: "(string, error)",
+			zero:    `"", `,
+			call:    "executeString(tmpl, p)",
+		},
+		{
+			name:    funcName + "Bytes",
+			doc:     " to a byte slice",
+			params:  fmt.Sprintf("p %s", dataType),
+			args:    "p",
+			results: "([]byte, error)",
+			zero:    "nil, ",
+			call:    "executeBytes(tmpl, p)",
+		},
+	}
+	for _, f := range funcs {
+		writeRenderFunc(b, t, f, renderer)
+	}
+}
+
+// templateDataType はテンプレートに渡すデータの型を返す
+// @model のテンプレートは既存の型をそのまま受け取る
+func templateDataType(t tmpl) string {
+	if t.model != "" {
+		return t.model
+	}
+	return t.typeName
+}
+
+// generateTypedTemplateVar はテンプレートとデータの型を組にした TypedTemplate の変数を生成する
+func generateTypedTemplateVar(b *strings.Builder, t tmpl) {
+	name := t.typeName + "Template"
+	write(b, "// %s is the %s template with its data type, for generic code\n", name, t.name)
+	write(b, "var %s = TypedTemplate[%s]{name: %s}\n\n", name, templateDataType(t), templateFieldRef(t))
+}
 
+// writeRenderFunc は1つの Render 関数を生成する
+func writeRenderFunc(b *strings.Builder, t tmpl, f renderFunc, renderer bool) {
 	// フィールド参照を構築 (グループ対応)
-	var fieldRef string
-	if t.groupName != "" {
-		groupTypeName := util.Export(t.groupName)
-		localName := strings.TrimPrefix(t.typeName, groupTypeName)
-		fieldRef = "Template." + groupTypeName + "." + localName
-	} else {
-		fieldRef = "Template." + t.typeName
+	fieldRef := templateFieldRef(t)
+	results := f.results
+	if results == "" {
+		results = "error"
 	}
 
-	write(b, "// %s renders the %s template\n", funcName, t.name)
-	write(b, "func %s(w io.Writer, p %s) error {\n", funcName, t.typeName)
-	write(b, "\tif templates == nil {\n")
-	write(b, "\t\treturn fmt.Errorf(\"templates not initialized: call InitTemplates() first\")\n")
-	write(b, "\t}\n")
-	write(b, "\ttmpl, ok := templates[%s]\n", fieldRef)
-	write(b, "\tif !ok {\n")
-	write(b, "\t\treturn fmt.Errorf(\"template %%q not found\", %s)\n", fieldRef)
+	if renderer {
+		write(b, "// %s renders the %s template%s\n", f.name, t.name, f.doc)
+		write(b, "func %s(%s) %s {\n", f.name, f.params, results)
+		write(b, "\tr, err := initializedRenderer()\n")
+		write(b, "\tif err != nil {\n")
+		write(b, "\t\treturn %serr\n", f.zero)
+		write(b, "\t}\n")
+		write(b, "\treturn r.%s(%s)\n", f.name, f.args)
+		write(b, "}\n\n")
+
+		write(b, "// %s renders the %s template with r%s\n", f.name, t.name, f.doc)
+		write(b, "func (r *Renderer) %s(%s) %s {\n", f.name, f.params, results)
+		write(b, "\ttmpl, err := r.lookup(%s)\n", fieldRef)
+		write(b, "\tif err != nil {\n")
+		write(b, "\t\treturn %serr\n", f.zero)
+		write(b, "\t}\n")
+		write(b, "\treturn %s\n", f.call)
+		write(b, "}\n\n")
+		return
+	}
+
+	write(b, "// %s renders the %s template%s\n", f.name, t.name, f.doc)
+	write(b, "func %s(%s) %s {\n", f.name, f.params, results)
+	write(b, "\ttmpl, err := lookupTemplate(%s)\n", fieldRef)
+	write(b, "\tif err != nil {\n")
+	write(b, "\t\treturn %serr\n", f.zero)
 	write(b, "\t}\n")
-	write(b, "\treturn tmpl.Execute(w, p)\n")
+	write(b, "\treturn %s\n", f.call)
 	write(b, "}\n\n")
 }
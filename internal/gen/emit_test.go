@@ -1,14 +1,17 @@
 package gen_test
 
 import (
+	"fmt"
 	"go/ast"
 	"go/parser"
 	"go/token"
+	"maps"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/bellwood4486/tmpltype/internal/gen"
@@ -247,37 +250,27 @@ func TestEmit_Golden_Simple(t *testing.T) {
 	}
 }
 
-func TestEmit_CompilesInTempModule(t *testing.T) {
-	if runtime.GOOS == "js" || runtime.GOOS == "wasip1" {
-		t.Skip("skip on restricted platforms")
-	}
+var compilesCase = addRunCase(runCase{
+	name:  "compiles",
+	specs: []gen.TemplateSpec{{Name: "tpl", Pkg: "main", FilePath: "tpl.tmpl", Source: "Hello {{ .Message }}"}},
+	main: `package main
 
-	u := gen.TemplateSpec{Name: "tpl", Pkg: "x", FilePath: "tpl.tmpl", Source: "Hello {{ .Message }}"}
-	result, err := gen.Emit([]gen.TemplateSpec{u})
-	if err != nil {
-		t.Fatalf("Emit failed: %v", err)
-	}
+import "os"
 
-	dir := t.TempDir()
-	// Create module
-	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/tmpmod\n\ngo 1.25\n"), 0644); err != nil {
-		t.Fatal(err)
-	}
-	// Write generated code (2 files now)
-	if err := os.WriteFile(filepath.Join(dir, "gen.go"), []byte(result.MainCode), 0644); err != nil {
-		t.Fatal(err)
+func main() {
+	if err := InitTemplates(); err != nil {
+		panic(err)
 	}
-	if err := os.WriteFile(filepath.Join(dir, "gen_sources_gen.go"), []byte(result.SourcesCode), 0644); err != nil {
-		t.Fatal(err)
+	if err := RenderTpl(os.Stdout, Tpl{Message: "world"}); err != nil {
+		panic(err)
 	}
+}
+`,
+})
 
-	cmd := exec.Command("go", "build", "./...")
-	cmd.Dir = dir
-	// Ensure build cache is writable within sandbox
-	cmd.Env = append(os.Environ(), "GOCACHE="+filepath.Join(dir, ".gocache"))
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		t.Fatalf("go build failed: %v\n%s", err, string(out))
+func TestEmit_CompilesInTempModule(t *testing.T) {
+	if out := compilesCase.run(t); out != "Hello world" {
+		t.Fatalf("output = %q; want %q", out, "Hello world")
 	}
 }
 
@@ -422,3 +415,1587 @@ func TestEmit_TemplateWithBacktick(t *testing.T) {
 	parseCode(t, result.SourcesCode)
 }
 
+
+func TestEmit_HTMLTemplate(t *testing.T) {
+	u := gen.TemplateSpec{
+		Name:     "page",
+		Pkg:      "x",
+		FilePath: "page.html.tmpl",
+		Source:   "<a href=\"{{ .URL }}\">{{ .Title }}</a>",
+		HTML:     true,
+	}
+
+	result, err := gen.Emit([]gen.TemplateSpec{u})
+	if err != nil {
+		t.Fatalf("Emit failed: %v", err)
+	}
+
+	f := parseCode(t, result.MainCode)
+	if !hasImport(f, "html/template", "") {
+		t.Fatalf("html/template import not found\n%s", result.MainCode)
+	}
+	if hasImport(f, "text/template", "") {
+		t.Fatalf("text/template should not be imported in html mode\n%s", result.MainCode)
+	}
+
+	// WithFuncs は html/template の FuncMap を受け取る
+	withFuncs := findFunc(f, "WithFuncs")
+	if withFuncs == nil {
+		t.Fatal("WithFuncs not found")
+	}
+	if se, ok := withFuncs.Type.Params.List[0].Type.(*ast.SelectorExpr); !ok || se.Sel.Name != "FuncMap" {
+		t.Fatalf("WithFuncs param not template.FuncMap")
+	}
+}
+
+func TestEmit_MixedHTMLAndTextTemplates(t *testing.T) {
+	specs := []gen.TemplateSpec{
+		{Name: "page", Pkg: "x", FilePath: "page.html.tmpl", Source: "{{ .Title }}", HTML: true},
+		{Name: "mail", Pkg: "x", FilePath: "mail.tmpl", Source: "{{ .Body }}"},
+	}
+
+	_, err := gen.Emit(specs)
+	if err == nil {
+		t.Fatal("expected error when mixing html and text templates")
+	}
+	if !strings.Contains(err.Error(), "cannot mix html and text templates") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// runCase は生成コードを一時モジュールで実行するテストケース
+// 登録されたケースは1つのモジュールにまとめ、最初に使われたときに一度だけ生成・ビルドする
+type runCase struct {
+	name  string // パッケージのディレクトリ名（実行ファイル名にもなる）
+	specs []gen.TemplateSpec
+	opts  []gen.Option
+	main  string            // main.go の内容
+	files map[string]string // パッケージのディレクトリに置くファイル（テンプレートなど）
+
+	result *gen.EmitResult
+	err    error
+}
+
+var (
+	runCases  []*runCase
+	runRoot   string // TestMain が作成する example.com/tmpmod モジュールのディレクトリ
+	emitOnce  sync.Once
+	emitErr   error
+	buildOnce sync.Once
+	buildErr  error
+)
+
+// addRunCase はケースを登録する。パッケージ変数の初期化から呼び出す
+func addRunCase(c runCase) *runCase {
+	runCases = append(runCases, &c)
+	return &c
+}
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "tmpltype-gen-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	runRoot = dir
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// emitRunCases は全てのケースのコードを生成してモジュールに書き出す
+// models と views のパッケージも同じモジュールに置き、@import や FuncMap から参照できるようにする
+func emitRunCases() error {
+	if err := writeFiles(runRoot, map[string]string{
+		"go.mod":           "module example.com/tmpmod\n\ngo 1.25\n",
+		"models/models.go": modelsSrc,
+		"views/views.go":   viewsSrc,
+	}); err != nil {
+		return err
+	}
+	for _, c := range runCases {
+		opts := append([]gen.Option{gen.WithPackageDir(runRoot)}, c.opts...)
+		c.result, c.err = gen.Emit(c.specs, opts...)
+		if c.err != nil {
+			continue
+		}
+		files := map[string]string{
+			"gen.go":             c.result.MainCode,
+			"gen_sources_gen.go": c.result.SourcesCode,
+			"main.go":            c.main,
+		}
+		maps.Copy(files, c.files)
+		if err := writeFiles(filepath.Join(runRoot, c.name), files); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildRunCases はモジュール内の全てのケースを1回の go build でビルドする
+func buildRunCases() error {
+	cmd := exec.Command("go", "build", "-o", filepath.Join(runRoot, "bin")+string(filepath.Separator), "./...")
+	cmd.Dir = runRoot
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("go build failed: %v\n%s", err, out)
+	}
+	return nil
+}
+
+// emitted はケースの生成結果を返す
+func (c *runCase) emitted(t *testing.T) *gen.EmitResult {
+	t.Helper()
+	emitOnce.Do(func() { emitErr = emitRunCases() })
+	if emitErr != nil {
+		t.Fatal(emitErr)
+	}
+	if c.err != nil {
+		t.Fatalf("Emit failed: %v", c.err)
+	}
+	return c.result
+}
+
+// run はケースの main パッケージをパッケージのディレクトリで実行し、出力を返す
+func (c *runCase) run(t *testing.T) string {
+	t.Helper()
+	c.emitted(t)
+	if runtime.GOOS == "js" || runtime.GOOS == "wasip1" {
+		t.Skip("skip on restricted platforms")
+	}
+	buildOnce.Do(func() { buildErr = buildRunCases() })
+	if buildErr != nil {
+		t.Fatal(buildErr)
+	}
+
+	bin := filepath.Join(runRoot, "bin", c.name)
+	if runtime.GOOS == "windows" {
+		bin += ".exe"
+	}
+	cmd := exec.Command(bin)
+	cmd.Dir = filepath.Join(runRoot, c.name)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s failed: %v\n%s", c.name, err, out)
+	}
+	return string(out)
+}
+
+// writeFiles は dir の下に files を書き込む
+func writeFiles(dir string, files map[string]string) error {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var templateCallCase = addRunCase(runCase{
+	name: "template_call",
+	specs: []gen.TemplateSpec{
+		{Name: "page", Pkg: "main", FilePath: "page.tmpl", Source: `{{ template "user_card" .Author }} wrote {{ .Title }}`},
+		{Name: "partials", Pkg: "main", FilePath: "partials.tmpl", Source: `{{ define "user_card" }}{{ .Name }} <{{ .Email }}>{{ end }}`},
+	},
+	main: `package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	InitTemplates()
+	if err := RenderPage(os.Stdout, Page{Author: PageAuthor{Name: "Alice", Email: "alice@example.com"}, Title: "Hello"}); err != nil {
+		panic(err)
+	}
+	fmt.Println()
+	if err := RenderUserCard(os.Stdout, UserCard{Name: "Bob", Email: "bob@example.com"}); err != nil {
+		panic(err)
+	}
+}
+`,
+})
+
+func TestEmit_TemplateCallAcrossFiles(t *testing.T) {
+	result := templateCallCase.emitted(t)
+
+	f := parseCode(t, result.MainCode)
+
+	// 呼び出し先のフィールドが呼び出し元の Author にマージされる
+	author := findType(f, "PageAuthor")
+	if author == nil || len(author.Fields.List) != 2 {
+		t.Fatalf("PageAuthor struct unexpected\n%s", result.MainCode)
+	}
+
+	// {{ define }} ごとに型とRender関数が生成される
+	if findType(f, "UserCard") == nil {
+		t.Fatalf("UserCard type not found\n%s", result.MainCode)
+	}
+	if findFunc(f, "RenderUserCard") == nil {
+		t.Fatalf("RenderUserCard not found\n%s", result.MainCode)
+	}
+
+	out := templateCallCase.run(t)
+	want := "Alice <alice@example.com> wrote Hello\nBob <bob@example.com>"
+	if out != want {
+		t.Fatalf("output = %q; want %q", out, want)
+	}
+}
+
+func TestEmit_DefineTypeNameCollision(t *testing.T) {
+	specs := []gen.TemplateSpec{
+		{Name: "header", Pkg: "x", FilePath: "header.tmpl", Source: `{{ .Title }}`},
+		{Name: "layout", Pkg: "x", FilePath: "layout.tmpl", Source: `{{ define "Header" }}{{ .Name }}{{ end }}`},
+	}
+	_, err := gen.Emit(specs)
+	if err == nil || !strings.Contains(err.Error(), "both generate type Header") {
+		t.Fatalf("expected type name collision error, got %v", err)
+	}
+}
+
+func TestEmit_ReservedNameCollision(t *testing.T) {
+	tests := []struct {
+		name     string
+		typeName string
+	}{
+		{"with_reload_from_dir", "WithReloadFromDir"},
+		{"with_funcs", "WithFuncs"},
+		{"templates", "Templates"},
+		{"error", "Error"}, // RenderError と衝突する
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			specs := []gen.TemplateSpec{
+				{Name: tt.name, Pkg: "x", FilePath: tt.name + ".tmpl", Source: `{{ .Title }}`},
+			}
+			_, err := gen.Emit(specs)
+			want := "template \"" + tt.name + "\" generates type " + tt.typeName + ", which conflicts with generated code"
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Fatalf("expected %q, got %v", want, err)
+			}
+		})
+	}
+}
+
+var deepGroupingCase = addRunCase(runCase{
+	name: "deep_grouping",
+	specs: []gen.TemplateSpec{
+		{Name: "footer", Pkg: "main", FilePath: "templates/footer.tmpl", Source: `{{ .Year }}`},
+		{Name: "mail/invite/html", Pkg: "main", FilePath: "templates/mail/invite/html.tmpl", Source: `<a href="{{ .URL }}">{{ .User.Name }}</a>`},
+		{Name: "mail/invite/text", Pkg: "main", FilePath: "templates/mail/invite/text.tmpl", Source: `{{ .URL }}`},
+		{Name: "mail/welcome", Pkg: "main", FilePath: "templates/mail/welcome.tmpl", Source: `Welcome {{ .Name }}`},
+	},
+	main: `package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	InitTemplates()
+	fmt.Println(Template.Mail.Invite.HTML, Template.Mail.Invite.Text, Template.Mail.Welcome, Template.Footer)
+	if err := RenderMailInviteHTML(os.Stdout, MailInviteHTML{URL: "/join", User: MailInviteHTMLUser{Name: "Alice"}}); err != nil {
+		panic(err)
+	}
+}
+`,
+})
+
+func TestEmit_DeepGrouping(t *testing.T) {
+	result := deepGroupingCase.emitted(t)
+
+	f := parseCode(t, result.MainCode)
+	for _, name := range []string{"Footer", "MailInviteHTML", "MailInviteHTMLUser", "MailInviteText", "MailWelcome"} {
+		if findType(f, name) == nil {
+			t.Errorf("type %s not found", name)
+		}
+	}
+	if findFunc(f, "RenderMailInviteHTML") == nil {
+		t.Error("RenderMailInviteHTML not found")
+	}
+
+	out := deepGroupingCase.run(t)
+	want := "mail/invite/html mail/invite/text mail/welcome footer\n<a href=\"/join\">Alice</a>"
+	if out != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestEmit_DeepGrouping_NamespaceCollision(t *testing.T) {
+	specs := []gen.TemplateSpec{
+		{Name: "mail", Pkg: "x", FilePath: "mail.tmpl", Source: `{{ .Title }}`},
+		{Name: "mail/invite", Pkg: "x", FilePath: "mail/invite.tmpl", Source: `{{ .Title }}`},
+	}
+	_, err := gen.Emit(specs)
+	if err == nil || !strings.Contains(err.Error(), "Template.Mail is used by both") {
+		t.Fatalf("expected namespace collision error, got %v", err)
+	}
+}
+
+func TestEmit_DeepGrouping_NestedTypeCollision(t *testing.T) {
+	// mail/invite の .Title 構造体と mail/invite/title テンプレートはどちらも MailInviteTitle になる
+	specs := []gen.TemplateSpec{
+		{Name: "mail/invite", Pkg: "x", FilePath: "mail/invite.tmpl", Source: `{{ .Title.Text }}`},
+		{Name: "mail/invite/title", Pkg: "x", FilePath: "mail/invite/title.tmpl", Source: `{{ .Text }}`},
+	}
+	_, err := gen.Emit(specs)
+	if err == nil || !strings.Contains(err.Error(), "both generate type MailInviteTitle") {
+		t.Fatalf("expected type name collision error, got %v", err)
+	}
+}
+
+var embedFiles = map[string]string{
+	"templates/page.tmpl":         "Hello `{{ .Name }}`",
+	"templates/mail/invite.tmpl":  `{{ template "sig" .Sender }}`,
+	"templates/partials/sig.tmpl": `{{ define "sig" }}-- {{ .Name }}{{ end }}`,
+}
+
+var embedCase = addRunCase(runCase{
+	name: "embed",
+	specs: []gen.TemplateSpec{
+		{Name: "page", Pkg: "main", FilePath: "templates/page.tmpl", Source: embedFiles["templates/page.tmpl"]},
+		{Name: "mail/invite", Pkg: "main", FilePath: "templates/mail/invite.tmpl", Source: embedFiles["templates/mail/invite.tmpl"]},
+		{Name: "partials/sig", Pkg: "main", FilePath: "templates/partials/sig.tmpl", Source: embedFiles["templates/partials/sig.tmpl"]},
+	},
+	opts: []gen.Option{gen.WithEmbed()},
+	main: `package main
+
+import (
+	"os"
+)
+
+func main() {
+	InitTemplates()
+	if err := RenderPage(os.Stdout, Page{Name: "Alice"}); err != nil {
+		panic(err)
+	}
+	if err := RenderMailInvite(os.Stdout, MailInvite{Sender: MailInviteSender{Name: "Bob"}}); err != nil {
+		panic(err)
+	}
+}
+`,
+	files: embedFiles,
+})
+
+func TestEmit_Embed(t *testing.T) {
+	result := embedCase.emitted(t)
+
+	// バッククォートを含んでいても go:embed なら警告は出ない
+	if len(result.Warnings) != 0 {
+		t.Errorf("unexpected warnings: %v", result.Warnings)
+	}
+	if !strings.Contains(result.SourcesCode, "//go:embed templates/page.tmpl\n") {
+		t.Errorf("go:embed directive not found:\n%s", result.SourcesCode)
+	}
+	if strings.Contains(result.SourcesCode, "Hello") {
+		t.Errorf("template body should not be copied into the sources file:\n%s", result.SourcesCode)
+	}
+	f := parseCode(t, result.SourcesCode)
+	if !hasImport(f, "embed", "") {
+		t.Error("embed import not found")
+	}
+
+	out := embedCase.run(t)
+	if want := "Hello `Alice`-- Bob"; out != want {
+		t.Fatalf("unexpected output: %q, want %q", out, want)
+	}
+}
+
+func TestEmit_Embed_OutsidePackageDir(t *testing.T) {
+	specs := []gen.TemplateSpec{
+		{Name: "page", Pkg: "x", FilePath: "../templates/page.tmpl", Source: `{{ .Title }}`},
+	}
+	_, err := gen.Emit(specs, gen.WithEmbed())
+	if err == nil || !strings.Contains(err.Error(), "outside the output package directory") {
+		t.Fatalf("expected error for template outside the package directory, got %v", err)
+	}
+}
+
+var reloadCase = addRunCase(runCase{
+	name: "reload",
+	specs: []gen.TemplateSpec{
+		{Name: "page", Pkg: "main", FilePath: "templates/page.tmpl", Source: `Hello {{ .Name }}{{ template "sig" .Sender }}`},
+		{Name: "partials", Pkg: "main", FilePath: "templates/partials.tmpl", Source: `{{ define "sig" }} -- {{ .Name }}{{ end }}`},
+	},
+	main: `package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+func main() {
+	InitTemplates(WithReloadFromDir("."))
+	p := Page{Name: "Alice", Sender: PageSender{Name: "Bob"}}
+	if err := RenderPage(os.Stdout, p); err != nil {
+		panic(err)
+	}
+	fmt.Println()
+
+	// 更新されたファイルは次のレンダリングで読み直される
+	if err := os.WriteFile("templates/partials.tmpl", []byte(` + "`" + `{{ define "sig" }} ~ {{ .Name }}{{ end }}` + "`" + `), 0644); err != nil {
+		panic(err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes("templates/partials.tmpl", future, future); err != nil {
+		panic(err)
+	}
+	if err := RenderPage(os.Stdout, p); err != nil {
+		panic(err)
+	}
+	fmt.Println()
+
+	// パースエラーはRender関数のエラーとして返る
+	if err := os.WriteFile("templates/page.tmpl", []byte("{{ .Name "), 0644); err != nil {
+		panic(err)
+	}
+	if err := os.Chtimes("templates/page.tmpl", future, future.Add(time.Second)); err != nil {
+		panic(err)
+	}
+	if err := RenderPage(os.Stdout, p); err == nil {
+		panic("expected parse error")
+	}
+	fmt.Print("ok")
+}
+`,
+	// ディスク上のファイルは生成時のソースと異なる内容にしておき、ディスクから読まれていることを確認する
+	files: map[string]string{
+		"templates/page.tmpl":     `Hi {{ .Name }}{{ template "sig" .Sender }}`,
+		"templates/partials.tmpl": `{{ define "sig" }} / {{ .Name }}{{ end }}`,
+	},
+})
+
+func TestEmit_ReloadFromDir(t *testing.T) {
+	out := reloadCase.run(t)
+	if want := "Hi Alice / Bob\nHi Alice ~ Bob\nok"; out != want {
+		t.Fatalf("unexpected output: %q, want %q", out, want)
+	}
+}
+
+var rendererReloadCase = addRunCase(runCase{
+	name: "renderer_reload",
+	specs: []gen.TemplateSpec{
+		{Name: "page", Pkg: "main", FilePath: "templates/page.tmpl", Source: `Hello {{ .Name }}`},
+	},
+	opts: []gen.Option{gen.WithRenderer()},
+	// Templates() は Render で読み直した最新のテンプレートを返す
+	main: `package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/template"
+	"time"
+)
+
+func main() {
+	if err := InitTemplates(WithReloadFromDir(".")); err != nil {
+		panic(err)
+	}
+	r, err := NewRenderer(WithReloadFromDir("."))
+	if err != nil {
+		panic(err)
+	}
+	p := Page{Name: "Alice"}
+	print := func() {
+		for _, tmpls := range []map[TemplateName]*template.Template{r.Templates(), Templates()} {
+			if err := tmpls[Template.Page].Execute(os.Stdout, p); err != nil {
+				panic(err)
+			}
+			fmt.Print("|")
+		}
+	}
+	render := func() {
+		if err := r.RenderPage(io.Discard, p); err != nil {
+			panic(err)
+		}
+		if err := RenderPage(io.Discard, p); err != nil {
+			panic(err)
+		}
+	}
+
+	print()
+	render()
+	print()
+
+	if err := os.WriteFile("templates/page.tmpl", []byte("Hey {{ .Name }}"), 0644); err != nil {
+		panic(err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes("templates/page.tmpl", future, future); err != nil {
+		panic(err)
+	}
+	render()
+	print()
+}
+`,
+	files: map[string]string{
+		"templates/page.tmpl": `Hi {{ .Name }}`,
+	},
+})
+
+func TestEmit_RendererReloadTemplates(t *testing.T) {
+	out := rendererReloadCase.run(t)
+	if want := "Hello Alice|Hello Alice|Hi Alice|Hi Alice|Hey Alice|Hey Alice|"; out != want {
+		t.Fatalf("output = %q, want %q", out, want)
+	}
+}
+
+func TestEmit_ParamTypeMismatch(t *testing.T) {
+	specs := []gen.TemplateSpec{
+		{Name: "profile", Pkg: "x", FilePath: "profile.tmpl", Source: "{{/* @param User.Age int */}}\n{{ with .User.Age }}{{ .Years }}{{ end }}"},
+	}
+	_, err := gen.Emit(specs)
+	if err == nil {
+		t.Fatal("expected error for @param type mismatch")
+	}
+	// テンプレートのファイルとディレクティブの位置が含まれる
+	if want := "profile.tmpl:1:1: error: @param User.Age int"; !strings.Contains(err.Error(), want) {
+		t.Fatalf("error = %v, want it to contain %q", err, want)
+	}
+}
+
+func TestEmit_SpecParams(t *testing.T) {
+	specs := []gen.TemplateSpec{
+		{
+			Name:     "profile",
+			Pkg:      "x",
+			FilePath: "profile.tmpl",
+			Source:   "{{/* @param User.Age int64 */}}\n{{ .User.Name }} {{ .User.Age }} {{ .CreatedAt }}",
+			// テンプレート内の @param が優先され、使われていない Score は無視される
+			Params: map[string]string{"CreatedAt": "time.Time", "User.Age": "int", "Score": "float64"},
+		},
+	}
+	result, err := gen.Emit(specs)
+	if err != nil {
+		t.Fatalf("Emit failed: %v", err)
+	}
+
+	for _, want := range []string{"CreatedAt time.Time", "Age  int64", `"time"`} {
+		if !strings.Contains(result.MainCode, want) {
+			t.Errorf("generated code should contain %q:\n%s", want, result.MainCode)
+		}
+	}
+	if strings.Contains(result.MainCode, "Score") {
+		t.Errorf("unused param should be ignored:\n%s", result.MainCode)
+	}
+}
+
+func TestEmit_SpecParams_TypeMismatch(t *testing.T) {
+	specs := []gen.TemplateSpec{
+		{Name: "list", Pkg: "x", FilePath: "list.tmpl", Source: "{{ range .Items }}{{ . }}{{ end }}", Params: map[string]string{"Items": "string"}},
+	}
+	_, err := gen.Emit(specs)
+	if err == nil || !strings.Contains(err.Error(), "list.tmpl: error: @param Items string") {
+		t.Fatalf("expected param type error, got %v", err)
+	}
+}
+
+var sharedTypesCase = addRunCase(runCase{
+	name: "shared_types",
+	specs: []gen.TemplateSpec{
+		{Name: "email", Pkg: "main", FilePath: "email.tmpl", Source: `{{ .User.Name }} <{{ .User.Email }}> {{ .User.Address.City }}`},
+		{Name: "header", Pkg: "main", FilePath: "header.tmpl", Source: `{{ .User.Email }} {{ .User.Name }} {{ .User.Address.City }}`},
+		// Items は構造が異なるため共有されない
+		{Name: "footer", Pkg: "main", FilePath: "footer.tmpl", Source: `{{ range .Items }}{{ .Title }}{{ end }}`},
+		{Name: "sidebar", Pkg: "main", FilePath: "sidebar.tmpl", Source: `{{ range .Items }}{{ .URL }}{{ end }}`},
+	},
+	opts: []gen.Option{gen.WithSharedTypes()},
+	// 同じ値を両方のテンプレートに渡せる
+	main: `package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	InitTemplates()
+	u := User{Name: "Alice", Email: "alice@example.com", Address: Address{City: "Tokyo"}}
+	if err := RenderEmail(os.Stdout, Email{User: u}); err != nil {
+		panic(err)
+	}
+	fmt.Println()
+	if err := RenderHeader(os.Stdout, Header{User: u}); err != nil {
+		panic(err)
+	}
+}
+`,
+})
+
+func TestEmit_SharedTypes(t *testing.T) {
+	// デフォルトではテンプレートごとに型が生成される
+	result, err := gen.Emit(sharedTypesCase.specs)
+	if err != nil {
+		t.Fatalf("Emit failed: %v", err)
+	}
+	f := parseCode(t, result.MainCode)
+	if findType(f, "EmailUser") == nil || findType(f, "HeaderUser") == nil {
+		t.Fatalf("per-template types not found\n%s", result.MainCode)
+	}
+
+	result = sharedTypesCase.emitted(t)
+	f = parseCode(t, result.MainCode)
+	for _, name := range []string{"User", "Address", "FooterItemsItem", "SidebarItemsItem"} {
+		if findType(f, name) == nil {
+			t.Errorf("type %s not found", name)
+		}
+	}
+	for _, name := range []string{"EmailUser", "HeaderUser", "EmailAddress", "ItemsItem"} {
+		if findType(f, name) != nil {
+			t.Errorf("type %s should not be generated", name)
+		}
+	}
+	if !strings.Contains(result.MainCode, "// User is shared by the email and header templates") {
+		t.Errorf("shared type comment not found\n%s", result.MainCode)
+	}
+
+	out := sharedTypesCase.run(t)
+	if want := "Alice <alice@example.com> Tokyo\nalice@example.com Alice Tokyo"; out != want {
+		t.Fatalf("output = %q; want %q", out, want)
+	}
+}
+
+func TestEmit_SharedTypes_NameTaken(t *testing.T) {
+	// テンプレートの型名と同じ名前の型は共有しない
+	specs := []gen.TemplateSpec{
+		{Name: "user", Pkg: "x", FilePath: "user.tmpl", Source: `{{ .Name }}`},
+		{Name: "email", Pkg: "x", FilePath: "email.tmpl", Source: `{{ .User.Name }}`},
+		{Name: "header", Pkg: "x", FilePath: "header.tmpl", Source: `{{ .User.Name }}`},
+	}
+	result, err := gen.Emit(specs, gen.WithSharedTypes())
+	if err != nil {
+		t.Fatalf("Emit failed: %v", err)
+	}
+	f := parseCode(t, result.MainCode)
+	if findType(f, "EmailUser") == nil || findType(f, "HeaderUser") == nil {
+		t.Fatalf("per-template types not found\n%s", result.MainCode)
+	}
+}
+
+var typeDeclCase = addRunCase(runCase{
+	name: "type_decl",
+	specs: []gen.TemplateSpec{
+		{Name: "types", Pkg: "main", FilePath: "types.tmpl", Source: `{{/* @type User struct{Name string; Email string; Joined time.Time} */}}`},
+		// 宣言と同じ名前の User は宣言された型になる
+		{Name: "email", Pkg: "main", FilePath: "email.tmpl", Source: `{{ .User.Name }} <{{ .User.Email }}>`},
+		// @param で宣言された型を参照できる
+		{Name: "post", Pkg: "main", FilePath: "post.tmpl", Source: `{{/* @param Author *User */}}{{/* @param Readers []User */}}{{ .Author.Name }}{{ range .Readers }} {{ .Name }}{{ end }}`},
+	},
+	main: `package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	InitTemplates()
+	alice := User{Name: "Alice", Email: "alice@example.com"}
+	if err := RenderEmail(os.Stdout, Email{User: alice}); err != nil {
+		panic(err)
+	}
+	fmt.Println()
+	if err := RenderPost(os.Stdout, Post{Author: &alice, Readers: []User{{Name: "Bob"}, {Name: "Carol"}}}); err != nil {
+		panic(err)
+	}
+}
+`,
+})
+
+func TestEmit_TypeDecl(t *testing.T) {
+	result := typeDeclCase.emitted(t)
+	if !strings.Contains(result.MainCode, "// User is declared with @type in types.tmpl") {
+		t.Errorf("declared type not found\n%s", result.MainCode)
+	}
+	f := parseCode(t, result.MainCode)
+	if findType(f, "EmailUser") != nil {
+		t.Errorf("EmailUser should not be generated\n%s", result.MainCode)
+	}
+	if !hasImport(f, "time", "") {
+		t.Errorf("time import not found\n%s", result.MainCode)
+	}
+
+	out := typeDeclCase.run(t)
+	if want := "Alice <alice@example.com>\nAlice Bob Carol"; out != want {
+		t.Fatalf("output = %q; want %q", out, want)
+	}
+}
+
+func TestEmit_TypeDecl_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		specs []gen.TemplateSpec
+		want  string
+	}{
+		{
+			name: "field not declared",
+			specs: []gen.TemplateSpec{
+				{Name: "email", Pkg: "x", FilePath: "email.tmpl", Source: "{{/* @type User struct{Name string} */}}\n{{ .User.Phone }}"},
+			},
+			want: "email.tmpl: error: User does not match @type User struct{Name string}: User.Phone is used, but struct{Name string} has no field Phone",
+		},
+		{
+			name: "param field not declared",
+			specs: []gen.TemplateSpec{
+				{Name: "types", Pkg: "x", FilePath: "types.tmpl", Source: "{{/* @type User struct{Name string} */}}"},
+				{Name: "post", Pkg: "x", FilePath: "post.tmpl", Source: "{{/* @param Author User */}}\n{{ .Author.Phone }}"},
+			},
+			want: "post.tmpl:1:1: error: @param Author User: Author.Phone is used, but struct{Name string} has no field Phone",
+		},
+		{
+			name: "conflicting declarations",
+			specs: []gen.TemplateSpec{
+				{Name: "a", Pkg: "x", FilePath: "a.tmpl", Source: "{{/* @type User struct{Name string} */}}"},
+				{Name: "b", Pkg: "x", FilePath: "b.tmpl", Source: "\n{{/* @type User struct{ID int} */}}"},
+			},
+			want: "b.tmpl:2:1: error: @type User is already declared as struct{Name string} in a.tmpl:1",
+		},
+		{
+			name: "conflicts with template type",
+			specs: []gen.TemplateSpec{
+				{Name: "user", Pkg: "x", FilePath: "user.tmpl", Source: "{{/* @type User struct{Name string} */}}"},
+			},
+			want: `user.tmpl:1:1: error: @type User conflicts with type User generated for template "user"`,
+		},
+		{
+			name: "invalid type expression",
+			specs: []gen.TemplateSpec{
+				{Name: "a", Pkg: "x", FilePath: "a.tmpl", Source: "{{/* @type User [] */}}"},
+			},
+			want: `a.tmpl:1:1: error: invalid type expression "[]"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := gen.Emit(tt.specs)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// modelsSrc は @import のテストで使うパッケージ
+const modelsSrc = `package models
+
+type User struct {
+	Name  string
+	Email string
+	Tags  []Tag
+	age   int
+}
+
+type Tag struct {
+	Label string
+}
+
+func (u User) Display() string { return u.Name + " <" + u.Email + ">" }
+
+type Invoice struct {
+	Number   string
+	Customer User
+	Lines    []Line
+}
+
+type Line struct {
+	Item   string
+	Amount int
+}
+
+func (i *Invoice) Total() int {
+	total := 0
+	for _, l := range i.Lines {
+		total += l.Amount
+	}
+	return total
+}
+`
+
+// writeModelsModule は models パッケージを持つ example.com/tmpmod モジュールを作成し、そのディレクトリを返す
+func writeModelsModule(t *testing.T) string {
+	t.Helper()
+	return writeModule(t, map[string]string{"models/models.go": modelsSrc})
+}
+
+// writeModule は example.com/tmpmod モジュールのディレクトリを作成し、files を書き込む
+func writeModule(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	files = maps.Clone(files)
+	files["go.mod"] = "module example.com/tmpmod\n\ngo 1.25\n"
+	if err := writeFiles(dir, files); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+var importModelsCase = addRunCase(runCase{
+	name: "import_models",
+	specs: []gen.TemplateSpec{
+		{Name: "profile", Pkg: "main", FilePath: "profile.tmpl", Source: `{{/* @import example.com/tmpmod/models */}}
+{{- /* @param User *models.User */ -}}
+{{ .User.Display }}{{ range .User.Tags }} #{{ .Label }}{{ end }}`},
+	},
+	main: `package main
+
+import (
+	"os"
+
+	"example.com/tmpmod/models"
+)
+
+func main() {
+	InitTemplates()
+	u := &models.User{Name: "Alice", Email: "alice@example.com", Tags: []models.Tag{{Label: "admin"}}}
+	if err := RenderProfile(os.Stdout, Profile{User: u}); err != nil {
+		panic(err)
+	}
+}
+`,
+})
+
+func TestEmit_Import(t *testing.T) {
+	result := importModelsCase.emitted(t)
+	if !strings.Contains(result.MainCode, `"example.com/tmpmod/models"`) {
+		t.Fatalf("models package is not imported:\n%s", result.MainCode)
+	}
+	if !strings.Contains(result.MainCode, "User *models.User") {
+		t.Fatalf("User field does not use models.User:\n%s", result.MainCode)
+	}
+
+	out := importModelsCase.run(t)
+	if want := "Alice <alice@example.com> #admin"; out != want {
+		t.Fatalf("output = %q, want %q", out, want)
+	}
+}
+
+func TestEmit_Import_Renamed(t *testing.T) {
+	dir := writeModelsModule(t)
+	specs := []gen.TemplateSpec{
+		{Name: "profile", Pkg: "x", FilePath: "profile.tmpl", Source: "{{/* @param Users []m.User */}}{{ range .Users }}{{ .Name }}{{ end }}"},
+		{Name: "footer", Pkg: "x", FilePath: "footer.tmpl", Source: "{{ .Year }}"},
+	}
+	result, err := gen.Emit(specs, gen.WithPackageDir(dir), gen.WithImport("m", "example.com/tmpmod/models"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(result.MainCode, `m "example.com/tmpmod/models"`) {
+		t.Fatalf("models package is not imported as m:\n%s", result.MainCode)
+	}
+	if !strings.Contains(result.MainCode, "Users []m.User") {
+		t.Fatalf("Users field does not use m.User:\n%s", result.MainCode)
+	}
+}
+
+func TestEmit_Import_Errors(t *testing.T) {
+	dir := writeModelsModule(t)
+	const imp = "{{/* @import example.com/tmpmod/models */}}\n"
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{
+			name:   "missing import",
+			source: "{{/* @param User models.User */}}{{ .User.Name }}",
+			want:   "a.tmpl:1:1: error: @param User models.User: unknown package models in models.User; declare it with @import",
+		},
+		{
+			name:   "unknown field",
+			source: imp + "{{/* @param User models.User */}}{{ .User.Phone }}",
+			want:   "a.tmpl:2:1: error: @param User models.User: User.Phone is used, but models.User has no exported field or method Phone",
+		},
+		{
+			name:   "unexported field",
+			source: imp + "{{/* @param User models.User */}}{{ .User.age }}",
+			want:   "User.age is used, but models.User has no exported field or method age",
+		},
+		{
+			name:   "nested field",
+			source: imp + "{{/* @param User models.User */}}{{ range .User.Tags }}{{ .Name }}{{ end }}",
+			want:   "User.Tags.Name is used, but models.Tag has no exported field or method Name",
+		},
+		{
+			name:   "range over struct",
+			source: imp + "{{/* @param User models.User */}}{{ range .User }}{{ end }}",
+			want:   "User is used with range, but models.User cannot be ranged over",
+		},
+		{
+			name:   "unknown type",
+			source: imp + "{{/* @param User models.Account */}}{{ .User.Name }}",
+			want:   "a.tmpl:2:1: error: @param User models.Account: Account is not an exported type of package example.com/tmpmod/models",
+		},
+		{
+			name:   "package not found",
+			source: "{{/* @import example.com/tmpmod/missing */}}",
+			want:   `a.tmpl:1:1: error: cannot load package "example.com/tmpmod/missing"`,
+		},
+		{
+			name:   "conflicts with generated import",
+			source: "{{/* @import fmt example.com/tmpmod/models */}}",
+			want:   "a.tmpl:1:1: error: package name fmt conflicts with an import of the generated code",
+		},
+		{
+			name:   "type declaration",
+			source: "{{/* @type Author models.User */}}",
+			want:   "a.tmpl:1:1: error: @type Author models.User: unknown package models",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			specs := []gen.TemplateSpec{{Name: "a", Pkg: "x", FilePath: "a.tmpl", Source: tt.source}}
+			_, err := gen.Emit(specs, gen.WithPackageDir(dir))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+var modelCase = addRunCase(runCase{
+	name: "model",
+	specs: []gen.TemplateSpec{
+		{Name: "invoice", Pkg: "main", FilePath: "invoice.tmpl", Source: `{{/* @model *example.com/tmpmod/models.Invoice */}}
+{{- .Number }} for {{ .Customer.Display }}:{{ range .Lines }} {{ .Item }}={{ .Amount }}{{ end }} total={{ .Total }}`},
+		{Name: "footer", Pkg: "main", FilePath: "footer.tmpl", Source: `{{ .Year }}`},
+	},
+	main: `package main
+
+import (
+	"os"
+
+	"example.com/tmpmod/models"
+)
+
+func main() {
+	InitTemplates()
+	inv := &models.Invoice{
+		Number:   "INV-1",
+		Customer: models.User{Name: "Alice", Email: "alice@example.com"},
+		Lines:    []models.Line{{Item: "pen", Amount: 3}, {Item: "ink", Amount: 4}},
+	}
+	if err := RenderInvoice(os.Stdout, inv); err != nil {
+		panic(err)
+	}
+}
+`,
+})
+
+func TestEmit_Model(t *testing.T) {
+	result := modelCase.emitted(t)
+	if !strings.Contains(result.MainCode, "func RenderInvoice(w io.Writer, p *models.Invoice) error") {
+		t.Fatalf("RenderInvoice does not take *models.Invoice:\n%s", result.MainCode)
+	}
+	if strings.Contains(result.MainCode, "type Invoice struct") {
+		t.Fatalf("no type should be generated for a @model template:\n%s", result.MainCode)
+	}
+
+	out := modelCase.run(t)
+	if want := "INV-1 for Alice <alice@example.com>: pen=3 ink=4 total=7"; out != want {
+		t.Fatalf("output = %q, want %q", out, want)
+	}
+}
+
+func TestEmit_Model_Errors(t *testing.T) {
+	dir := writeModelsModule(t)
+	const model = "{{/* @model example.com/tmpmod/models.Invoice */}}\n"
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{
+			name:   "unknown field",
+			source: model + "{{ .Customer.Phone }}",
+			want:   "a.tmpl:1:1: error: @model example.com/tmpmod/models.Invoice: Customer.Phone is used, but models.User has no exported field or method Phone",
+		},
+		{
+			name:   "unknown element field",
+			source: model + "{{ range .Lines }}{{ .Price }}{{ end }}",
+			want:   "a.tmpl:1:1: error: @model example.com/tmpmod/models.Invoice: Lines.Price is used, but models.Line has no exported field or method Price",
+		},
+		{
+			name:   "unknown type",
+			source: "{{/* @model example.com/tmpmod/models.Receipt */}}",
+			want:   "a.tmpl:1:1: error: Receipt is not an exported type of package example.com/tmpmod/models",
+		},
+		{
+			name:   "package not found",
+			source: "{{/* @model example.com/tmpmod/billing.Invoice */}}",
+			want:   `a.tmpl:1:1: error: cannot load package "example.com/tmpmod/billing"`,
+		},
+		{
+			name:   "with @param",
+			source: model + "{{/* @param Number int */}}",
+			want:   "a.tmpl:2:1: error: @param cannot be used with @model example.com/tmpmod/models.Invoice",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			specs := []gen.TemplateSpec{{Name: "a", Pkg: "x", FilePath: "a.tmpl", Source: tt.source}}
+			_, err := gen.Emit(specs, gen.WithPackageDir(dir))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmit_Model_ImportedName(t *testing.T) {
+	dir := writeModelsModule(t)
+	specs := []gen.TemplateSpec{
+		{Name: "invoice", Pkg: "x", FilePath: "invoice.tmpl", Source: "{{/* @import m example.com/tmpmod/models */}}{{/* @model example.com/tmpmod/models.Invoice */}}{{ .Number }}"},
+	}
+	result, err := gen.Emit(specs, gen.WithPackageDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(result.MainCode, `m "example.com/tmpmod/models"`) || !strings.Contains(result.MainCode, "p m.Invoice") {
+		t.Fatalf("@model does not use the name given by @import:\n%s", result.MainCode)
+	}
+}
+
+const viewsSrc = `package views
+
+import (
+	"strings"
+	"text/template"
+	"time"
+)
+
+func Funcs() template.FuncMap {
+	funcs := template.FuncMap{
+		"upper":      strings.ToUpper,
+		"formatDate": func(t time.Time) string { return t.Format("2006-01-02") },
+	}
+	funcs["add"] = func(a, b int) int { return a + b }
+	return funcs
+}
+
+var Extra = template.FuncMap{"repeat": strings.Repeat}
+
+var NotFuncs = map[string]any{}
+`
+
+var funcMapCase = addRunCase(runCase{
+	name: "func_map",
+	specs: []gen.TemplateSpec{
+		{Name: "report", Pkg: "main", FilePath: "report.tmpl", Source: `{{ formatDate .CreatedAt | upper }} {{ add .Price 1 }} {{ .Title | upper }}`},
+	},
+	opts: []gen.Option{gen.WithFuncMap("example.com/tmpmod/views.Funcs")},
+	// 関数の引数の型が推論されていなければコンパイルできない
+	main: `package main
+
+import (
+	"os"
+	"time"
+
+	"example.com/tmpmod/views"
+)
+
+func main() {
+	InitTemplates(WithFuncs(views.Funcs()))
+	p := Report{CreatedAt: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), Price: 41, Title: "sale"}
+	if err := RenderReport(os.Stdout, p); err != nil {
+		panic(err)
+	}
+}
+`,
+})
+
+func TestEmit_FuncMap(t *testing.T) {
+	out := funcMapCase.run(t)
+	if want := "2024-05-01 42 SALE"; out != want {
+		t.Fatalf("output = %q, want %q", out, want)
+	}
+}
+
+func TestEmit_FuncMap_Merged(t *testing.T) {
+	dir := writeModule(t, map[string]string{"views/views.go": viewsSrc})
+	specs := []gen.TemplateSpec{
+		{Name: "report", Pkg: "main", FilePath: "report.tmpl", Source: `{{ repeat .Mark .Count }}{{ add .Count 1 }}`},
+	}
+	result, err := gen.Emit(specs, gen.WithPackageDir(dir),
+		gen.WithFuncMap("example.com/tmpmod/views.Funcs"), gen.WithFuncMap("example.com/tmpmod/views.Extra"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Mark  string", "Count int"} {
+		if !strings.Contains(result.MainCode, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, result.MainCode)
+		}
+	}
+}
+
+func TestEmit_FuncMap_Errors(t *testing.T) {
+	dir := writeModule(t, map[string]string{"views/views.go": viewsSrc})
+	tests := []struct {
+		name    string
+		funcMap string
+		source  string
+		want    string
+	}{
+		{
+			name:    "wrong number of arguments",
+			funcMap: "example.com/tmpmod/views.Funcs",
+			source:  "{{ .Title }}\n{{ add .Price }}",
+			want:    "a.tmpl:2:4: error: wrong number of args for add: want 2 got 1",
+		},
+		{
+			name:    "wrong argument type",
+			funcMap: "example.com/tmpmod/views.Funcs",
+			source:  "{{/* @param CreatedAt string */}}{{ formatDate .CreatedAt }}",
+			want:    "a.tmpl:1:37: error: wrong type for argument 1 of formatDate: expected time.Time; got .CreatedAt of type string",
+		},
+		{
+			name:    "invalid reference",
+			funcMap: "example.com/tmpmod/views",
+			source:  "{{ .Title }}",
+			want:    `error: invalid function map "example.com/tmpmod/views": expected <import path>.<name>`,
+		},
+		{
+			name:    "undeclared name",
+			funcMap: "example.com/tmpmod/views.Missing",
+			source:  "{{ .Title }}",
+			want:    "error: Missing is not declared in package example.com/tmpmod/views",
+		},
+		{
+			name:    "not a FuncMap",
+			funcMap: "example.com/tmpmod/views.NotFuncs",
+			source:  "{{ .Title }}",
+			want:    "error: example.com/tmpmod/views.NotFuncs must be a function returning template.FuncMap or a variable of type template.FuncMap",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			specs := []gen.TemplateSpec{{Name: "a", Pkg: "main", FilePath: "a.tmpl", Source: tt.source}}
+			_, err := gen.Emit(specs, gen.WithPackageDir(dir), gen.WithFuncMap(tt.funcMap))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+var requiredFuncsCase = addRunCase(runCase{
+	name: "required_funcs",
+	specs: []gen.TemplateSpec{
+		{Name: "page", Pkg: "main", FilePath: "page.tmpl", Source: `{{ .Title | upper }}{{ define "note" }}{{ shout .Body }}{{ end }}`},
+		{Name: "mail", Pkg: "main", FilePath: "mail.tmpl", Source: `{{ upper .Subject }}{{ template "note" . }}`},
+	},
+	// define の中の関数は定義元のテンプレートが必要とする
+	main: `package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+func main() {
+	fmt.Println(InitTemplates())
+	fmt.Println(InitTemplates(WithFuncs(template.FuncMap{"upper": strings.ToUpper})))
+	funcs := template.FuncMap{"upper": strings.ToUpper, "shout": func(s string) string { return s + "!" }}
+	if err := InitTemplates(WithFuncs(funcs)); err != nil {
+		panic(err)
+	}
+	if err := RenderMail(os.Stdout, Mail{Subject: "hi", Body: "hello"}); err != nil {
+		panic(err)
+	}
+}
+`,
+})
+
+func TestEmit_RequiredFuncs(t *testing.T) {
+	out := requiredFuncsCase.run(t)
+	want := `missing template functions: shout (used by "page"), upper (used by "mail" "page"); provide them with WithFuncs
+missing template functions: shout (used by "page"); provide them with WithFuncs
+HIhello!`
+	if out != want {
+		t.Fatalf("output = %q, want %q", out, want)
+	}
+}
+
+var initErrorsCase = addRunCase(runCase{
+	name: "init_errors",
+	specs: []gen.TemplateSpec{
+		{Name: "page", Pkg: "main", FilePath: "page.tmpl", Source: `{{ .Title | upper }}`},
+	},
+	// 不正な FuncMap は panic せずにエラーになり、初期化されないので正しいオプションで呼び直せる
+	// 同じ関数での再初期化は何もせず、関数の有無・名前・実体やオプションが異なればエラーになる
+	main: `package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+func shout(s string) string {
+	return strings.ToUpper(s) + "!"
+}
+
+func main() {
+	fmt.Println(InitTemplates(WithFuncs(template.FuncMap{"upper": 1})))
+	funcs := template.FuncMap{"upper": shout}
+	fmt.Println(InitTemplates(WithFuncs(funcs)))
+	fmt.Println(InitTemplates(WithFuncs(funcs)))
+	fmt.Println(InitTemplates(WithFuncs(template.FuncMap{"upper": shout})))
+	fmt.Println(InitTemplates(WithFuncs(template.FuncMap{"upper": strings.ToLower})))
+	fmt.Println(InitTemplates(WithFuncs(template.FuncMap{"upper": shout, "lower": strings.ToLower})))
+	fmt.Println(InitTemplates())
+	fmt.Println(InitTemplates(WithFuncs(funcs), WithReloadFromDir(".")))
+	if err := RenderPage(os.Stdout, Page{Title: "ok"}); err != nil {
+		panic(err)
+	}
+}
+`,
+})
+
+func TestEmit_InitTemplates_Errors(t *testing.T) {
+	out := initErrorsCase.run(t)
+	want := `invalid FuncMap: value for upper not a function
+<nil>
+<nil>
+<nil>
+templates already initialized with different options
+templates already initialized with different options
+missing template functions: upper (used by "page"); provide them with WithFuncs
+templates already initialized with different options
+OK!`
+	if out != want {
+		t.Fatalf("output = %q, want %q", out, want)
+	}
+}
+
+var rendererCase = addRunCase(runCase{
+	name: "renderer",
+	specs: []gen.TemplateSpec{
+		{Name: "greet", Pkg: "main", FilePath: "greet.tmpl", Source: `{{ hello .Name }}{{ define "sign" }}-- {{ .Team }}{{ end }}`},
+	},
+	opts: []gen.Option{gen.WithRenderer()},
+	// 異なる FuncMap の Renderer を並べて使え、パッケージ関数は InitTemplates の Renderer を使う
+	main: `package main
+
+import (
+	"fmt"
+	"os"
+	"text/template"
+)
+
+func main() {
+	fmt.Println(RenderGreet(os.Stdout, Greet{Name: "x"}))
+	en, err := NewRenderer(WithFuncs(template.FuncMap{"hello": func(s string) string { return "Hello, " + s }}))
+	if err != nil {
+		panic(err)
+	}
+	ja, err := NewRenderer(WithFuncs(template.FuncMap{"hello": func(s string) string { return "こんにちは、" + s }}))
+	if err != nil {
+		panic(err)
+	}
+	if err := en.RenderGreet(os.Stdout, Greet{Name: "Alice"}); err != nil {
+		panic(err)
+	}
+	fmt.Println()
+	if err := ja.RenderGreet(os.Stdout, Greet{Name: "Bob"}); err != nil {
+		panic(err)
+	}
+	fmt.Println()
+	if err := en.RenderSign(os.Stdout, Sign{Team: "dev"}); err != nil {
+		panic(err)
+	}
+	fmt.Println()
+	_, err = NewRenderer()
+	fmt.Println(err)
+
+	if err := InitTemplates(WithFuncs(template.FuncMap{"hello": func(s string) string { return "Hi, " + s }})); err != nil {
+		panic(err)
+	}
+	if err := RenderGreet(os.Stdout, Greet{Name: "Carol"}); err != nil {
+		panic(err)
+	}
+	fmt.Println()
+	fmt.Println(len(Templates()), len(en.Templates()))
+}
+`,
+})
+
+func TestEmit_Renderer(t *testing.T) {
+	out := rendererCase.run(t)
+	want := `templates not initialized: call InitTemplates() first
+Hello, Alice
+こんにちは、Bob
+-- dev
+missing template functions: hello (used by "greet"); provide them with WithFuncs
+Hi, Carol
+2 2
+`
+	if out != want {
+		t.Fatalf("output = %q, want %q", out, want)
+	}
+}
+
+var renderContextCase = addRunCase(runCase{
+	name: "render_context",
+	specs: []gen.TemplateSpec{
+		{Name: "rows", Pkg: "main", FilePath: "rows.tmpl", Source: `{{ range .Items }}{{ . }};{{ end }}`},
+	},
+	// 書き込みの途中で ctx がキャンセルされると、以降の書き込みをせずに ctx.Err() を返す
+	main: `package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type cancelWriter struct {
+	strings.Builder
+	cancel context.CancelFunc
+}
+
+func (w *cancelWriter) Write(p []byte) (int, error) {
+	w.cancel()
+	return w.Builder.Write(p)
+}
+
+func main() {
+	InitTemplates()
+	p := Rows{Items: []string{"a", "b", "c"}}
+
+	var ok strings.Builder
+	fmt.Println(RenderRowsContext(context.Background(), &ok, p), ok.String())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &cancelWriter{cancel: cancel}
+	err := RenderRowsContext(ctx, w, p)
+	fmt.Println(err, errors.Is(err, context.Canceled), w.String())
+
+	var none strings.Builder
+	fmt.Println(RenderRowsContext(ctx, &none, p), none.Len())
+}
+`,
+})
+
+func TestEmit_RenderContext(t *testing.T) {
+	out := renderContextCase.run(t)
+	want := `<nil> a;b;c;
+template "rows": context canceled true a
+template "rows": context canceled 0
+`
+	if out != want {
+		t.Fatalf("output = %q, want %q", out, want)
+	}
+}
+
+func TestEmit_RenderContextNameCollision(t *testing.T) {
+	specs := []gen.TemplateSpec{
+		{Name: "email", Pkg: "x", FilePath: "email.tmpl", Source: `{{ .Title }}`},
+		{Name: "email_context", Pkg: "x", FilePath: "email_context.tmpl", Source: `{{ .Name }}`},
+	}
+	_, err := gen.Emit(specs)
+	if err == nil || !strings.Contains(err.Error(), `template "email" generates function RenderEmailContext, which conflicts with the render function of template "email_context"`) {
+		t.Fatalf("expected render function collision error, got %v", err)
+	}
+}
+
+var renderStringCase = addRunCase(runCase{
+	name: "render_string",
+	specs: []gen.TemplateSpec{
+		{Name: "greet", Pkg: "main", FilePath: "greet.tmpl", Source: `Hello, {{ .Name }}`},
+	},
+	// プールのバッファを使い回しても、返した値は後の描画で書き換わらない
+	main: `package main
+
+import "fmt"
+
+func main() {
+	InitTemplates()
+	s, err := RenderGreetString(Greet{Name: "Alice"})
+	if err != nil {
+		panic(err)
+	}
+	b, err := RenderGreetBytes(Greet{Name: "Bob"})
+	if err != nil {
+		panic(err)
+	}
+	for i := 0; i < 100; i++ {
+		if _, err := RenderGreetBytes(Greet{Name: "Carol"}); err != nil {
+			panic(err)
+		}
+	}
+	fmt.Printf("%s|%s", s, b)
+}
+`,
+})
+
+func TestEmit_RenderStringAndBytes(t *testing.T) {
+	out := renderStringCase.run(t)
+	if want := "Hello, Alice|Hello, Bob"; out != want {
+		t.Fatalf("output = %q, want %q", out, want)
+	}
+}
+
+var bufferedOutputCase = addRunCase(runCase{
+	name: "buffered_output",
+	specs: []gen.TemplateSpec{
+		{Name: "greet", Pkg: "main", FilePath: "greet.tmpl", Source: "{{/* @param Items []string */}}Hello, {{ .Name }}\n{{ index .Items 1 }}"},
+	},
+	// 2行目で失敗しても、1行目の出力は書き込まれない
+	main: `package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+func main() {
+	if err := InitTemplates(WithBufferedOutput()); err != nil {
+		panic(err)
+	}
+	var sb strings.Builder
+	err := RenderGreet(&sb, Greet{Name: "Alice", Items: []string{"a"}})
+	var renderErr *RenderError
+	if !errors.As(err, &renderErr) {
+		panic(fmt.Sprintf("error %v is not a *RenderError", err))
+	}
+	fmt.Printf("%q %s:%d:%d|", sb.String(), renderErr.Template, renderErr.Line, renderErr.Col)
+
+	err = RenderGreetContext(context.Background(), &sb, Greet{Name: "Bob"})
+	fmt.Printf("%q %v|", sb.String(), errors.As(err, &renderErr))
+
+	if err := RenderGreet(&sb, Greet{Name: "Carol", Items: []string{"a", "b"}}); err != nil {
+		panic(err)
+	}
+	fmt.Printf("%q", sb.String())
+}
+`,
+})
+
+func TestEmit_BufferedOutput(t *testing.T) {
+	out := bufferedOutputCase.run(t)
+	if want := `"" greet:2:3|"" true|"Hello, Carol\nb"`; out != want {
+		t.Fatalf("output = %q, want %q", out, want)
+	}
+}
+
+var execErrorCase = addRunCase(runCase{
+	name: "exec_error",
+	specs: []gen.TemplateSpec{
+		{Name: "page", Pkg: "main", FilePath: "templates/page.tmpl", Source: `Hi {{ template "footer" . }}`},
+		{Name: "footer", Pkg: "main", FilePath: "templates/footer.tmpl", Source: "Bye\n{{ index .Items 3 }} {{ .Account.Preferences.Languages }}"},
+		{Name: "card", Pkg: "main", FilePath: "templates/card.tmpl", Source: `{{ template "user" .User }}`},
+		{Name: "user", Pkg: "main", FilePath: "templates/user.tmpl", Source: `{{ index .Tags 5 }}`},
+	},
+	// エラーメッセージでは省略される長いフィールドのパスも、パースツリーから完全に取り出す
+	// 呼び出し先のテンプレートで失敗した場合、フィールドは呼び出し先のドットからのパスになる
+	main: `package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+func main() {
+	fmt.Print(errors.Is(Render(io.Discard, Template.Page, nil), ErrNotInitialized), "|")
+	if err := InitTemplates(); err != nil {
+		panic(err)
+	}
+	fmt.Print(errors.Is(Render(io.Discard, "nope", nil), ErrTemplateNotFound), "|")
+
+	for _, data := range []map[string]any{
+		{"Items": []int{1, 2, 3, 4}, "Account": map[string]any{"Preferences": map[string]any{}}},
+		{"Items": []int{1}},
+	} {
+		err := Render(io.Discard, Template.Page, data)
+		var execErr *ExecError
+		if !errors.As(err, &execErr) {
+			panic(fmt.Sprintf("error %v is not an *ExecError", err))
+		}
+		fmt.Printf("%s %s:%d:%d %s|", execErr.Template, execErr.File, execErr.Line, execErr.Col, execErr.Field)
+	}
+
+	err := Render(io.Discard, Template.Card, map[string]any{"User": map[string]any{"Tags": []string{}}})
+	var execErr *ExecError
+	if !errors.As(err, &execErr) {
+		panic(fmt.Sprintf("error %v is not an *ExecError", err))
+	}
+	fmt.Printf("%s %s:%d:%d %s", execErr.Template, execErr.File, execErr.Line, execErr.Col, execErr.Field)
+}
+`,
+})
+
+func TestEmit_ExecError(t *testing.T) {
+	out := execErrorCase.run(t)
+	if want := "true|true|page templates/footer.tmpl:2:32 Account.Preferences.Languages|page templates/footer.tmpl:2:3 Items|card templates/user.tmpl:1:3 Tags"; out != want {
+		t.Fatalf("output = %q, want %q", out, want)
+	}
+}
+
+var typedTemplateCase = addRunCase(runCase{
+	name: "typed_template",
+	specs: []gen.TemplateSpec{
+		{Name: "greet", Pkg: "main", FilePath: "greet.tmpl", Source: `Hello, {{ .Name }}`},
+		{Name: "count", Pkg: "main", FilePath: "count.tmpl", Source: `{{ .N }} items`},
+	},
+	// ジェネリックな関数が、データの型を保ったままどのテンプレートも扱える
+	main: `package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func renderAll[T any](tpl TypedTemplate[T], items ...T) string {
+	var sb strings.Builder
+	for _, item := range items {
+		if err := tpl.Execute(&sb, item); err != nil {
+			panic(err)
+		}
+		sb.WriteString(";")
+	}
+	return string(tpl.Name()) + ": " + sb.String()
+}
+
+func main() {
+	InitTemplates()
+	fmt.Print(renderAll(GreetTemplate, Greet{Name: "Alice"}, Greet{Name: "Bob"}), "|")
+	fmt.Print(renderAll(CountTemplate, Count{N: "3"}))
+}
+`,
+})
+
+func TestEmit_TypedTemplate(t *testing.T) {
+	out := typedTemplateCase.run(t)
+	if want := "greet: Hello, Alice;Hello, Bob;|count: 3 items;"; out != want {
+		t.Fatalf("output = %q, want %q", out, want)
+	}
+}
+
+func TestEmit_TypedTemplateNameCollision(t *testing.T) {
+	specs := []gen.TemplateSpec{
+		{Name: "email", Pkg: "x", FilePath: "email.tmpl", Source: `{{ .Template.Name }}`},
+	}
+	_, err := gen.Emit(specs)
+	if err == nil || !strings.Contains(err.Error(), `template "email" generates variable EmailTemplate, which conflicts with type EmailTemplate generated for template "email"`) {
+		t.Fatalf("expected typed template collision error, got %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+package gen
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+
+	"github.com/bellwood4486/tmpltype/internal/diag"
+)
+
+// ============================================================
+// Custom Function Signatures (WithFuncMap)
+// ============================================================
+
+// funcMapRef は WithFuncMap で指定された FuncMap の定義
+type funcMapRef struct {
+	ref  string // 指定された文字列（エラーメッセージ用）
+	path string // 定義するパッケージのインポートパス
+	name string // FuncMap を返す関数、または FuncMap 型の変数の名前
+}
+
+// parseFuncMapRef は "<import path>.<name>" の形式の指定をパースする
+func parseFuncMapRef(ref string) (funcMapRef, error) {
+	i := strings.LastIndex(ref, ".")
+	if i <= 0 || !token.IsIdentifier(ref[i+1:]) || strings.HasPrefix(ref, ".") || filepath.IsAbs(ref) {
+		return funcMapRef{}, diag.Errorf(diag.CodeFunc, "", 0, 0, "invalid function map %q: expected <import path>.<name>", ref)
+	}
+	return funcMapRef{ref: ref, path: ref[:i], name: ref[i+1:]}, nil
+}
+
+// loadFuncMaps は指定された FuncMap を dir を基準に読み込み、各関数のシグネチャを集める
+// 同じ名前の関数が複数の FuncMap にある場合は、後に指定したものを使う（template.Funcs を順に呼んだ場合と同じ）
+func loadFuncMaps(refs []string, dir string) (map[string]*types.Signature, error) {
+	funcs := make(map[string]*types.Signature)
+	if len(refs) == 0 {
+		return funcs, nil
+	}
+
+	var targets []funcMapRef
+	var paths []string
+	for _, ref := range refs {
+		target, err := parseFuncMapRef(ref)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+		if !slices.Contains(paths, target.path) {
+			paths = append(paths, target.path)
+		}
+	}
+
+	// FuncMap のリテラルから関数の値の型を調べるため、構文木と型情報も読み込む
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedTypes | packages.NeedTypesInfo |
+			packages.NeedSyntax | packages.NeedImports | packages.NeedDeps,
+		Dir: dir,
+	}
+	loaded, err := packages.Load(cfg, paths...)
+	if err != nil {
+		return nil, diag.Errorf(diag.CodeFunc, "", 0, 0, "failed to load packages: %v", err)
+	}
+	byPath := make(map[string]*packages.Package, len(loaded))
+	for _, p := range loaded {
+		byPath[p.PkgPath] = p
+	}
+
+	for _, target := range targets {
+		p := byPath[target.path]
+		if p == nil || p.Types == nil || p.TypesInfo == nil {
+			return nil, diag.Errorf(diag.CodeFunc, "", 0, 0, "cannot load package %q", target.path)
+		}
+		// 生成コードが古いとパッケージ自体はコンパイルできないことがあるため、型エラーは FuncMap が見つからない場合にだけ報告する
+		sigs, err := funcMapEntries(p, target)
+		if err != nil {
+			if len(p.Errors) > 0 {
+				return nil, diag.Errorf(diag.CodeFunc, "", 0, 0, "%v (package %s: %s)", err, target.path, p.Errors[0].Msg)
+			}
+			return nil, err
+		}
+		maps.Copy(funcs, sigs)
+	}
+	return funcs, nil
+}
+
+// funcMapEntries は FuncMap を返す関数（または FuncMap 型の変数）の定義から、
+// template.FuncMap{"name": fn} のリテラルと m["name"] = fn の代入で登録される関数のシグネチャを集める
+func funcMapEntries(p *packages.Package, target funcMapRef) (map[string]*types.Signature, error) {
+	obj := p.Types.Scope().Lookup(target.name)
+	if obj == nil {
+		return nil, diag.Errorf(diag.CodeFunc, "", 0, 0, "%s is not declared in package %s", target.name, target.path)
+	}
+	var ok bool
+	switch obj := obj.(type) {
+	case *types.Func:
+		results := obj.Signature().Results()
+		ok = results.Len() == 1 && isFuncMap(results.At(0).Type())
+	case *types.Var:
+		ok = isFuncMap(obj.Type())
+	}
+	if !ok {
+		return nil, diag.Errorf(diag.CodeFunc, "", 0, 0, "%s must be a function returning template.FuncMap or a variable of type template.FuncMap", target.ref)
+	}
+
+	info := p.TypesInfo
+	sigs := make(map[string]*types.Signature)
+	add := func(key, value ast.Expr) {
+		tv, ok := info.Types[key]
+		if !ok || tv.Value == nil || tv.Value.Kind() != constant.String {
+			return
+		}
+		// 関数以外の値（any 型の変数など）は型が分からないので対象外
+		if sig, ok := info.TypeOf(value).Underlying().(*types.Signature); ok {
+			sigs[constant.StringVal(tv.Value)] = sig
+		}
+	}
+
+	inspect := func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CompositeLit:
+			if !isFuncMap(info.TypeOf(n)) {
+				return true
+			}
+			for _, elt := range n.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					add(kv.Key, kv.Value)
+				}
+			}
+		case *ast.AssignStmt:
+			if len(n.Lhs) != len(n.Rhs) {
+				return true
+			}
+			for i, lhs := range n.Lhs {
+				if idx, ok := lhs.(*ast.IndexExpr); ok && isFuncMap(info.TypeOf(idx.X)) {
+					add(idx.Index, n.Rhs[i])
+				}
+			}
+		}
+		return true
+	}
+	if node := declNode(p, obj); node != nil {
+		ast.Inspect(node, inspect)
+	}
+
+	if len(sigs) == 0 {
+		return nil, diag.Errorf(diag.CodeFunc, "", 0, 0, "no functions found in %s; list them in a template.FuncMap literal", target.ref)
+	}
+	return sigs, nil
+}
+
+// declNode は関数・変数の宣言の構文木を返す（見つからなければ nil）
+func declNode(p *packages.Package, obj types.Object) ast.Node {
+	for _, f := range p.Syntax {
+		for _, decl := range f.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if p.TypesInfo.Defs[decl.Name] == obj {
+					return decl
+				}
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					vs, ok := spec.(*ast.ValueSpec)
+					if !ok {
+						continue
+					}
+					for _, name := range vs.Names {
+						if p.TypesInfo.Defs[name] == obj {
+							return vs
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// isFuncMap は型が text/template または html/template の FuncMap かを返す
+// html/template.FuncMap は text/template.FuncMap の別名
+func isFuncMap(t types.Type) bool {
+	if t == nil {
+		return false
+	}
+	named, ok := types.Unalias(t).(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Name() == "FuncMap" && obj.Pkg() != nil && obj.Pkg().Path() == "text/template"
+}
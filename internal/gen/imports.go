@@ -0,0 +1,154 @@
+package gen
+
+import (
+	"go/types"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+
+	"github.com/bellwood4486/tmpltype/internal/diag"
+	"github.com/bellwood4486/tmpltype/internal/typing/magic"
+)
+
+// ============================================================
+// Imported Packages
+// ============================================================
+
+// importDecl は @import または WithImport で宣言されたパッケージと宣言元
+type importDecl struct {
+	decl     magic.ImportDecl
+	file     string // 宣言元のテンプレートファイル（WithImport の場合は空）
+	implicit bool   // @model が参照するパッケージか（同じパスが宣言されていればその名前を使う）
+}
+
+// generatedImports は生成コードが常に import するパッケージ（パッケージ名 -> インポートパス）
+// 同じ名前で別のパッケージを import すると生成コードがコンパイルできない
+var generatedImports = map[string]string{
+	"atomic":   "sync/atomic",
+	"bytes":    "bytes",
+	"context":  "context",
+	"errors":   "errors",
+	"fmt":      "fmt",
+	"io":       "io",
+	"os":       "os",
+	"parse":    "text/template/parse",
+	"filepath": "path/filepath",
+	"reflect":  "reflect",
+	"regexp":   "regexp",
+	"strconv":  "strconv",
+	"sync":     "sync",
+	"time":     "time",
+	"template": "", // text/template または html/template
+	// html/template の場合に ExecError を参照するため
+	"texttemplate": "text/template",
+}
+
+// importedPackages は読み込んだパッケージ
+type importedPackages struct {
+	byName map[string]*types.Package // 型表現で使うパッケージ名 -> パッケージ
+	names  map[string]string         // インポートパス -> import 文に書く名前（パッケージ自身の名前と同じなら空）
+	byPath map[string]string         // インポートパス -> 型表現で使うパッケージ名
+}
+
+// collectImportDecls はすべてのテンプレートの @import と WithImport の宣言を集める
+// @model が参照するパッケージは、明示的な宣言の後に暗黙の宣言として加える
+func collectImportDecls(specs []TemplateSpec, o *options, models map[string]*magic.ModelDirective) ([]importDecl, error) {
+	var decls []importDecl
+	for _, d := range o.imports {
+		decls = append(decls, importDecl{decl: d})
+	}
+	for _, spec := range specs {
+		found, err := magic.ParseImports(spec.Source)
+		if err != nil {
+			return nil, diag.InFile(err, spec.FilePath)
+		}
+		for _, d := range found {
+			decls = append(decls, importDecl{decl: d, file: spec.FilePath})
+		}
+	}
+	for _, spec := range specs {
+		if m := models[spec.Name]; m != nil {
+			decl := magic.ImportDecl{Path: m.Path, Line: m.Line, Col: m.Col}
+			decls = append(decls, importDecl{decl: decl, file: spec.FilePath, implicit: true})
+		}
+	}
+	return decls, nil
+}
+
+// loadPackages は宣言されたパッケージを dir を基準に読み込む
+// 名前を省略した宣言はパッケージ自身の名前で参照する
+func loadPackages(decls []importDecl, dir string) (*importedPackages, error) {
+	imported := &importedPackages{
+		byName: make(map[string]*types.Package),
+		names:  make(map[string]string),
+		byPath: make(map[string]string),
+	}
+	if len(decls) == 0 {
+		return imported, nil
+	}
+
+	var paths []string
+	for _, d := range decls {
+		if strings.HasPrefix(d.decl.Path, ".") || filepath.IsAbs(d.decl.Path) {
+			return nil, importError(d, "import path %q must be a package path, not a directory", d.decl.Path)
+		}
+		if !slices.Contains(paths, d.decl.Path) {
+			paths = append(paths, d.decl.Path)
+		}
+	}
+
+	// エクスポートデータの形式はツールチェーンのバージョンに依存するため、依存パッケージも含めてソースから型チェックする
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedTypes | packages.NeedSyntax | packages.NeedImports | packages.NeedDeps,
+		Dir:  dir,
+	}
+	loaded, err := packages.Load(cfg, paths...)
+	if err != nil {
+		return nil, diag.Errorf(diag.CodeImport, "", 0, 0, "failed to load packages: %v", err)
+	}
+	byPath := make(map[string]*packages.Package, len(loaded))
+	for _, p := range loaded {
+		byPath[p.PkgPath] = p
+	}
+
+	for _, d := range decls {
+		p := byPath[d.decl.Path]
+		if p == nil {
+			return nil, importError(d, "cannot load package %q", d.decl.Path)
+		}
+		if len(p.Errors) > 0 {
+			return nil, importError(d, "cannot load package %q: %s", d.decl.Path, p.Errors[0].Msg)
+		}
+
+		if _, ok := imported.byPath[d.decl.Path]; ok && d.implicit {
+			continue
+		}
+		name := d.decl.Name
+		if name == "" {
+			name = p.Name
+		}
+		if prev, ok := imported.byName[name]; ok && prev.Path() != d.decl.Path {
+			return nil, importError(d, "package name %s is already used for %q", name, prev.Path())
+		}
+		if prev, ok := imported.byPath[d.decl.Path]; ok && prev != name {
+			return nil, importError(d, "package %q is already imported as %s", d.decl.Path, prev)
+		}
+		if std, ok := generatedImports[name]; ok && std != d.decl.Path {
+			return nil, importError(d, "package name %s conflicts with an import of the generated code; use @import <name> %s", name, d.decl.Path)
+		}
+
+		imported.byName[name] = p.Types
+		imported.byPath[d.decl.Path] = name
+		if name != p.Name {
+			imported.names[d.decl.Path] = name
+		}
+	}
+	return imported, nil
+}
+
+// importError は宣言の位置を付けたエラーを返す
+func importError(d importDecl, format string, args ...any) error {
+	return diag.Errorf(diag.CodeImport, d.file, d.decl.Line, d.decl.Col, format, args...)
+}
@@ -0,0 +1,61 @@
+package gen
+
+import (
+	"go/types"
+
+	"github.com/bellwood4486/tmpltype/internal/diag"
+	"github.com/bellwood4486/tmpltype/internal/scan"
+	"github.com/bellwood4486/tmpltype/internal/typing"
+	"github.com/bellwood4486/tmpltype/internal/typing/magic"
+)
+
+// ============================================================
+// Existing Go Types (@model)
+// ============================================================
+
+// collectModels はテンプレートごとの @model ディレクティブを集める（テンプレート名 -> ディレクティブ）
+func collectModels(specs []TemplateSpec) (map[string]*magic.ModelDirective, error) {
+	models := make(map[string]*magic.ModelDirective)
+	for _, spec := range specs {
+		model, err := magic.ParseModel(spec.Source)
+		if err != nil {
+			return nil, diag.InFile(err, spec.FilePath)
+		}
+		if model != nil {
+			models[spec.Name] = model
+		}
+	}
+	return models, nil
+}
+
+// resolveModel は @model の型を読み込んだパッケージから探し、テンプレートで使われるフィールドがすべて存在するかを検証する
+// 生成コードでデータの型として使う型表現（例: "models.Invoice", "*models.Invoice"）を返す
+// opts はカスタム関数の呼び出しの検証に使う
+func resolveModel(spec TemplateSpec, model *magic.ModelDirective, sch scan.Schema, imported *importedPackages, opts ...typing.Option) (string, error) {
+	// データの型は既存の型で決まるため、@param で型を変えることはできない
+	params, err := magic.ParseParams(spec.Source)
+	if err != nil {
+		return "", diag.InFile(err, spec.FilePath)
+	}
+	if len(params) > 0 {
+		return "", diag.Errorf(diag.CodeModel, spec.FilePath, params[0].Line, params[0].Col, "@param cannot be used with @model %s.%s", model.Path, model.Name)
+	}
+
+	name := imported.byPath[model.Path]
+	obj, ok := imported.byName[name].Scope().Lookup(model.Name).(*types.TypeName)
+	if !ok || !obj.Exported() {
+		return "", diag.Errorf(diag.CodeModel, spec.FilePath, model.Line, model.Col, "%s is not an exported type of package %s", model.Name, model.Path)
+	}
+	if err := typing.CheckModel(sch, obj.Type()); err != nil {
+		return "", diag.Errorf(diag.CodeModel, spec.FilePath, model.Line, model.Col, "@model %s.%s: %v", model.Path, model.Name, err)
+	}
+	if err := typing.CheckModelCalls(sch, obj.Type(), opts...); err != nil {
+		return "", err
+	}
+
+	goType := name + "." + model.Name
+	if model.Pointer {
+		goType = "*" + goType
+	}
+	return goType, nil
+}
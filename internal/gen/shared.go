@@ -0,0 +1,255 @@
+package gen
+
+import (
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/bellwood4486/tmpltype/internal/diag"
+	"github.com/bellwood4486/tmpltype/internal/typing"
+	"github.com/bellwood4486/tmpltype/internal/typing/magic"
+	"github.com/bellwood4486/tmpltype/internal/util"
+)
+
+// ============================================================
+// Shared Types
+// ============================================================
+
+// sharedType は複数のテンプレートで共有する型
+// @type で宣言された型と、WithSharedTypes で抽出した型の2種類がある
+type sharedType struct {
+	name    string
+	comment string        // 型のドキュメントコメント
+	goType  string        // 構造体以外の宣言の型（例: "[]string"）。構造体なら空
+	fields  []sharedField // 構造体のフィールド（宣言された型は宣言順、抽出した型は名前順）
+}
+
+// sharedField は共有型の構造体フィールド
+type sharedField struct {
+	name   string
+	goType string
+}
+
+// declaredType は @type で宣言された型と宣言元のファイル
+type declaredType struct {
+	decl magic.TypeDecl
+	file string
+}
+
+// collectTypeDecls はすべてのテンプレートから @type 宣言を集める
+// 同じ名前の宣言は、型が同じであれば複数のファイルに書かれていてもよい
+func collectTypeDecls(specs []TemplateSpec) (map[string]declaredType, error) {
+	decls := make(map[string]declaredType)
+	for _, spec := range specs {
+		found, err := magic.ParseTypes(spec.Source)
+		if err != nil {
+			return nil, diag.InFile(err, spec.FilePath)
+		}
+		for _, d := range found {
+			if prev, ok := decls[d.Name]; ok {
+				if prev.decl.Type.String() != d.Type.String() {
+					return nil, diag.Errorf(diag.CodeTypeDecl, spec.FilePath, d.Line, d.Col, "@type %s is already declared as %s in %s:%d", d.Name, prev.decl.Type.String(), prev.file, prev.decl.Line)
+				}
+				continue
+			}
+			decls[d.Name] = declaredType{decl: d, file: spec.FilePath}
+		}
+	}
+	return decls, nil
+}
+
+// declaredTypeExprs は typing.WithTypes に渡す宣言の型を返す
+func declaredTypeExprs(decls map[string]declaredType) map[string]magic.TypeExpr {
+	types := make(map[string]magic.TypeExpr, len(decls))
+	for name, d := range decls {
+		types[name] = d.decl.Type
+	}
+	return types
+}
+
+// declaredSharedTypes は @type 宣言を名前順の共有型に変換する
+func declaredSharedTypes(decls map[string]declaredType) []sharedType {
+	types := make([]sharedType, 0, len(decls))
+	for _, name := range slices.Sorted(maps.Keys(decls)) {
+		d := decls[name]
+		st := sharedType{
+			name:    name,
+			comment: name + " is declared with @type in " + d.file,
+		}
+		if d.decl.Type.Kind == magic.TypeKindStruct {
+			for _, f := range d.decl.Type.Fields {
+				st.fields = append(st.fields, sharedField{name: util.Export(f.Name), goType: f.Type.String()})
+			}
+		} else {
+			st.goType = d.decl.Type.String()
+		}
+		types = append(types, st)
+	}
+	return types
+}
+
+// checkDeclaredPackages は @type 宣言の型が参照するパッケージが @import されているかを検証する
+func checkDeclaredPackages(decls map[string]declaredType, imported *importedPackages) error {
+	for _, name := range slices.Sorted(maps.Keys(decls)) {
+		d := decls[name]
+		if err := typing.CheckPackages(d.decl.Type, imported.byName); err != nil {
+			return diag.Errorf(diag.CodeImport, d.file, d.decl.Line, d.decl.Col, "@type %s %s: %v", name, d.decl.Type.String(), err)
+		}
+	}
+	return nil
+}
+
+// declaredImports は @type 宣言の型が必要とする import を imports に追加する
+func declaredImports(decls map[string]declaredType, imported *importedPackages, imports map[string]struct{}) {
+	for _, d := range decls {
+		for _, name := range d.decl.Type.QualifiedNames() {
+			pkgName, _, _ := strings.Cut(name, ".")
+			if pkg, ok := imported.byName[pkgName]; ok {
+				imports[pkg.Path()] = struct{}{}
+			} else if pkgName == "time" {
+				imports["time"] = struct{}{}
+			}
+		}
+	}
+}
+
+// extractSharedTypes は複数のテンプレートで同じ名前・同じ構造になる名前付き型を共有型として抽出する
+// 構造は参照する名前付き型まで再帰的に比較する。taken に含まれる名前は生成コードの他の識別子と衝突するため共有しない
+func extractSharedTypes(templates []tmpl, taken map[string]bool) []sharedType {
+	type occurrence struct {
+		template  tmpl
+		signature string
+	}
+	occurrences := make(map[string][]occurrence)
+	for _, t := range templates {
+		index := namedTypeIndex(t.typed)
+		for _, name := range slices.Sorted(maps.Keys(index)) {
+			occurrences[name] = append(occurrences[name], occurrence{template: t, signature: typeSignature(index, name, nil)})
+		}
+	}
+
+	// 2つ以上のテンプレートに現れ、すべて同じ構造の名前を共有候補にする
+	shared := make(map[string]bool)
+	for name, occs := range occurrences {
+		if len(occs) < 2 || taken[name] {
+			continue
+		}
+		if !slices.ContainsFunc(occs, func(o occurrence) bool { return o.signature != occs[0].signature }) {
+			shared[name] = true
+		}
+	}
+
+	// 共有しない名前付き型を参照する型は、テンプレート固有の型を参照するため共有できない
+	for changed := true; changed; {
+		changed = false
+		for name := range shared {
+			t := occurrences[name][0].template
+			index := namedTypeIndex(t.typed)
+			for _, field := range index[name].Fields {
+				if ref := namedTypeRef(field.GoType); index[ref] != nil && !shared[ref] {
+					delete(shared, name)
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	types := make([]sharedType, 0, len(shared))
+	for _, name := range slices.Sorted(maps.Keys(shared)) {
+		occs := occurrences[name]
+		users := make([]string, 0, len(occs))
+		for _, o := range occs {
+			users = append(users, o.template.name)
+		}
+
+		st := sharedType{
+			name:    name,
+			comment: name + " is shared by the " + joinNames(users) + " templates",
+		}
+		namedType := namedTypeIndex(occs[0].template.typed)[name]
+		for _, fieldName := range slices.Sorted(maps.Keys(namedType.Fields)) {
+			field := namedType.Fields[fieldName]
+			// 参照する名前付き型はすべて共有型なのでプレフィックスは付かない
+			st.fields = append(st.fields, sharedField{name: field.Name, goType: adjustTypeForTemplate(field.GoType, "", shared)})
+		}
+		types = append(types, st)
+	}
+	return types
+}
+
+// joinNames は名前を "a, b and c" の形式で連結する
+func joinNames(names []string) string {
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// namedTypeIndex はテンプレートの名前付き型を名前で引けるようにする
+func namedTypeIndex(typed *typing.TypedSchema) map[string]*typing.NamedType {
+	index := make(map[string]*typing.NamedType, len(typed.NamedTypes))
+	for _, nt := range typed.NamedTypes {
+		index[nt.Name] = nt
+	}
+	return index
+}
+
+// namedTypeRef はフィールドの型が参照する型名を返す
+// 例: "[]ItemsItem" -> "ItemsItem", "map[string]UsersValue" -> "UsersValue", "User" -> "User"
+func namedTypeRef(goType string) string {
+	goType = strings.TrimPrefix(goType, "[]")
+	goType = strings.TrimPrefix(goType, "map[string]")
+	return goType
+}
+
+// typeSignature は名前付き型の構造を表す文字列を返す
+// フィールドが参照する同じテンプレートの名前付き型も展開して比較できるようにする
+func typeSignature(index map[string]*typing.NamedType, name string, visiting map[string]bool) string {
+	if visiting[name] {
+		return name
+	}
+	visiting = maps.Clone(visiting)
+	if visiting == nil {
+		visiting = make(map[string]bool)
+	}
+	visiting[name] = true
+
+	namedType := index[name]
+	var b strings.Builder
+	b.WriteString("{")
+	for _, fieldName := range slices.Sorted(maps.Keys(namedType.Fields)) {
+		field := namedType.Fields[fieldName]
+		b.WriteString(field.Name + " " + field.GoType)
+		if ref := namedTypeRef(field.GoType); index[ref] != nil {
+			b.WriteString(typeSignature(index, ref, visiting))
+		}
+		b.WriteString(";")
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// generateSharedTypes は共有型を生成する
+func generateSharedTypes(b *strings.Builder, types []sharedType) {
+	if len(types) == 0 {
+		return
+	}
+
+	write(b, "// ============================================================\n")
+	write(b, "// Shared types\n")
+	write(b, "// ============================================================\n\n")
+
+	for _, st := range types {
+		write(b, "// %s\n", st.comment)
+		if st.goType != "" {
+			write(b, "type %s %s\n\n", st.name, st.goType)
+			continue
+		}
+		write(b, "type %s struct {\n", st.name)
+		for _, f := range st.fields {
+			write(b, "\t%s %s\n", f.name, f.goType)
+		}
+		write(b, "}\n\n")
+	}
+}
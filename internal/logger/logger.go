@@ -15,7 +15,8 @@ const EnvLogLevel = "TMPLTYPE_LOG_LEVEL"
 
 var (
 	globalLogger *slog.Logger
-	globalLevel  = new(slog.LevelVar) // デフォルトは Info
+	globalLevel  = new(slog.LevelVar)   // デフォルトは Info
+	output       = io.Writer(os.Stdout) // デフォルトは標準出力
 )
 
 func init() {
@@ -36,12 +37,18 @@ func initLogger() {
 
 	// カスタムハンドラーで [scan:category] フォーマットを実現
 	handler := &customHandler{
-		out:   os.Stdout,
+		out:   output,
 		level: globalLevel,
 	}
 	globalLogger = slog.New(handler)
 }
 
+// SetOutput changes where log messages are written. The default is stdout.
+func SetOutput(w io.Writer) {
+	output = w
+	globalLogger = slog.New(&customHandler{out: w, level: globalLevel})
+}
+
 // Debug logs a debug message with the given category and attributes.
 // Output format: [scan:category] key=value key=value
 func Debug(category string, args ...any) {
@@ -52,7 +59,7 @@ func Debug(category string, args ...any) {
 
 // Info logs an info message.
 func Info(format string, args ...any) {
-	fmt.Fprintf(os.Stdout, format+"\n", args...)
+	fmt.Fprintf(output, format+"\n", args...)
 }
 
 // attrsFromArgs converts variadic key-value pairs to slog.Attr slice.
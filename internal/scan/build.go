@@ -112,19 +112,33 @@ func buildKindMap(info map[string]*pathInfo) map[string]Kind {
 
 // determineKind はパス情報から Kind を決定します。
 func determineKind(pi *pathInfo) Kind {
-	// 優先順位: Map > Slice > Struct > String
+	// 優先順位: Map > Slice > Struct > Float > Int > Bool > String
 	// usageScope（if/with の基点）は hasChild がある場合のみ Struct になる
+	// usageBool は値として出力されていない（usageLeaf がない）場合のみ Bool になる
 	// 例: {{ if .Status }}{{ .Status }}{{ end }} → Status は String
+	// 例: {{ if .Enabled }}on{{ end }} → Enabled は Bool
+	// 例: {{ if eq .Count 0 }}none{{ else }}{{ .Count }}{{ end }} → Count は Int
 	// 例: {{ with .User }}{{ .Name }}{{ end }} → User は Struct（User.Name があるため）
 	if pi.usages[usageRangeMap] || pi.usages[usageIndex] {
 		return KindMap
 	}
-	if pi.usages[usageRange] {
+	// len の引数は、値としても出力される場合は文字列の長さとみなす
+	// 例: {{ if gt (len .Items) 0 }} → Items は Slice、{{ .Title }}{{ len .Title }} → Title は String
+	if pi.usages[usageRange] || (pi.usages[usageLen] && !pi.usages[usageLeaf]) {
 		return KindSlice
 	}
 	if pi.hasChild {
 		return KindStruct
 	}
+	if pi.usages[usageFloat] {
+		return KindFloat
+	}
+	if pi.usages[usageInt] {
+		return KindInt
+	}
+	if pi.usages[usageBool] && !pi.usages[usageLeaf] {
+		return KindBool
+	}
 	return KindString
 }
 
@@ -2,9 +2,15 @@ package scan
 
 import (
 	"fmt"
+	"maps"
 	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"text/template"
 	"text/template/parse"
+
+	"github.com/bellwood4486/tmpltype/internal/diag"
 )
 
 // usage はフィールドがテンプレート内でどのように使われたかを表します。
@@ -15,12 +21,20 @@ const (
 	usageLeaf usage = iota
 	// usageRange は {{ range .Foo }} の対象になった場合
 	usageRange
-	// usageRangeMap は {{ range $k, $v := .Foo }} の対象になった場合
+	// usageRangeMap は {{ range $k, $v := .Foo }} の対象になり、キーが文字列として使われた場合
 	usageRangeMap
 	// usageIndex は {{ index .Foo "key" }} の対象になった場合
 	usageIndex
 	// usageScope は {{ with .Foo }} や {{ if .Foo }} のスコープ基点になった場合
 	usageScope
+	// usageBool は {{ if .Foo }} や {{ not .Foo }} のように真偽値として使われた場合
+	usageBool
+	// usageInt は {{ eq .Foo 0 }} や {{ printf "%d" .Foo }} のように整数として使われた場合
+	usageInt
+	// usageFloat は {{ gt .Foo 1.5 }} や {{ printf "%.2f" .Foo }} のように浮動小数点数として使われた場合
+	usageFloat
+	// usageLen は {{ len .Foo }} の引数になった場合
+	usageLen
 )
 
 // fieldRef はテンプレート内でのフィールド参照を表します。
@@ -31,170 +45,778 @@ type fieldRef struct {
 
 // inspection はテンプレートを検査した結果です。
 type inspection struct {
-	refs []fieldRef
+	refs  []fieldRef
+	calls []Call
 }
 
-// inspectCtx は検査中のドットスコープを追跡します。
+// inspectCtx は検査中のドットスコープと変数スコープを追跡します。
 type inspectCtx struct {
-	dot []string
+	dot   []string
+	vars  map[string][]string // 変数名 -> 絶対パス（"$" はルート）
+	set   *Set                // {{ template }} の呼び出し先を解決するためのテンプレートセット
+	calls []string            // 展開中の {{ template }} 呼び出し（再帰の検出用）
 }
 
-func (c inspectCtx) with(prefix []string) inspectCtx {
-	dup := make([]string, len(c.dot))
-	copy(dup, c.dot)
-	return inspectCtx{dot: append(dup, prefix...)}
+// newInspectCtx は dot をルートとする新しいスコープのコンテキストを返します。
+// {{ template }} の呼び出し先では $ も呼び出し時に渡された値を指します。
+func newInspectCtx(set *Set, dot []string, calls []string) inspectCtx {
+	return inspectCtx{
+		dot:   dot,
+		vars:  map[string][]string{"$": dot},
+		set:   set,
+		calls: calls,
+	}
 }
 
-// inspect はテンプレートを検査してフィールド参照を収集します。
-// この段階では型の決定は行わず、どのフィールドがどのように使われたかのみを記録します。
-func inspect(src string) (inspection, error) {
-	tmpl, err := parseTemplateWithDynamicFuncs(src)
-	if err != nil {
-		return inspection{}, fmt.Errorf("failed to parse template: %w", err)
+// scope は変数スコープをコピーしたコンテキストを返します。
+// ブロック内で宣言された変数がブロックの外に漏れないようにするために使います。
+func (c inspectCtx) scope() inspectCtx {
+	vars := make(map[string][]string, len(c.vars))
+	for k, v := range c.vars {
+		vars[k] = v
+	}
+	return inspectCtx{dot: c.dot, vars: vars, set: c.set, calls: c.calls}
+}
+
+// at はドットを絶対パス path に移したコンテキストを返します。
+func (c inspectCtx) at(path []string) inspectCtx {
+	return inspectCtx{dot: path, vars: c.vars, set: c.set, calls: c.calls}
+}
+
+// declare は変数 name を絶対パス path に束縛します。
+// path を解決できなかった場合（ok=false）は、外側の同名変数を隠すため束縛を削除します。
+func (c inspectCtx) declare(name string, path []string, ok bool) {
+	if ok {
+		c.vars[name] = path
+	} else {
+		delete(c.vars, name)
+	}
+}
+
+// resolve は引数ノードが指す絶対パスを返します。
+// フィールド（.Foo）、変数（$x.Foo、$.Foo）、ドット（.）に対応します。
+func (c inspectCtx) resolve(n parse.Node) ([]string, bool) {
+	switch x := n.(type) {
+	case *parse.FieldNode:
+		return joinPath(c.dot, x.Ident), true
+	case *parse.VariableNode:
+		base, ok := c.vars[x.Ident[0]]
+		if !ok {
+			return nil, false
+		}
+		return joinPath(base, x.Ident[1:]), true
+	case *parse.DotNode:
+		return c.dot, true
 	}
-	if tmpl.Tree == nil || tmpl.Tree.Root == nil {
-		return inspection{}, fmt.Errorf("template not found: %s", "tpl")
+	return nil, false
+}
+
+// joinPath は2つのパスを連結した新しいスライスを返します。
+func joinPath(a, b []string) []string {
+	path := make([]string, 0, len(a)+len(b))
+	path = append(path, a...)
+	return append(path, b...)
+}
+
+// inspect は名前付きテンプレートを検査してフィールド参照を収集します。
+// この段階では型の決定は行わず、どのフィールドがどのように使われたかのみを記録します。
+func (s *Set) inspect(name string) (inspection, error) {
+	tree, ok := s.trees[name]
+	if !ok || tree.Root == nil {
+		return inspection{}, fmt.Errorf("template not found: %s", name)
 	}
 
-	var refs []fieldRef
-	collectRefs(tmpl.Tree.Root, &refs, inspectCtx{})
-	return inspection{refs: refs}, nil
+	var insp inspection
+	if err := collectRefs(tree.Root, &insp, newInspectCtx(s, nil, []string{name})); err != nil {
+		return inspection{}, err
+	}
+	return insp, nil
 }
 
 // collectRefs はテンプレート AST を DFS して全フィールド参照を収集します。
-func collectRefs(n parse.Node, refs *[]fieldRef, c inspectCtx) {
+func collectRefs(n parse.Node, insp *inspection, c inspectCtx) error {
 	switch x := n.(type) {
 	case *parse.ListNode:
 		for _, nn := range x.Nodes {
-			collectRefs(nn, refs, c)
+			if err := collectRefs(nn, insp, c); err != nil {
+				return err
+			}
 		}
 
 	case *parse.ActionNode:
-		collectFromPipeRefs(x.Pipe, refs, c, usageLeaf)
+		collectFromPipeRefs(x.Pipe, &insp.refs, c, usageLeaf)
+		collectCalls(x.Pipe, insp, c)
+		// {{ $x := .Foo }} / {{ $x = .Foo }} は以降の兄弟ノードから参照できる
+		declarePipeVars(x.Pipe, c)
+
+	case *parse.TemplateNode:
+		// {{ template "name" .Foo }} は渡したパスの下で呼び出し先を検査する
+		collectFromPipeRefs(x.Pipe, &insp.refs, c, usageLeaf)
+		collectCalls(x.Pipe, insp, c)
+		return collectTemplateCallRefs(x, insp, c)
 
 	case *parse.IfNode:
 		// if のパイプに出るフィールドは存在チェック用途（スコープ基点）
-		base := baseFieldFromPipeNode(x.Pipe)
-		if len(base) > 0 {
-			*refs = append(*refs, fieldRef{
-				path:  append(c.dot, base...),
+		base, ok := basePathFromPipeNode(x.Pipe, c)
+		if ok && len(base) > 0 {
+			insp.refs = append(insp.refs, fieldRef{
+				path:  base,
 				usage: usageScope,
 			})
 		}
-		collectFromPipeRefs(x.Pipe, refs, c, usageLeaf)
+		// if の条件は真偽値として評価される
+		collectFromPipeRefs(x.Pipe, &insp.refs, c, usageBool)
+		collectCalls(x.Pipe, insp, c)
+		// パイプで宣言した変数は if/else の両方から参照できる
+		nc := c.scope()
+		declarePipeVars(x.Pipe, nc)
 		if x.List != nil {
-			collectRefs(x.List, refs, c)
+			if err := collectRefs(x.List, insp, nc.scope()); err != nil {
+				return err
+			}
 		}
 		if x.ElseList != nil {
-			collectRefs(x.ElseList, refs, c)
+			if err := collectRefs(x.ElseList, insp, nc.scope()); err != nil {
+				return err
+			}
 		}
 
 	case *parse.WithNode:
+		collectCalls(x.Pipe, insp, c)
 		// with では基点フィールドがスコープ基点になる
-		base := baseFieldFromPipeNode(x.Pipe)
-		if len(base) > 0 {
-			*refs = append(*refs, fieldRef{
-				path:  append(c.dot, base...),
+		base, ok := basePathFromPipeNode(x.Pipe, c)
+		if ok && len(base) > 0 {
+			insp.refs = append(insp.refs, fieldRef{
+				path:  base,
 				usage: usageScope,
 			})
 		}
-		nc := c
-		if len(base) > 0 {
-			nc = c.with(base)
-		}
+		nc := c.scope()
+		declarePipeVars(x.Pipe, nc)
 		if x.List != nil {
-			collectRefs(x.List, refs, nc)
+			body := nc.scope()
+			if ok {
+				body = body.at(base)
+			}
+			if err := collectRefs(x.List, insp, body); err != nil {
+				return err
+			}
 		}
 		if x.ElseList != nil {
-			collectRefs(x.ElseList, refs, c)
+			if err := collectRefs(x.ElseList, insp, nc.scope()); err != nil {
+				return err
+			}
 		}
 
 	case *parse.RangeNode:
-		base := baseFieldFromPipeNode(x.Pipe)
-		if len(base) > 0 {
-			// 2変数なら map、1変数/0変数なら slice
-			if len(x.Pipe.Decl) == 2 {
-				*refs = append(*refs, fieldRef{
-					path:  append(c.dot, base...),
-					usage: usageRangeMap,
-				})
-			} else {
-				*refs = append(*refs, fieldRef{
-					path:  append(c.dot, base...),
-					usage: usageRange,
-				})
-			}
+		collectCalls(x.Pipe, insp, c)
+		base, ok := basePathFromPipeNode(x.Pipe, c)
+		rangeRef := -1
+		if ok && len(base) > 0 {
+			// 2変数でも基本は slice とし、map かどうかはキーの使われ方を見て後で決める
+			rangeRef = len(insp.refs)
+			insp.refs = append(insp.refs, fieldRef{
+				path:  base,
+				usage: usageRange,
+			})
 		}
-		nc := c
-		if len(base) > 0 {
-			nc = c.with(base)
+		nc := c.scope()
+		if ok {
+			nc = nc.at(base)
+		}
+		// range $v := .Items / range $k, $v := .Items
+		// 値の変数は要素（ドットと同じパス）を指す
+		// キーの変数はフィールドではないが、使われ方を調べるため仮のパスに束縛する
+		keyPath := joinPath(base, []string{rangeKey})
+		switch len(x.Pipe.Decl) {
+		case 1:
+			nc.declare(x.Pipe.Decl[0].Ident[0], base, ok)
+		case 2:
+			nc.declare(x.Pipe.Decl[0].Ident[0], keyPath, rangeRef >= 0)
+			nc.declare(x.Pipe.Decl[1].Ident[0], base, ok)
 		}
 		if x.List != nil {
-			collectRefs(x.List, refs, nc)
+			if err := collectRefs(x.List, insp, nc); err != nil {
+				return err
+			}
+		}
+		// キーが文字列として使われた場合だけ map とする
+		// 例: {{ range $k, $v := .Meta }}{{ $k }}={{ $v }}{{ end }} → Meta は map
+		// 例: {{ range $i, $item := .Items }}{{ if $i }}, {{ end }}{{ $item.Title }}{{ end }} → Items は slice
+		if rangeRef >= 0 && len(x.Pipe.Decl) == 2 && takeRangeKeyRefs(insp, keyPath) {
+			insp.refs[rangeRef].usage = usageRangeMap
 		}
 		if x.ElseList != nil {
-			collectRefs(x.ElseList, refs, c)
+			if err := collectRefs(x.ElseList, insp, c.scope()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rangeKey は range のキー変数を束縛する仮のパス要素です。
+// フィールド名に使えない文字を含むため、実際のフィールドとは衝突しません。
+const rangeKey = "$key"
+
+// takeRangeKeyRefs は range のキー変数（仮のパス key）への参照を insp から取り除き、
+// キーが文字列として使われたか（出力された、または文字列と比較された）を返します。
+// 使われなかったキーや、{{ if $i }} や {{ eq $i 0 }} のように使われたキーはスライスの添字とみなします。
+func takeRangeKeyRefs(insp *inspection, key []string) bool {
+	asString := false
+	refs := insp.refs[:0]
+	for _, ref := range insp.refs {
+		if !hasPathPrefix(ref.path, key) {
+			refs = append(refs, ref)
+			continue
+		}
+		if len(ref.path) == len(key) && ref.usage == usageLeaf {
+			asString = true
+		}
+	}
+	insp.refs = refs
+
+	// キーを渡したカスタム関数の呼び出しは、従来どおり解決できない引数として扱う
+	for i := range insp.calls {
+		for j, a := range insp.calls[i].Args {
+			if a.Kind == ArgField && hasPathPrefix(a.Path, key) {
+				insp.calls[i].Args[j] = Arg{}
+			}
 		}
 	}
+	return asString
+}
+
+// hasPathPrefix は path が prefix で始まるかを返します。
+func hasPathPrefix(path, prefix []string) bool {
+	return len(path) >= len(prefix) && slices.Equal(path[:len(prefix)], prefix)
+}
+
+// collectTemplateCallRefs は {{ template }} の呼び出し先のフィールド参照を、
+// 呼び出し時に渡したパスを基点として収集します。
+// 引数なしの呼び出しや、パスとして解決できない引数の場合は何もしません。
+func collectTemplateCallRefs(x *parse.TemplateNode, insp *inspection, c inspectCtx) error {
+	tree, ok := c.set.trees[x.Name]
+	if !ok {
+		file, line, col := c.set.position(x)
+		return diag.Errorf(diag.CodeUndefinedTemplate, file, line, col, "template %q is not defined", x.Name)
+	}
+
+	// 再帰呼び出しは展開済みのパスと同じ参照しか生まないので打ち切る
+	if slices.Contains(c.calls, x.Name) {
+		return nil
+	}
+
+	if x.Pipe == nil || len(x.Pipe.Cmds) != 1 || len(x.Pipe.Cmds[0].Args) != 1 {
+		return nil
+	}
+	dot, ok := c.resolve(x.Pipe.Cmds[0].Args[0])
+	if !ok || tree.Root == nil {
+		return nil
+	}
+
+	calls := append(slices.Clone(c.calls), x.Name)
+	return collectRefs(tree.Root, insp, newInspectCtx(c.set, dot, calls))
+}
+
+// declarePipeVars はパイプで宣言（または代入）された変数をスコープに登録します。
+// パイプが単一のフィールド・変数・ドットであれば、そのパスに束縛します。
+func declarePipeVars(p *parse.PipeNode, c inspectCtx) {
+	if p == nil || len(p.Decl) == 0 {
+		return
+	}
+
+	var path []string
+	var ok bool
+	if len(p.Cmds) == 1 && len(p.Cmds[0].Args) == 1 {
+		path, ok = c.resolve(p.Cmds[0].Args[0])
+	}
+	for _, v := range p.Decl {
+		c.declare(v.Ident[0], path, ok)
+	}
 }
 
 // collectFromPipeRefs はパイプ内のフィールド参照を収集します。
-func collectFromPipeRefs(p *parse.PipeNode, refs *[]fieldRef, c inspectCtx, defaultUsage usage) {
+// want はパイプの結果がどのように使われるかを表します（if の条件なら usageBool）。
+func collectFromPipeRefs(p *parse.PipeNode, refs *[]fieldRef, c inspectCtx, want usage) {
 	if p == nil {
 		return
 	}
 
+	for i, cmd := range p.Cmds {
+		// {{ .Price | printf "%.2f" }} のように、前段の結果は次段の最後の引数として渡される
+		cmdWant := want
+		if i+1 < len(p.Cmds) {
+			next := p.Cmds[i+1]
+			cmdWant = argUsages(next, usageLeaf)[len(next.Args)]
+		}
+		collectFromCmdRefs(cmd, refs, c, cmdWant)
+	}
+}
+
+// collectFromCmdRefs はコマンド内のフィールド参照を収集します。
+// 組み込み関数の引数は、その引数位置に応じた usage で記録します。
+func collectFromCmdRefs(cmd *parse.CommandNode, refs *[]fieldRef, c inspectCtx, want usage) {
+	if len(cmd.Args) == 0 {
+		return
+	}
+
+	// index .Meta "key" → Meta は usageIndex
+	if len(cmd.Args) >= 2 {
+		if id, ok := cmd.Args[0].(*parse.IdentifierNode); ok && id.Ident == "index" {
+			if path, ok := resolveFieldArg(cmd.Args[1], c); ok {
+				*refs = append(*refs, fieldRef{
+					path:  path,
+					usage: usageIndex,
+				})
+			}
+		}
+	}
+
+	// 関数呼び出しでなければ、コマンドの値そのものがパイプの結果になる
+	usages := map[int]usage{0: want}
+	if _, ok := cmd.Args[0].(*parse.IdentifierNode); ok {
+		usages = argUsages(cmd, want)
+	}
+
+	for i, a := range cmd.Args {
+		// (len .Items) のような入れ子のパイプ
+		if p, ok := a.(*parse.PipeNode); ok {
+			collectFromPipeRefs(p, refs, c, usages[i])
+			continue
+		}
+		if path, ok := resolveFieldArg(a, c); ok {
+			*refs = append(*refs, fieldRef{
+				path:  path,
+				usage: usages[i],
+			})
+		}
+	}
+}
+
+// builtinFuncs は text/template の組み込み関数
+// カスタム関数の呼び出しとしては記録しない
+var builtinFuncs = []string{
+	"and", "call", "html", "index", "slice", "js", "len", "not", "or",
+	"print", "printf", "println", "urlquery",
+	"eq", "ge", "gt", "le", "lt", "ne",
+}
+
+// collectCalls はパイプ内のカスタム関数の呼び出しを収集します。
+// 前段のコマンドの結果は、次段の呼び出しの最後の引数として記録します。
+func collectCalls(p *parse.PipeNode, insp *inspection, c inspectCtx) {
+	if p == nil {
+		return
+	}
+
+	var piped *Arg
 	for _, cmd := range p.Cmds {
-		// index .Meta "key" → Meta は usageIndex
-		if len(cmd.Args) >= 2 {
-			if id, ok := cmd.Args[0].(*parse.IdentifierNode); ok && id.Ident == "index" {
-				if fn, ok := cmd.Args[1].(*parse.FieldNode); ok {
-					*refs = append(*refs, fieldRef{
-						path:  append(c.dot, fn.Ident...),
-						usage: usageIndex,
-					})
+		collectCmdCalls(cmd, piped, insp, c)
+		arg := cmdValue(cmd, c)
+		piped = &arg
+	}
+}
+
+// collectCmdCalls はコマンドと、その引数に含まれるカスタム関数の呼び出しを収集します。
+func collectCmdCalls(cmd *parse.CommandNode, piped *Arg, insp *inspection, c inspectCtx) {
+	if len(cmd.Args) == 0 {
+		return
+	}
+
+	for i, a := range cmd.Args {
+		switch x := a.(type) {
+		case *parse.PipeNode:
+			// (formatDate .CreatedAt) のような入れ子のパイプ
+			collectCalls(x, insp, c)
+		case *parse.IdentifierNode:
+			// 引数の位置にある関数名は、引数なしの呼び出しとして評価される
+			if i > 0 {
+				recordCall(x, nil, insp, c)
+			}
+		}
+	}
+
+	id, ok := cmd.Args[0].(*parse.IdentifierNode)
+	if !ok {
+		return
+	}
+	args := make([]Arg, 0, len(cmd.Args))
+	for _, a := range cmd.Args[1:] {
+		args = append(args, argValue(a, c))
+	}
+	if piped != nil {
+		args = append(args, *piped)
+	}
+	recordCall(id, args, insp, c)
+}
+
+// recordCall は組み込み関数でなければ呼び出しを記録します。
+func recordCall(id *parse.IdentifierNode, args []Arg, insp *inspection, c inspectCtx) {
+	if slices.Contains(builtinFuncs, id.Ident) {
+		return
+	}
+	file, line, col := c.set.position(id)
+	insp.calls = append(insp.calls, Call{Func: id.Ident, Args: args, File: file, Line: line, Col: col})
+}
+
+// usedFuncs はパースツリー全体で使われているカスタム関数の名前を名前順に返します。
+func usedFuncs(trees map[string]*parse.Tree) []string {
+	names := map[string]bool{}
+	for _, tree := range trees {
+		collectFuncNames(tree.Root, names)
+	}
+	return slices.Sorted(maps.Keys(names))
+}
+
+// collectFuncNames はノード以下の関数名（組み込み関数以外）を収集します。
+func collectFuncNames(n parse.Node, names map[string]bool) {
+	switch x := n.(type) {
+	case *parse.ListNode:
+		if x == nil {
+			return
+		}
+		for _, nn := range x.Nodes {
+			collectFuncNames(nn, names)
+		}
+	case *parse.ActionNode:
+		collectFuncNames(x.Pipe, names)
+	case *parse.TemplateNode:
+		collectFuncNames(x.Pipe, names)
+	case *parse.IfNode:
+		collectBranchFuncNames(&x.BranchNode, names)
+	case *parse.WithNode:
+		collectBranchFuncNames(&x.BranchNode, names)
+	case *parse.RangeNode:
+		collectBranchFuncNames(&x.BranchNode, names)
+	case *parse.PipeNode:
+		if x == nil {
+			return
+		}
+		for _, cmd := range x.Cmds {
+			collectFuncNames(cmd, names)
+		}
+	case *parse.CommandNode:
+		for _, a := range x.Args {
+			collectFuncNames(a, names)
+		}
+	case *parse.ChainNode:
+		collectFuncNames(x.Node, names)
+	case *parse.IdentifierNode:
+		if !slices.Contains(builtinFuncs, x.Ident) {
+			names[x.Ident] = true
+		}
+	}
+}
+
+// collectBranchFuncNames は if/with/range のパイプと本体の関数名を収集します。
+func collectBranchFuncNames(x *parse.BranchNode, names map[string]bool) {
+	collectFuncNames(x.Pipe, names)
+	collectFuncNames(x.List, names)
+	collectFuncNames(x.ElseList, names)
+}
+
+// cmdValue はコマンドの結果が何の値かを返します。
+func cmdValue(cmd *parse.CommandNode, c inspectCtx) Arg {
+	if len(cmd.Args) == 0 {
+		return Arg{}
+	}
+	if id, ok := cmd.Args[0].(*parse.IdentifierNode); ok {
+		return Arg{Kind: ArgCall, Func: id.Ident}
+	}
+	if len(cmd.Args) == 1 {
+		return argValue(cmd.Args[0], c)
+	}
+	// .Method arg のような引数付きのメソッド呼び出し
+	return Arg{}
+}
+
+// argValue は関数の引数ノードが何の値かを返します。
+func argValue(n parse.Node, c inspectCtx) Arg {
+	switch x := n.(type) {
+	case *parse.FieldNode, *parse.VariableNode:
+		if path, ok := resolveFieldArg(x, c); ok {
+			return Arg{Kind: ArgField, Path: path}
+		}
+	case *parse.IdentifierNode:
+		return Arg{Kind: ArgCall, Func: x.Ident}
+	case *parse.PipeNode:
+		if len(x.Decl) == 0 && len(x.Cmds) > 0 {
+			return cmdValue(x.Cmds[len(x.Cmds)-1], c)
+		}
+	case *parse.StringNode:
+		return Arg{Kind: ArgString, Text: x.Quoted}
+	case *parse.NumberNode:
+		if x.IsInt || x.IsUint {
+			return Arg{Kind: ArgInt, Text: x.Text}
+		}
+		if x.IsFloat {
+			return Arg{Kind: ArgFloat, Text: x.Text}
+		}
+	case *parse.BoolNode:
+		return Arg{Kind: ArgBool, Text: x.String()}
+	case *parse.NilNode:
+		return Arg{Kind: ArgNil, Text: "nil"}
+	}
+	return Arg{}
+}
+
+// argUsages は組み込み関数呼び出しの各引数位置がどのように使われるかを返します。
+// キーは cmd.Args のインデックスで、len(cmd.Args) はパイプで渡される最後の引数を表します。
+// want は呼び出し結果がどのように使われるかで、and/or の判定に使います。
+// 記録のない位置は usageLeaf（ゼロ値）として扱います。
+func argUsages(cmd *parse.CommandNode, want usage) map[int]usage {
+	usages := map[int]usage{}
+	id, ok := cmd.Args[0].(*parse.IdentifierNode)
+	if !ok {
+		return usages
+	}
+
+	n := len(cmd.Args)
+	switch id.Ident {
+	case "not":
+		for i := 1; i <= n; i++ {
+			usages[i] = usageBool
+		}
+	case "and", "or":
+		// and/or は引数のいずれかをそのまま返す
+		// {{ or .Title "Untitled" }} のようにリテラルと並べた場合はリテラルと同じ型、
+		// {{ printf "%d" (or .A .B) }} のように結果の型が分かる場合はその型とみなし、
+		// それ以外は条件でも {{ and .A .B }} のような出力でも bool とみなす
+		u := usageBool
+		if want != usageBool {
+			if lu, ok := valueLiteralUsage(cmd.Args[1:]); ok {
+				u = lu
+			} else if want != usageLeaf {
+				u = want
+			}
+		}
+		for i := 1; i <= n; i++ {
+			usages[i] = u
+		}
+	case "eq", "ne", "lt", "le", "gt", "ge":
+		// 比較相手のリテラルと同じ型とみなす
+		if u, ok := literalUsage(cmd.Args[1:]); ok {
+			for i := 1; i <= n; i++ {
+				usages[i] = u
+			}
+		}
+	case "len":
+		// len .Items → 長さを持つコレクション
+		for i := 1; i <= n; i++ {
+			usages[i] = usageLen
+		}
+	case "slice":
+		// slice .Items 1 2 → インデックスは整数
+		for i := 2; i < n; i++ {
+			usages[i] = usageInt
+		}
+	case "printf":
+		if n >= 2 {
+			if format, ok := cmd.Args[1].(*parse.StringNode); ok {
+				for i, u := range printfVerbUsages(format.Text) {
+					usages[i+2] = u
 				}
 			}
 		}
-		// 通常のフィールド参照
-		for _, a := range cmd.Args {
-			if f, ok := a.(*parse.FieldNode); ok {
-				*refs = append(*refs, fieldRef{
-					path:  append(c.dot, f.Ident...),
-					usage: defaultUsage,
-				})
+	}
+	return usages
+}
+
+// literalUsage は引数に含まれるリテラルの種類を返します。
+// 数値リテラルは bool リテラルより優先し、浮動小数点数は整数より優先します。
+func literalUsage(args []parse.Node) (usage, bool) {
+	var found []usage
+	for _, a := range args {
+		switch x := a.(type) {
+		case *parse.NumberNode:
+			if isFloatLiteral(x) {
+				found = append(found, usageFloat)
+			} else {
+				found = append(found, usageInt)
 			}
+		case *parse.BoolNode:
+			found = append(found, usageBool)
+		}
+	}
+	for _, u := range []usage{usageFloat, usageInt, usageBool} {
+		if slices.Contains(found, u) {
+			return u, true
 		}
 	}
+	return usageLeaf, false
+}
+
+// valueLiteralUsage は literalUsage に加えて文字列リテラルも考慮します。
+// 文字列リテラルがあれば usageLeaf を返します。
+func valueLiteralUsage(args []parse.Node) (usage, bool) {
+	if u, ok := literalUsage(args); ok {
+		return u, true
+	}
+	for _, a := range args {
+		if _, ok := a.(*parse.StringNode); ok {
+			return usageLeaf, true
+		}
+	}
+	return usageLeaf, false
+}
+
+// isFloatLiteral は数値リテラルが実行時に float64 として評価されるかを返します。
+// text/template は 1.0 や 1e3 のように小数点や指数を含むリテラルを float64 として扱います。
+func isFloatLiteral(n *parse.NumberNode) bool {
+	if !n.IsFloat || n.IsComplex {
+		return false
+	}
+	text := n.Text
+	if strings.HasPrefix(text, "0x") || strings.HasPrefix(text, "0X") || strings.HasPrefix(text, "'") {
+		return false
+	}
+	return strings.ContainsAny(text, ".eEpP")
 }
 
-// baseFieldFromPipeNode はパイプ内で最初に現れるフィールドノードの識別子スライスを返します。
-func baseFieldFromPipeNode(p *parse.PipeNode) []string {
+// printfVerbUsages は printf の書式文字列から、各引数の使われ方を順に返します。
+// %[2]d のような引数インデックスを含む書式は対応づけできないため nil を返します。
+func printfVerbUsages(format string) []usage {
+	var usages []usage
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+
+		// フラグ・幅・精度（* は整数の引数を消費する）
+		for ; i < len(format); i++ {
+			ch := format[i]
+			if ch == '[' {
+				return nil
+			}
+			if ch == '*' {
+				usages = append(usages, usageInt)
+				continue
+			}
+			if !strings.ContainsRune("+-# 0123456789.", rune(ch)) {
+				break
+			}
+		}
+		if i >= len(format) {
+			break
+		}
+
+		switch format[i] {
+		case '%':
+			// %% は引数を消費しない
+		case 'd', 'c', 'U':
+			usages = append(usages, usageInt)
+		case 'e', 'E', 'f', 'F', 'g', 'G':
+			usages = append(usages, usageFloat)
+		case 't':
+			usages = append(usages, usageBool)
+		default:
+			usages = append(usages, usageLeaf)
+		}
+	}
+	return usages
+}
+
+// resolveFieldArg はフィールドを参照する引数（.Foo、$x.Foo）の絶対パスを返します。
+// ドットや変数そのもの（{{ . }}、{{ $x }}）はフィールド参照として扱いません。
+func resolveFieldArg(n parse.Node, c inspectCtx) ([]string, bool) {
+	switch x := n.(type) {
+	case *parse.FieldNode:
+		return c.resolve(x)
+	case *parse.VariableNode:
+		if len(x.Ident) > 1 {
+			return c.resolve(x)
+		}
+		// 単独の変数は、range のキーの使われ方を調べるときだけ参照として扱う
+		if path, ok := c.resolve(x); ok && len(path) > 0 && path[len(path)-1] == rangeKey {
+			return path, true
+		}
+	}
+	return nil, false
+}
+
+// basePathFromPipeNode はパイプ内で最初に現れるフィールド（または変数）の絶対パスを返します。
+func basePathFromPipeNode(p *parse.PipeNode, c inspectCtx) ([]string, bool) {
 	if p == nil {
-		return nil
+		return nil, false
 	}
 
 	for _, cmd := range p.Cmds {
 		for _, a := range cmd.Args {
-			if f, ok := a.(*parse.FieldNode); ok && len(f.Ident) > 0 {
-				return f.Ident
+			switch x := a.(type) {
+			case *parse.FieldNode:
+				if len(x.Ident) > 0 {
+					return c.resolve(x)
+				}
+			case *parse.VariableNode:
+				if path, ok := c.resolve(x); ok {
+					return path, true
+				}
+			case *parse.DotNode:
+				// {{ template }} の呼び出し先で {{ range . }} のように使われる場合
+				return c.resolve(x)
 			}
 		}
 	}
 
-	return nil
+	return nil, false
+}
+
+// position はノードの位置をファイルパスと1始まりの行・列で返します。
+func (s *Set) position(n parse.Node) (file string, line, col int) {
+	// ErrorContext はノード自身のパースツリーを使うので、レシーバのツリーは何でもよい
+	location, _ := new(parse.Tree).ErrorContext(n)
+
+	// location は "<Source 名>:<行>:<行頭からのバイト数>" の形式
+	rest, colStr, _ := cutLast(location, ":")
+	name, lineStr, _ := cutLast(rest, ":")
+	line, _ = strconv.Atoi(lineStr)
+	col, _ = strconv.Atoi(colStr)
+	return s.files[name], line, col + 1
+}
+
+// cutLast は s を最後の sep で分割します。
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// parseTrees はテンプレートをパースし、テンプレート本体と {{ define }} で定義された
+// 名前付きテンプレートのパースツリーを名前ごとに返します。
+func parseTrees(name string, src string, funcs []string) (map[string]*parse.Tree, error) {
+	tmpl, err := parseTemplateWithDynamicFuncs(name, src, funcs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	trees := make(map[string]*parse.Tree)
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			trees[t.Name()] = t.Tree
+		}
+	}
+	if trees[name] == nil {
+		return nil, fmt.Errorf("template not found: %s", name)
+	}
+	return trees, nil
 }
 
 // parseTemplateWithDynamicFuncs はテンプレートをパースし、未定義関数があれば動的にダミー関数を追加してリトライします。
-func parseTemplateWithDynamicFuncs(src string) (*template.Template, error) {
+// names は WithFuncNames で指定された関数名で、プリセットと同じくダミー関数として最初から登録します。
+func parseTemplateWithDynamicFuncs(name string, src string, names []string) (*template.Template, error) {
 	funcs := dummyFuncMap()
+	for _, n := range names {
+		funcs[n] = dummyFunc
+	}
 	var tmpl *template.Template
 	var err error
 
 	// 未定義関数エラーの場合、関数名を抽出してダミー関数を追加し、最大10回リトライ
 	maxRetries := 10
 	for i := 0; i <= maxRetries; i++ {
-		tmpl, err = template.New("tpl").Funcs(funcs).Parse(src)
+		tmpl, err = template.New(name).Funcs(funcs).Parse(src)
 		if err == nil {
 			break
 		}
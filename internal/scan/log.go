@@ -74,6 +74,14 @@ func usageString(u usage) string {
 		return "index"
 	case usageScope:
 		return "scope"
+	case usageBool:
+		return "bool"
+	case usageInt:
+		return "int"
+	case usageFloat:
+		return "float"
+	case usageLen:
+		return "len"
 	default:
 		return "unknown"
 	}
@@ -90,6 +98,12 @@ func kindString(k Kind) string {
 		return "Slice"
 	case KindMap:
 		return "Map"
+	case KindBool:
+		return "Bool"
+	case KindInt:
+		return "Int"
+	case KindFloat:
+		return "Float"
 	default:
 		return "Unknown"
 	}
@@ -1,6 +1,13 @@
 package scan
 
-import "sort"
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+
+	"github.com/bellwood4486/tmpltype/internal/diag"
+)
 
 // Kind は推論されたフィールド種別を表します。
 type Kind int
@@ -10,6 +17,9 @@ const (
 	KindStruct
 	KindSlice
 	KindMap
+	KindBool
+	KindInt
+	KindFloat
 )
 
 // Field は推論スキーマ木のノードです。
@@ -23,25 +33,185 @@ type Field struct {
 // Schema はトップレベル（Params直下）のフィールド集合です。
 type Schema struct {
 	Fields map[string]*Field
+	Calls  []Call // カスタム関数の呼び出し（出現順）
 }
 
-// ScanTemplate は Go テンプレートを AST 解析して、.(ドット）スコープを追跡して
-// フィールド参照からスキーマ木を推論します。
-// 既定では葉はすべて string として扱い、 range は []struct{} (子フィールドがあれば) または []string (なければ),
-// index は map[string]string を推論します。
-func ScanTemplate(src string) (Schema, error) {
-	insp, err := inspect(src)
+// ArgKind はカスタム関数に渡された引数の種類です。
+type ArgKind int
+
+const (
+	ArgUnknown ArgKind = iota // 型が分からない値（ドット・変数・メソッド呼び出しなど）
+	ArgField                  // フィールド参照（Path）
+	ArgCall                   // 別の関数呼び出しの結果（Func）
+	ArgString                 // 文字列リテラル
+	ArgInt                    // 整数として評価できる数値リテラル
+	ArgFloat                  // 整数でない数値リテラル
+	ArgBool                   // true / false
+	ArgNil                    // nil
+)
+
+// Arg はカスタム関数に渡された引数です。
+type Arg struct {
+	Kind ArgKind
+	Path []string // ArgField の場合の絶対パス
+	Func string   // ArgCall の場合の関数名
+	Text string   // リテラルの場合のテンプレート上の表記
+}
+
+// Call はテンプレート内でのカスタム関数（組み込み関数以外）の呼び出しです。
+// 引数は {{ .Title | upper }} のようにパイプで渡される値を最後に含みます。
+type Call struct {
+	Func string
+	Args []Arg
+	File string // 呼び出しを含むテンプレートファイルのパス
+	Line int    // 1始まりの行番号
+	Col  int    // 1始まりの列番号（バイト単位）
+}
+
+// Source はテンプレートセットを構成する1つのテンプレートです。
+type Source struct {
+	Name string // テンプレート名（{{ template "name" }} で呼び出すときの名前）
+	Src  string // テンプレート本文
+	File string // テンプレートファイルのパス（診断メッセージの位置に使用、空でもよい）
+}
+
+// Define は {{ define }} や {{ block }} で定義された名前付きテンプレートです。
+type Define struct {
+	Name   string // 定義名（例: "header"）
+	Source string // 定義を含む Source の名前
+}
+
+// Set は複数のテンプレートを1つの共有テンプレートセットとしてパースしたものです。
+// {{ template "name" .Foo }} の呼び出しは、セット内のどのテンプレートの定義でも解決されます。
+type Set struct {
+	trees   map[string]*parse.Tree
+	defines []Define
+	files   map[string]string   // Source 名 -> ファイルパス
+	funcs   map[string][]string // Source 名 -> パースに必要なカスタム関数の名前
+}
+
+// Option は NewSet の設定を変更します。
+type Option func(*setOptions)
+
+// setOptions は NewSet の設定です。
+type setOptions struct {
+	funcs []string // テンプレートから呼び出せるカスタム関数の名前
+}
+
+// WithFuncNames はテンプレートから呼び出せるカスタム関数の名前を指定します。
+// 指定しない場合も、未定義の関数はパース時にダミー関数として補われます。
+func WithFuncNames(names ...string) Option {
+	return func(o *setOptions) {
+		o.funcs = append(o.funcs, names...)
+	}
+}
+
+// NewSet はテンプレートをパースして共有テンプレートセットを作成します。
+// 同じ名前のテンプレートが複数定義されている場合はエラーになります。
+func NewSet(srcs []Source, opts ...Option) (*Set, error) {
+	o := &setOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	set := &Set{trees: map[string]*parse.Tree{}, files: map[string]string{}, funcs: map[string][]string{}}
+	owners := map[string]int{} // テンプレート名 -> 定義元の Source の添字
+
+	for i, src := range srcs {
+		if owner, ok := owners[src.Name]; ok {
+			return nil, diag.Errorf(diag.CodeDuplicateTemplate, src.File, 0, 0, "template %q is defined in both %s and %s", src.Name, sourceLabel(srcs, owner), sourceLabel(srcs, i))
+		}
+		owners[src.Name] = i
+		set.files[src.Name] = src.File
+	}
+
+	for i, src := range srcs {
+		trees, err := parseTrees(src.Name, src.Src, o.funcs)
+		if err != nil {
+			return nil, parseDiagnostic(src, err)
+		}
+
+		for name, tree := range trees {
+			if name != src.Name {
+				if owner, ok := owners[name]; ok {
+					return nil, diag.Errorf(diag.CodeDuplicateTemplate, src.File, 0, 0, "template %q is defined in both %s and %s", name, sourceLabel(srcs, owner), sourceLabel(srcs, i))
+				}
+				owners[name] = i
+				set.defines = append(set.defines, Define{Name: name, Source: src.Name})
+			}
+			set.trees[name] = tree
+		}
+		set.funcs[src.Name] = usedFuncs(trees)
+	}
+
+	sort.Slice(set.defines, func(i, j int) bool {
+		return set.defines[i].Name < set.defines[j].Name
+	})
+
+	return set, nil
+}
+
+// sourceLabel はエラーメッセージで srcs[i] を示す文字列を返します。
+// ファイルパスがあればそれを、なければ同名の Source とも区別できるよう番号と名前を使います。
+func sourceLabel(srcs []Source, i int) string {
+	if srcs[i].File != "" {
+		return srcs[i].File
+	}
+	return "inline source #" + strconv.Itoa(i+1) + " (" + srcs[i].Name + ")"
+}
+
+// parseDiagnostic はパースエラーを行番号付きの Diagnostic に変換します。
+// text/template のパースエラーは "template: <name>:<line>: <message>" の形式で、列番号は含まれません。
+func parseDiagnostic(src Source, err error) *diag.Diagnostic {
+	msg := err.Error()
+	prefix := "template: " + src.Name + ":"
+	if i := strings.Index(msg, prefix); i >= 0 {
+		lineStr, text, ok := strings.Cut(msg[i+len(prefix):], ": ")
+		if line, convErr := strconv.Atoi(lineStr); ok && convErr == nil {
+			return diag.Errorf(diag.CodeParse, src.File, line, 0, "%s", text)
+		}
+	}
+	return diag.Errorf(diag.CodeParse, src.File, 0, 0, "%s", msg)
+}
+
+// Defines は {{ define }} / {{ block }} で定義された名前付きテンプレートを名前順に返します。
+func (s *Set) Defines() []Define {
+	return s.defines
+}
+
+// Funcs は Source をパースするのに必要なカスタム関数（組み込み関数以外）の名前を名前順に返します。
+// 呼び出されない {{ define }} の中で使われる関数も含みます（パース時に未定義だとエラーになるため）。
+func (s *Set) Funcs(name string) []string {
+	return s.funcs[name]
+}
+
+// Scan は名前付きテンプレート（Source または Define）のスキーマを推論します。
+// {{ template }} で呼び出したテンプレートのフィールド参照は、渡したパスの下にマージされます。
+func (s *Set) Scan(name string) (Schema, error) {
+	insp, err := s.inspect(name)
 	if err != nil {
 		return Schema{}, err
 	}
 	logInspection(insp)
 
 	schema := buildSchema(insp)
+	schema.Calls = insp.calls
 	logSchema(schema)
 
 	return schema, nil
 }
 
+// ScanTemplate は Go テンプレートを AST 解析して、.(ドット）スコープを追跡して
+// フィールド参照からスキーマ木を推論します。
+// 既定では葉は string として扱い（比較・論理演算・printf の引数として使われた場合は bool/int/float）、 range は []struct{} (子フィールドがあれば) または []string (なければ),
+// index は map[string]string を推論します。
+func ScanTemplate(src string) (Schema, error) {
+	set, err := NewSet([]Source{{Name: "tpl", Src: src}})
+	if err != nil {
+		return Schema{}, err
+	}
+	return set.Scan("tpl")
+}
+
 // logInspection は inspection の内容をログ出力します。
 func logInspection(insp inspection) {
 	logRefCount(len(insp.refs))
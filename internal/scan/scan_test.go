@@ -1,6 +1,9 @@
 package scan_test
 
 import (
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/bellwood4486/tmpltype/internal/scan"
@@ -168,8 +171,8 @@ func TestScanTemplate_Range_OneVariable_MakesSlice(t *testing.T) {
 }
 
 func TestScanTemplate_Range_MapWithStructValue(t *testing.T) {
-	// range $key, $value := .Users でドット参照 → map[string]struct{Name, Age string}
-	src := `{{ range $key, $value := .Users }}{{ .Name }}{{ .Age }}{{ end }}`
+	// range $key, $value := .Users でキーを出力し、ドット参照 → map[string]struct{Name, Age string}
+	src := `{{ range $key, $value := .Users }}{{ $key }}: {{ .Name }}{{ .Age }}{{ end }}`
 	sch, err := scan.ScanTemplate(src)
 	if err != nil {
 		t.Fatal(err)
@@ -225,6 +228,343 @@ func TestScanTemplate_IfPipeLine_fieldAndChild(t *testing.T) {
 	assertKind(t, name, scan.KindString)
 }
 
+func TestScanTemplate_Compare_NumberLiteralMakesInt(t *testing.T) {
+	src := `
+{{ if eq .Count 0 }}none{{ else }}{{ .Count }}{{ end }}
+{{ if gt .User.Age 18 }}adult{{ end }}
+`
+	sch, err := scan.ScanTemplate(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertKind(t, getTop(t, sch, "Count"), scan.KindInt)
+	user := getTop(t, sch, "User")
+	assertKind(t, user, scan.KindStruct)
+	assertKind(t, getChild(t, user, "Age"), scan.KindInt)
+}
+
+func TestScanTemplate_Compare_FloatLiteralMakesFloat(t *testing.T) {
+	src := `{{ if ge .Score 0.5 }}pass{{ end }}{{ if lt .Ratio 1e3 }}ok{{ end }}`
+	sch, err := scan.ScanTemplate(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertKind(t, getTop(t, sch, "Score"), scan.KindFloat)
+	assertKind(t, getTop(t, sch, "Ratio"), scan.KindFloat)
+}
+
+func TestScanTemplate_Compare_StringLiteralStaysString(t *testing.T) {
+	src := `{{ if eq .Status "active" }}on{{ end }}{{ if eq .A .B }}same{{ end }}`
+	sch, err := scan.ScanTemplate(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertKind(t, getTop(t, sch, "Status"), scan.KindString)
+	assertKind(t, getTop(t, sch, "A"), scan.KindString)
+	assertKind(t, getTop(t, sch, "B"), scan.KindString)
+}
+
+func TestScanTemplate_BoolContext(t *testing.T) {
+	src := `
+{{ if .Enabled }}on{{ end }}
+{{ if not .Hidden }}shown{{ end }}
+{{ if and .A (or .B .C) }}all{{ end }}
+{{ if .Message }}{{ .Message }}{{ end }}
+{{ or .Title "Untitled" }}
+`
+	sch, err := scan.ScanTemplate(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"Enabled", "Hidden", "A", "B", "C"} {
+		assertKind(t, getTop(t, sch, name), scan.KindBool)
+	}
+	// 値として出力されるフィールドは string のまま
+	assertKind(t, getTop(t, sch, "Message"), scan.KindString)
+	assertKind(t, getTop(t, sch, "Title"), scan.KindString)
+}
+
+func TestScanTemplate_AndOrOutput(t *testing.T) {
+	src := `
+{{ and .A .B }}
+{{ or .Count 0 }}
+{{ printf "%d" (or .X .Y) }}
+{{ or .Nickname .Name }} {{ .Name }}
+`
+	sch, err := scan.ScanTemplate(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 出力される and/or の引数も、リテラルや他の使われ方がなければ bool
+	assertKind(t, getTop(t, sch, "A"), scan.KindBool)
+	assertKind(t, getTop(t, sch, "B"), scan.KindBool)
+	assertKind(t, getTop(t, sch, "Nickname"), scan.KindBool)
+	// リテラルや呼び出し結果の型があればその型、値として出力されるフィールドは string
+	assertKind(t, getTop(t, sch, "Count"), scan.KindInt)
+	assertKind(t, getTop(t, sch, "X"), scan.KindInt)
+	assertKind(t, getTop(t, sch, "Y"), scan.KindInt)
+	assertKind(t, getTop(t, sch, "Name"), scan.KindString)
+}
+
+func TestScanTemplate_Printf_VerbsMakeTypes(t *testing.T) {
+	src := `
+{{ printf "%d items, %.2f total, %t, %s" .Count .Total .Paid .Name }}
+{{ .Price | printf "%8.3f" }}
+{{ printf "%*d" .Width .Num }}
+`
+	sch, err := scan.ScanTemplate(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertKind(t, getTop(t, sch, "Count"), scan.KindInt)
+	assertKind(t, getTop(t, sch, "Total"), scan.KindFloat)
+	assertKind(t, getTop(t, sch, "Paid"), scan.KindBool)
+	assertKind(t, getTop(t, sch, "Name"), scan.KindString)
+	assertKind(t, getTop(t, sch, "Price"), scan.KindFloat)
+	assertKind(t, getTop(t, sch, "Width"), scan.KindInt)
+	assertKind(t, getTop(t, sch, "Num"), scan.KindInt)
+}
+
+func TestScanTemplate_NestedPipe_LenAndSlice(t *testing.T) {
+	src := `
+{{ if eq (len .Items) 0 }}empty{{ end }}
+{{ range .Items }}{{ .Title }}{{ end }}
+{{ slice .Body 0 .Limit }}
+`
+	sch, err := scan.ScanTemplate(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// len の引数は比較リテラルの影響を受けない
+	assertKind(t, getTop(t, sch, "Items"), scan.KindSlice)
+	assertKind(t, getTop(t, sch, "Body"), scan.KindString)
+	assertKind(t, getTop(t, sch, "Limit"), scan.KindInt)
+}
+
+func TestScanTemplate_Len_MakesCollection(t *testing.T) {
+	src := `
+{{ if gt (len .Items) 0 }}items{{ end }}
+{{ .Tags | len }}
+{{ len .Meta }}{{ index .Meta "author" }}
+{{ .Title }} ({{ len .Title }})
+`
+	sch, err := scan.ScanTemplate(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// len の引数はスライス、index もあればマップ、値として出力もされるなら文字列の長さとみなす
+	items := getTop(t, sch, "Items")
+	assertKind(t, items, scan.KindSlice)
+	if items.Elem == nil {
+		t.Fatal("Items.Elem is nil")
+	}
+	assertKind(t, items.Elem, scan.KindString)
+	assertKind(t, getTop(t, sch, "Tags"), scan.KindSlice)
+	assertKind(t, getTop(t, sch, "Meta"), scan.KindMap)
+	assertKind(t, getTop(t, sch, "Title"), scan.KindString)
+}
+
+func TestScanTemplate_Variable_AssignedField(t *testing.T) {
+	src := `{{ $u := .User }}{{ $u.Name }}`
+	sch, err := scan.ScanTemplate(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := getTop(t, sch, "User")
+	assertKind(t, user, scan.KindStruct)
+	name := getChild(t, user, "Name")
+	assertKind(t, name, scan.KindString)
+}
+
+func TestScanTemplate_Variable_RangeKeyValue(t *testing.T) {
+	src := `{{ range $i, $item := .Items }}{{ $item.Title }}{{ end }}`
+	sch, err := scan.ScanTemplate(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2変数の range でもキーを文字列として使わなければスライスとして推論し、値の変数は要素を指す
+	items := getTop(t, sch, "Items")
+	assertKind(t, items, scan.KindSlice)
+	if items.Elem == nil {
+		t.Fatal("Items.Elem is nil")
+	}
+	assertKind(t, items.Elem, scan.KindStruct)
+	title := getChild(t, items.Elem, "Title")
+	assertKind(t, title, scan.KindString)
+}
+
+func TestScanTemplate_Variable_RangeKeyUsage(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want scan.Kind
+	}{
+		{name: "unused key", src: `{{ range $i, $v := .X }}{{ $v }}{{ end }}`, want: scan.KindSlice},
+		{name: "key as condition", src: `{{ range $i, $v := .X }}{{ if $i }}, {{ end }}{{ $v }}{{ end }}`, want: scan.KindSlice},
+		{name: "key compared with number", src: `{{ range $i, $v := .X }}{{ if eq $i 0 }}first{{ end }}{{ end }}`, want: scan.KindSlice},
+		{name: "key printed", src: `{{ range $k, $v := .X }}{{ $k }}={{ $v }}{{ end }}`, want: scan.KindMap},
+		{name: "key compared with string", src: `{{ range $k, $v := .X }}{{ if eq $k "draft" }}{{ $v }}{{ end }}{{ end }}`, want: scan.KindMap},
+		{name: "key piped to printf", src: `{{ range $k, $v := .X }}{{ $k | printf "%s" }}{{ end }}`, want: scan.KindMap},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sch, err := scan.ScanTemplate(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			x := getTop(t, sch, "X")
+			assertKind(t, x, tt.want)
+			// キーの変数はフィールドとして現れない
+			if x.Elem != nil && len(x.Elem.Children) > 0 {
+				t.Errorf("unexpected element fields: %v", x.Elem.Children)
+			}
+		})
+	}
+}
+
+func TestScanTemplate_Variable_RangeValueOnly(t *testing.T) {
+	src := `{{ range $item := .Items }}{{ $item.Title }}{{ end }}`
+	sch, err := scan.ScanTemplate(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items := getTop(t, sch, "Items")
+	assertKind(t, items, scan.KindSlice)
+	title := getChild(t, items.Elem, "Title")
+	assertKind(t, title, scan.KindString)
+}
+
+func TestScanTemplate_Variable_RootInsideRange(t *testing.T) {
+	// $ は常にルートを指す
+	src := `{{ range .Items }}{{ .Title }}{{ $.SiteName }}{{ end }}`
+	sch, err := scan.ScanTemplate(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	site := getTop(t, sch, "SiteName")
+	assertKind(t, site, scan.KindString)
+	items := getTop(t, sch, "Items")
+	if _, ok := items.Elem.Children["SiteName"]; ok {
+		t.Error("SiteName should not be a child of Items element")
+	}
+}
+
+func TestScanTemplate_Variable_NestedAndWith(t *testing.T) {
+	src := `
+{{ $s := .Section }}
+{{ with $c := $s.Config }}{{ $c.Mode }}{{ .Level }}{{ end }}
+{{ range $s.Items }}{{ .Title }}{{ end }}
+`
+	sch, err := scan.ScanTemplate(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	section := getTop(t, sch, "Section")
+	config := getChild(t, section, "Config")
+	assertKind(t, config, scan.KindStruct)
+	assertKind(t, getChild(t, config, "Mode"), scan.KindString)
+	assertKind(t, getChild(t, config, "Level"), scan.KindString)
+	items := getChild(t, section, "Items")
+	assertKind(t, items, scan.KindSlice)
+	assertKind(t, getChild(t, items.Elem, "Title"), scan.KindString)
+}
+
+func TestScanTemplate_Variable_ScopeEndsWithBlock(t *testing.T) {
+	// ブロック内で宣言した変数はブロックの外では参照できない（外側の変数が見える）
+	src := `
+{{ $x := .Outer }}
+{{ range $x := .Items }}{{ $x.Title }}{{ end }}
+{{ $x.Name }}
+`
+	sch, err := scan.ScanTemplate(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outer := getTop(t, sch, "Outer")
+	assertKind(t, getChild(t, outer, "Name"), scan.KindString)
+	items := getTop(t, sch, "Items")
+	assertKind(t, getChild(t, items.Elem, "Title"), scan.KindString)
+	if _, ok := outer.Children["Title"]; ok {
+		t.Error("Title should not be a child of Outer")
+	}
+}
+
+func TestScanTemplate_Variable_IndexOnVariable(t *testing.T) {
+	src := `{{ $cfg := .Config }}{{ index $cfg.Meta "env" }}`
+	sch, err := scan.ScanTemplate(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := getTop(t, sch, "Config")
+	meta := getChild(t, config, "Meta")
+	assertKind(t, meta, scan.KindMap)
+}
+
+func TestScanTemplate_Calls(t *testing.T) {
+	src := `{{ formatDate .CreatedAt }}
+{{ .Title | upper }}
+{{ range .Items }}{{ add .Price 1 }}{{ end }}
+{{ upper (formatDate .CreatedAt) }}
+{{ printf "%d" .Count }}`
+	sch, err := scan.ScanTemplate(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []scan.Call{
+		{Func: "formatDate", Args: []scan.Arg{{Kind: scan.ArgField, Path: []string{"CreatedAt"}}}, Line: 1, Col: 4},
+		{Func: "upper", Args: []scan.Arg{{Kind: scan.ArgField, Path: []string{"Title"}}}, Line: 2, Col: 13},
+		{Func: "add", Args: []scan.Arg{{Kind: scan.ArgField, Path: []string{"Items", "Price"}}, {Kind: scan.ArgInt, Text: "1"}}, Line: 3, Col: 22},
+		{Func: "formatDate", Args: []scan.Arg{{Kind: scan.ArgField, Path: []string{"CreatedAt"}}}, Line: 4, Col: 11},
+		{Func: "upper", Args: []scan.Arg{{Kind: scan.ArgCall, Func: "formatDate"}}, Line: 4, Col: 4},
+	}
+	if !reflect.DeepEqual(sch.Calls, want) {
+		t.Fatalf("calls mismatch:\n got=%+v\nwant=%+v", sch.Calls, want)
+	}
+}
+
+func TestNewSet_WithFuncNames(t *testing.T) {
+	// プリセットにない関数が多くても、名前を指定すればリトライせずにパースできる
+	var src strings.Builder
+	var names []string
+	for i := range 20 {
+		name := fmt.Sprintf("fn%d", i)
+		names = append(names, name)
+		fmt.Fprintf(&src, "{{ %s .Title }}", name)
+	}
+	sources := []scan.Source{{Name: "page", Src: src.String()}}
+
+	if _, err := scan.NewSet(sources); err == nil {
+		t.Fatal("expected an error without function names")
+	}
+	set, err := scan.NewSet(sources, scan.WithFuncNames(names...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sch, err := set.Scan("page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sch.Calls) != len(names) {
+		t.Fatalf("got %d calls, want %d", len(sch.Calls), len(names))
+	}
+}
+
 func getTop(t *testing.T, s scan.Schema, name string) *scan.Field {
 	t.Helper()
 	f := s.Fields[name]
@@ -0,0 +1,225 @@
+package scan_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bellwood4486/tmpltype/internal/diag"
+	"github.com/bellwood4486/tmpltype/internal/scan"
+)
+
+func TestSet_TemplateCall_MergesCalleeAtPath(t *testing.T) {
+	set, err := scan.NewSet([]scan.Source{
+		{Name: "page", Src: `{{ template "user_card" .Author }}{{ .Title }}`},
+		{Name: "partials", Src: `{{ define "user_card" }}{{ .Name }} <{{ .Email }}>{{ end }}`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sch, err := set.Scan("page")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	author := getTop(t, sch, "Author")
+	assertKind(t, author, scan.KindStruct)
+	assertKind(t, getChild(t, author, "Name"), scan.KindString)
+	assertKind(t, getChild(t, author, "Email"), scan.KindString)
+	assertKind(t, getTop(t, sch, "Title"), scan.KindString)
+}
+
+func TestSet_TemplateCall_FileTemplateByName(t *testing.T) {
+	// ファイル自体も {{ template "name" }} で呼び出せる
+	set, err := scan.NewSet([]scan.Source{
+		{Name: "page", Src: `{{ range .Items }}{{ template "item" . }}{{ end }}`},
+		{Name: "item", Src: `<li>{{ .Title }}</li>`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sch, err := set.Scan("page")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items := getTop(t, sch, "Items")
+	assertKind(t, items, scan.KindSlice)
+	assertKind(t, getChild(t, items.Elem, "Title"), scan.KindString)
+}
+
+func TestSet_TemplateCall_RangeOverDotInCallee(t *testing.T) {
+	set, err := scan.NewSet([]scan.Source{
+		{Name: "page", Src: `{{ template "list" .Tags }}`},
+		{Name: "list", Src: `{{ range . }}{{ .Label }}{{ end }}`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sch, err := set.Scan("page")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tags := getTop(t, sch, "Tags")
+	assertKind(t, tags, scan.KindSlice)
+	assertKind(t, getChild(t, tags.Elem, "Label"), scan.KindString)
+}
+
+func TestSet_Block_DefinesAndCalls(t *testing.T) {
+	set, err := scan.NewSet([]scan.Source{
+		{Name: "layout", Src: `{{ block "sidebar" .Nav }}{{ .Home }}{{ end }}`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defines := set.Defines()
+	if len(defines) != 1 || defines[0].Name != "sidebar" || defines[0].Source != "layout" {
+		t.Fatalf("unexpected defines: %+v", defines)
+	}
+
+	layout, err := set.Scan("layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nav := getTop(t, layout, "Nav")
+	assertKind(t, getChild(t, nav, "Home"), scan.KindString)
+
+	// 定義されたテンプレート自体のスキーマはドットをルートとする
+	sidebar, err := set.Scan("sidebar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertKind(t, getTop(t, sidebar, "Home"), scan.KindString)
+}
+
+func TestSet_TemplateCall_Recursive(t *testing.T) {
+	set, err := scan.NewSet([]scan.Source{
+		{Name: "tree", Src: `{{ define "node" }}{{ .Name }}{{ range .Children }}{{ template "node" . }}{{ end }}{{ end }}{{ template "node" .Root }}`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sch, err := set.Scan("tree")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := getTop(t, sch, "Root")
+	assertKind(t, getChild(t, root, "Name"), scan.KindString)
+	assertKind(t, getChild(t, root, "Children"), scan.KindSlice)
+}
+
+func TestSet_TemplateCall_Undefined(t *testing.T) {
+	set, err := scan.NewSet([]scan.Source{
+		{Name: "page", Src: `{{ template "missing" . }}`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = set.Scan("page")
+	if err == nil || !strings.Contains(err.Error(), `template "missing" is not defined`) {
+		t.Fatalf("expected undefined template error, got %v", err)
+	}
+}
+
+func TestNewSet_DuplicateDefine(t *testing.T) {
+	_, err := scan.NewSet([]scan.Source{
+		{Name: "a", Src: `{{ define "header" }}A{{ end }}`},
+		{Name: "b", Src: `{{ define "header" }}B{{ end }}`},
+	})
+	if err == nil || !strings.Contains(err.Error(), `template "header" is defined in both inline source #1 (a) and inline source #2 (b)`) {
+		t.Fatalf("expected duplicate define error, got %v", err)
+	}
+}
+
+func TestNewSet_DuplicateDefine_FileNames(t *testing.T) {
+	_, err := scan.NewSet([]scan.Source{
+		{Name: "a", File: "templates/a.tmpl", Src: `{{ define "header" }}A{{ end }}`},
+		{Name: "b", File: "templates/b.tmpl", Src: `{{ define "header" }}B{{ end }}`},
+	})
+	want := `templates/b.tmpl: error: template "header" is defined in both templates/a.tmpl and templates/b.tmpl`
+	if err == nil || err.Error() != want {
+		t.Fatalf("expected %q, got %v", want, err)
+	}
+}
+
+func TestNewSet_DuplicateSourceName(t *testing.T) {
+	_, err := scan.NewSet([]scan.Source{
+		{Name: "footer", File: "shared/footer.tmpl", Src: `shared`},
+		{Name: "footer", File: "feature/footer.tmpl", Src: `feature`},
+	})
+	want := `feature/footer.tmpl: error: template "footer" is defined in both shared/footer.tmpl and feature/footer.tmpl`
+	if err == nil || err.Error() != want {
+		t.Fatalf("expected %q, got %v", want, err)
+	}
+}
+
+func TestNewSet_DuplicateSourceName_Inline(t *testing.T) {
+	_, err := scan.NewSet([]scan.Source{
+		{Name: "footer", Src: `shared`},
+		{Name: "footer", Src: `feature`},
+	})
+	if err == nil || !strings.Contains(err.Error(), `template "footer" is defined in both inline source #1 (footer) and inline source #2 (footer)`) {
+		t.Fatalf("expected duplicate source error, got %v", err)
+	}
+}
+
+func TestNewSet_ParseErrorPosition(t *testing.T) {
+	_, err := scan.NewSet([]scan.Source{
+		{Name: "page", File: "templates/page.tmpl", Src: "ok\n{{ .Title }\n"},
+	})
+	var d *diag.Diagnostic
+	if !errors.As(err, &d) {
+		t.Fatalf("expected *diag.Diagnostic, got %v", err)
+	}
+	if d.File != "templates/page.tmpl" || d.Line != 2 || d.Code != diag.CodeParse {
+		t.Fatalf("unexpected diagnostic: %+v", d)
+	}
+}
+
+func TestSet_TemplateCall_UndefinedPosition(t *testing.T) {
+	set, err := scan.NewSet([]scan.Source{
+		{Name: "page", File: "page.tmpl", Src: `{{ template "header" . }}`},
+		{Name: "partials", File: "partials.tmpl", Src: "{{ define \"header\" }}\n  {{ template \"missing\" . }}{{ end }}"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 呼び出し先の {{ define }} 内のエラーは、定義元のファイルの位置で報告される
+	_, err = set.Scan("page")
+	var d *diag.Diagnostic
+	if !errors.As(err, &d) {
+		t.Fatalf("expected *diag.Diagnostic, got %v", err)
+	}
+	if got, want := d.Error(), `partials.tmpl:2:15: error: template "missing" is not defined`; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestSet_Funcs(t *testing.T) {
+	set, err := scan.NewSet([]scan.Source{
+		{Name: "page", Src: `{{ .Title | upper }}{{ if not (eq .A "x") }}{{ range .Items }}{{ comma .Price }}{{ end }}{{ end }}{{ define "unused" }}{{ nl2br .Body }}{{ end }}`},
+		{Name: "plain", Src: `{{ printf "%s" .Title }}{{ template "unused" . }}`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 呼び出されない define の中の関数も、パースに必要なので含まれる
+	if got, want := set.Funcs("page"), []string{"comma", "nl2br", "upper"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("page funcs = %v, want %v", got, want)
+	}
+	// 別のソースの define が使う関数は、そのソースの側で必要になる
+	if got := set.Funcs("plain"); len(got) != 0 {
+		t.Fatalf("plain funcs = %v, want none", got)
+	}
+}
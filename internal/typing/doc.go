@@ -3,8 +3,11 @@
 // このパッケージは以下の処理を行います:
 //   1. デフォルト型推論 (scan パッケージの結果から)
 //   2. @param ディレクティブによる型オーバーライド (magic パッケージを使用)
-//   3. 名前付き型の抽出
-//   4. 必要なimportの収集
+//      オーバーライドの前に、宣言された型がテンプレートでの使われ方と矛盾しないかを検証する
+//      @import したパッケージの型は go/types の情報で検証する (WithPackages 指定時)
+//   3. @type で宣言された型への置き換え (WithTypes 指定時)
+//   4. 名前付き型の抽出
+//   5. 必要なimportの収集
 //
 // 最終的に TypedSchema を生成し、コード生成に必要な情報を提供します。
 package typing
@@ -0,0 +1,318 @@
+package typing
+
+import (
+	"fmt"
+	"go/types"
+	"strings"
+
+	"github.com/bellwood4486/tmpltype/internal/diag"
+	"github.com/bellwood4486/tmpltype/internal/scan"
+	"github.com/bellwood4486/tmpltype/internal/typing/magic"
+)
+
+// ============================================================
+// Custom Function Signatures
+// ============================================================
+
+// builtinResults は結果の型が決まっている組み込み関数
+// {{ len .Items | comma }} のように、結果をカスタム関数に渡す場合の検証に使う
+var builtinResults = map[string]types.Type{
+	"len":      types.Typ[types.Int],
+	"print":    types.Typ[types.String],
+	"printf":   types.Typ[types.String],
+	"println":  types.Typ[types.String],
+	"html":     types.Typ[types.String],
+	"js":       types.Typ[types.String],
+	"urlquery": types.Typ[types.String],
+	"not":      types.Typ[types.Bool],
+	"eq":       types.Typ[types.Bool],
+	"ne":       types.Typ[types.Bool],
+	"lt":       types.Typ[types.Bool],
+	"le":       types.Typ[types.Bool],
+	"gt":       types.Typ[types.Bool],
+	"ge":       types.Typ[types.Bool],
+}
+
+// CheckModelCalls checks the custom function calls of a @model template against the fields of the model type
+func CheckModelCalls(schema scan.Schema, model types.Type, opts ...Option) error {
+	v := newResolveOptions(opts).validator()
+	return v.checkCalls(schema.Calls, func(path []string) (string, bool, bool) {
+		t := goFieldType(model, path)
+		if t == nil || types.IsInterface(t) {
+			return "", false, false
+		}
+		return v.typeString(t), false, true
+	})
+}
+
+// inferFromCalls infers field types from the parameters of the custom functions they are passed to
+// 例: {{ formatDate .CreatedAt }} で formatDate が func(time.Time) string なら CreatedAt は time.Time
+// 同じパスが複数の関数に渡される場合は最初の呼び出しを使い、テンプレートでの使われ方と矛盾する型は推論しない
+func (v validator) inferFromCalls(schema scan.Schema) []magic.ParamDirective {
+	var inferred []magic.ParamDirective
+	seen := make(map[string]bool)
+	for _, call := range schema.Calls {
+		sig, ok := v.funcs[call.Func]
+		if !ok {
+			continue
+		}
+		for i, arg := range call.Args {
+			param := paramType(sig, i)
+			if arg.Kind != scan.ArgField || param == nil || types.IsInterface(param) || !v.inferable(param) {
+				continue
+			}
+			path := strings.Join(arg.Path, ".")
+			if seen[path] {
+				continue
+			}
+			field := lookupField(schema, arg.Path)
+			if field == nil {
+				continue
+			}
+			d, err := magic.ParseParam(path, v.typeString(param))
+			if err != nil || v.checkFieldType(path, field, d.Type) != nil {
+				continue
+			}
+			seen[path] = true
+			inferred = append(inferred, d)
+		}
+	}
+	return inferred
+}
+
+// inferable reports whether the generated code can refer to a parameter type
+// 名前付き型は time と @import したパッケージの型に限る
+func (v validator) inferable(t types.Type) bool {
+	switch t := t.(type) {
+	case *types.Basic:
+		return t.Info()&types.IsUntyped == 0 && t.Kind() != types.Invalid && t.Kind() != types.UnsafePointer
+	case *types.Pointer:
+		return v.inferable(t.Elem())
+	case *types.Slice:
+		return v.inferable(t.Elem())
+	case *types.Map:
+		return v.inferable(t.Key()) && v.inferable(t.Elem())
+	case *types.Named:
+		if t.TypeArgs().Len() > 0 {
+			return false
+		}
+		return v.refersTo(t.Obj().Pkg())
+	case *types.Alias:
+		return v.refersTo(t.Obj().Pkg()) && v.inferable(types.Unalias(t))
+	}
+	return false
+}
+
+// refersTo reports whether the generated code can refer to types of the package
+func (v validator) refersTo(pkg *types.Package) bool {
+	if pkg == nil {
+		return false
+	}
+	if pkg.Path() == "time" {
+		return true
+	}
+	for _, p := range v.pkgs {
+		if p.Path() == pkg.Path() {
+			return true
+		}
+	}
+	return false
+}
+
+// typeString returns a Go type as written in type expressions
+// @import で別名を付けたパッケージはその名前で書く
+func (v validator) typeString(t types.Type) string {
+	return types.TypeString(t, func(p *types.Package) string {
+		for name, pkg := range v.pkgs {
+			if pkg.Path() == p.Path() {
+				return name
+			}
+		}
+		return p.Name()
+	})
+}
+
+// checkCalls checks the number and types of the arguments of custom function calls
+// fieldType はフィールド参照の型（テンプレートから生成する型か、分からなければ ok=false）を返す
+func (v validator) checkCalls(calls []scan.Call, fieldType func(path []string) (goType string, generated, ok bool)) error {
+	for _, call := range calls {
+		sig, ok := v.funcs[call.Func]
+		if !ok {
+			continue
+		}
+		if err := v.checkCall(call, sig, fieldType); err != nil {
+			return diag.Errorf(diag.CodeFunc, call.File, call.Line, call.Col, "%v", err)
+		}
+	}
+	return nil
+}
+
+// checkCall checks one call against the signature of the function
+// メッセージは実行時の text/template のエラーに合わせる
+func (v validator) checkCall(call scan.Call, sig *types.Signature, fieldType func(path []string) (string, bool, bool)) error {
+	fixed := sig.Params().Len()
+	if sig.Variadic() {
+		fixed--
+		if len(call.Args) < fixed {
+			return fmt.Errorf("wrong number of args for %s: want at least %d got %d", call.Func, fixed, len(call.Args))
+		}
+	} else if len(call.Args) != fixed {
+		return fmt.Errorf("wrong number of args for %s: want %d got %d", call.Func, fixed, len(call.Args))
+	}
+
+	for i, arg := range call.Args {
+		param := paramType(sig, i)
+		if err := v.checkArg(arg, param, fieldType); err != nil {
+			return fmt.Errorf("wrong type for argument %d of %s: expected %s; got %s", i+1, call.Func, v.typeString(param), err)
+		}
+	}
+	return nil
+}
+
+// checkArg checks one argument against a parameter type and describes the argument if it does not match
+func (v validator) checkArg(arg scan.Arg, param types.Type, fieldType func(path []string) (string, bool, bool)) error {
+	switch arg.Kind {
+	case scan.ArgField:
+		goType, generated, ok := fieldType(arg.Path)
+		if !ok || types.IsInterface(param) {
+			return nil
+		}
+		path := "." + strings.Join(arg.Path, ".")
+		if generated {
+			return fmt.Errorf("%s of a type generated from the template; declare its type with @param", path)
+		}
+		// テンプレートはポインタを自動的にたどる
+		if want := v.typeString(param); goType == want || goType == "*"+want {
+			return nil
+		}
+		return fmt.Errorf("%s of type %s", path, goType)
+
+	case scan.ArgCall:
+		result := builtinResults[arg.Func]
+		if sig, ok := v.funcs[arg.Func]; ok {
+			result = nil
+			if sig.Results().Len() > 0 {
+				result = sig.Results().At(0).Type()
+			}
+		}
+		// インターフェースを返す関数は実行時の値次第なので検証しない
+		if result == nil || types.IsInterface(result) || types.IsInterface(param) {
+			return nil
+		}
+		if types.AssignableTo(result, param) {
+			return nil
+		}
+		if ptr, ok := result.Underlying().(*types.Pointer); ok && types.AssignableTo(ptr.Elem(), param) {
+			return nil
+		}
+		return fmt.Errorf("the result of %s of type %s", arg.Func, v.typeString(result))
+
+	case scan.ArgString, scan.ArgInt, scan.ArgFloat, scan.ArgBool, scan.ArgNil:
+		if acceptsLiteral(arg.Kind, param) {
+			return nil
+		}
+		return fmt.Errorf("%s", arg.Text)
+	}
+	return nil
+}
+
+// acceptsLiteral reports whether text/template can convert a literal to the parameter type
+func acceptsLiteral(kind scan.ArgKind, param types.Type) bool {
+	u := param.Underlying()
+	if kind == scan.ArgNil {
+		switch u.(type) {
+		case *types.Pointer, *types.Slice, *types.Map, *types.Chan, *types.Signature, *types.Interface:
+			return true
+		}
+		return false
+	}
+	if iface, ok := u.(*types.Interface); ok {
+		return iface.Empty()
+	}
+	basic, ok := u.(*types.Basic)
+	if !ok {
+		return false
+	}
+	switch kind {
+	case scan.ArgString:
+		return basic.Info()&types.IsString != 0
+	case scan.ArgInt:
+		return basic.Info()&types.IsNumeric != 0
+	case scan.ArgFloat:
+		return basic.Info()&(types.IsFloat|types.IsComplex) != 0
+	case scan.ArgBool:
+		return basic.Info()&types.IsBoolean != 0
+	}
+	return false
+}
+
+// paramType returns the type of the i-th argument of a call, or nil if the function takes fewer arguments
+// 可変長引数の関数では、最後の引数以降は要素の型になる
+func paramType(sig *types.Signature, i int) types.Type {
+	params := sig.Params()
+	if sig.Variadic() && i >= params.Len()-1 {
+		return params.At(params.Len() - 1).Type().(*types.Slice).Elem()
+	}
+	if i >= params.Len() {
+		return nil
+	}
+	return params.At(i).Type()
+}
+
+// typedFieldType returns the resolved type of a field for checkCalls
+// 子フィールドを持つフィールドはテンプレートから生成する型になる
+func typedFieldType(typed *TypedSchema) func(path []string) (string, bool, bool) {
+	return func(path []string) (string, bool, bool) {
+		field := typed.Fields[path[0]]
+		for _, name := range path[1:] {
+			if field == nil {
+				return "", false, false
+			}
+			field = field.Children[name]
+		}
+		if field == nil || field.GoType == "any" {
+			return "", false, false
+		}
+		return field.GoType, field.Children != nil, true
+	}
+}
+
+// goFieldType returns the Go type of a field path of a model type, or nil if it cannot be determined
+// スライス・マップのパスは要素のフィールドをたどる（scan のパスと同じ）
+func goFieldType(t types.Type, path []string) types.Type {
+	for _, name := range path {
+		t = deref(t)
+		// map[string]T の .key アクセスは要素の参照になる（checkGoChildren と同じ）
+		if m, ok := t.Underlying().(*types.Map); ok {
+			t = m.Elem()
+			continue
+		}
+		if _, ok := t.Underlying().(*types.Struct); !ok {
+			if elem := goElemType(t); elem != nil {
+				t = deref(elem)
+			}
+		}
+		obj, _, _ := types.LookupFieldOrMethod(t, true, nil, name)
+		switch obj := obj.(type) {
+		case *types.Var:
+			t = obj.Type()
+		case *types.Func:
+			sig := obj.Signature()
+			if sig.Params().Len() > 0 || sig.Results().Len() == 0 {
+				return nil
+			}
+			t = sig.Results().At(0).Type()
+		default:
+			return nil
+		}
+	}
+	return t
+}
+
+// deref dereferences a pointer type
+func deref(t types.Type) types.Type {
+	if ptr, ok := t.Underlying().(*types.Pointer); ok {
+		return ptr.Elem()
+	}
+	return t
+}
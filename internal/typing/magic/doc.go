@@ -2,10 +2,21 @@
 //
 // このパッケージは以下の機能を提供します:
 //   - テンプレート内の @param ディレクティブの抽出
+//   - テンプレート内の @type 宣言・@import 宣言・@model 宣言の抽出
 //   - 型表現のパース (基本型、スライス、マップ、ポインタ、構造体)
 //   - 型オーバーライドの管理
 //
 // @param ディレクティブの形式:
 //   {{/* @param User.Age int */}}
 //   {{/* @param Items []struct{ID int; Name string} */}}
+//
+// @type 宣言の形式:
+//   {{/* @type User struct{Name string; Email string} */}}
+//
+// @import 宣言の形式:
+//   {{/* @import github.com/acme/app/models */}}
+//   {{/* @import m github.com/acme/app/models */}}
+//
+// @model 宣言の形式:
+//   {{/* @model github.com/acme/app/models.Invoice */}}
 package magic
@@ -2,8 +2,12 @@ package magic
 
 import (
 	"fmt"
+	"go/token"
 	"regexp"
+	"slices"
 	"strings"
+
+	"github.com/bellwood4486/tmpltype/internal/diag"
 )
 
 // TypeKind は型表現の種類を表す
@@ -25,6 +29,58 @@ type TypeExpr struct {
 	Fields   []FieldDef // 構造体用
 }
 
+// String はTypeExprをGo型文字列に変換する
+func (t TypeExpr) String() string {
+	switch t.Kind {
+	case TypeKindBase:
+		return t.BaseType
+	case TypeKindSlice:
+		if t.Elem != nil {
+			return "[]" + t.Elem.String()
+		}
+		return "[]string"
+	case TypeKindMap:
+		if t.Elem != nil {
+			return "map[string]" + t.Elem.String()
+		}
+		return "map[string]string"
+	case TypeKindPointer:
+		if t.Elem != nil {
+			return "*" + t.Elem.String()
+		}
+		return "*string"
+	case TypeKindStruct:
+		// 構造体の場合、インライン構造体型を生成
+		var fields []string
+		for _, f := range t.Fields {
+			fields = append(fields, f.Name+" "+f.Type.String())
+		}
+		return "struct{" + strings.Join(fields, "; ") + "}"
+	default:
+		return "string"
+	}
+}
+
+// QualifiedNames は型表現が参照する他パッケージの型名を出現順に重複なく返す
+// 例: "map[string][]models.User" -> ["models.User"]
+func (t TypeExpr) QualifiedNames() []string {
+	var names []string
+	var walk func(t TypeExpr)
+	walk = func(t TypeExpr) {
+		if strings.Contains(t.BaseType, ".") && !slices.Contains(names, t.BaseType) {
+			names = append(names, t.BaseType)
+		}
+		if t.Elem != nil {
+			walk(*t.Elem)
+		}
+		for _, f := range t.Fields {
+			walk(f.Type)
+		}
+	}
+	walk(t)
+	return names
+}
+
 // FieldDef は構造体型のフィールドを表す
 type FieldDef struct {
 	Name string
@@ -36,6 +92,7 @@ type ParamDirective struct {
 	Path string   // 例: "User.Age"
 	Type TypeExpr // パース済みの型
 	Line int      // テンプレート内の行番号
+	Col  int      // ディレクティブの {{ の列番号（1始まり、バイト単位）
 }
 
 var paramRegex = regexp.MustCompile(`\{\{-?\s*/\*\s*@param\s+(\S+)\s+(.+?)\s*\*/\s*-?\}\}`)
@@ -49,25 +106,27 @@ func ParseParams(src string) ([]ParamDirective, error) {
 
 	for _, line := range lines {
 		lineNum++
-		matches := paramRegex.FindAllStringSubmatch(line, -1)
+		matches := paramRegex.FindAllStringSubmatchIndex(line, -1)
 
 		for _, match := range matches {
-			if len(match) != 3 {
+			if len(match) != 6 {
 				continue
 			}
 
-			path := match[1]
-			typeStr := match[2]
+			col := match[0] + 1
+			path := line[match[2]:match[3]]
+			typeStr := line[match[4]:match[5]]
 
 			typeExpr, err := parseType(typeStr)
 			if err != nil {
-				return nil, fmt.Errorf("line %d: invalid type expression %q: %w", lineNum, typeStr, err)
+				return nil, diag.Errorf(diag.CodeParamSyntax, "", lineNum, col, "invalid type expression %q: %v", typeStr, err)
 			}
 
 			directives = append(directives, ParamDirective{
 				Path: path,
 				Type: typeExpr,
 				Line: lineNum,
+				Col:  col,
 			})
 		}
 	}
@@ -75,3 +134,149 @@ func ParseParams(src string) ([]ParamDirective, error) {
 	return directives, nil
 }
 
+// TypeDecl は @type ディレクティブによる型宣言を表す
+// 宣言はテンプレートのパッケージ全体で共有される
+type TypeDecl struct {
+	Name string   // 例: "User"
+	Type TypeExpr // パース済みの型
+	Line int      // テンプレート内の行番号
+	Col  int      // ディレクティブの {{ の列番号（1始まり、バイト単位）
+}
+
+var typeDeclRegex = regexp.MustCompile(`\{\{-?\s*/\*\s*@type\s+(\S+)\s+(.+?)\s*\*/\s*-?\}\}`)
+
+// ParseTypes はテンプレートソースから @type ディレクティブを抽出する
+func ParseTypes(src string) ([]TypeDecl, error) {
+	var decls []TypeDecl
+
+	for i, line := range strings.Split(src, "\n") {
+		lineNum := i + 1
+		for _, match := range typeDeclRegex.FindAllStringSubmatchIndex(line, -1) {
+			col := match[0] + 1
+			name := line[match[2]:match[3]]
+			typeStr := line[match[4]:match[5]]
+
+			if !token.IsIdentifier(name) {
+				return nil, diag.Errorf(diag.CodeTypeDecl, "", lineNum, col, "invalid type name %q", name)
+			}
+			typeExpr, err := parseType(typeStr)
+			if err != nil {
+				return nil, diag.Errorf(diag.CodeTypeDecl, "", lineNum, col, "invalid type expression %q: %v", typeStr, err)
+			}
+
+			decls = append(decls, TypeDecl{
+				Name: name,
+				Type: typeExpr,
+				Line: lineNum,
+				Col:  col,
+			})
+		}
+	}
+
+	return decls, nil
+}
+
+// ImportDecl は @import ディレクティブによるパッケージの宣言を表す
+// 宣言はテンプレートのパッケージ全体で共有される
+type ImportDecl struct {
+	Name string // 型表現で使うパッケージ名（例: "models"）。省略時は空で、パッケージ自身の名前を使う
+	Path string // インポートパス（例: "github.com/acme/app/models"）
+	Line int    // テンプレート内の行番号
+	Col  int    // ディレクティブの {{ の列番号（1始まり、バイト単位）
+}
+
+var importRegex = regexp.MustCompile(`\{\{-?\s*/\*\s*@import\s+(\S+)(?:\s+(\S+))?\s*\*/\s*-?\}\}`)
+
+// ParseImports はテンプレートソースから @import ディレクティブを抽出する
+// {{/* @import models github.com/acme/app/models */}} と、名前を省略した {{/* @import github.com/acme/app/models */}} の形式がある
+func ParseImports(src string) ([]ImportDecl, error) {
+	var decls []ImportDecl
+
+	for i, line := range strings.Split(src, "\n") {
+		lineNum := i + 1
+		for _, match := range importRegex.FindAllStringSubmatchIndex(line, -1) {
+			col := match[0] + 1
+			name, path := "", line[match[2]:match[3]]
+			if match[4] >= 0 {
+				name, path = path, line[match[4]:match[5]]
+			}
+
+			if name != "" && !token.IsIdentifier(name) {
+				return nil, diag.Errorf(diag.CodeImport, "", lineNum, col, "invalid package name %q", name)
+			}
+			path = strings.Trim(path, `"`)
+			if path == "" {
+				return nil, diag.Errorf(diag.CodeImport, "", lineNum, col, "missing import path")
+			}
+
+			decls = append(decls, ImportDecl{
+				Name: name,
+				Path: path,
+				Line: lineNum,
+				Col:  col,
+			})
+		}
+	}
+
+	return decls, nil
+}
+
+// ModelDirective は @model ディレクティブを表す
+// テンプレートのデータとして、型を生成する代わりに既存の Go の型を使う
+type ModelDirective struct {
+	Path    string // 型を定義しているパッケージのインポートパス（例: "github.com/acme/app/models"）
+	Name    string // 型名（例: "Invoice"）
+	Pointer bool   // *T としてデータを受け取るか
+	Line    int    // テンプレート内の行番号
+	Col     int    // ディレクティブの {{ の列番号（1始まり、バイト単位）
+}
+
+var modelRegex = regexp.MustCompile(`\{\{-?\s*/\*\s*@model\s+(\S+)\s*\*/\s*-?\}\}`)
+
+// ParseModel はテンプレートソースから @model ディレクティブを抽出する
+// 形式は {{/* @model github.com/acme/app/models.Invoice */}}（ポインタで受け取る場合は *github.com/...）
+// ディレクティブがなければ nil を返し、複数あればエラーにする
+func ParseModel(src string) (*ModelDirective, error) {
+	var model *ModelDirective
+
+	for i, line := range strings.Split(src, "\n") {
+		lineNum := i + 1
+		for _, match := range modelRegex.FindAllStringSubmatchIndex(line, -1) {
+			col := match[0] + 1
+			if model != nil {
+				return nil, diag.Errorf(diag.CodeModel, "", lineNum, col, "@model is already declared at line %d", model.Line)
+			}
+
+			ref := line[match[2]:match[3]]
+			pointer := strings.HasPrefix(ref, "*")
+			dot := strings.LastIndex(ref, ".")
+			if dot < 0 || strings.LastIndex(ref, "/") > dot {
+				return nil, diag.Errorf(diag.CodeModel, "", lineNum, col, "invalid @model %q: expected <import path>.<type>", ref)
+			}
+			path, name := strings.TrimPrefix(ref[:dot], "*"), ref[dot+1:]
+			if path == "" || !token.IsExported(name) || !token.IsIdentifier(name) {
+				return nil, diag.Errorf(diag.CodeModel, "", lineNum, col, "invalid @model %q: expected <import path>.<type>", ref)
+			}
+
+			model = &ModelDirective{
+				Path:    path,
+				Name:    name,
+				Pointer: pointer,
+				Line:    lineNum,
+				Col:     col,
+			}
+		}
+	}
+
+	return model, nil
+}
+
+// ParseParam はテンプレート外（設定ファイルなど）で指定されたパスと型から ParamDirective を作成する
+// 位置情報を持たないため Line と Col は 0 になる
+func ParseParam(path, typeStr string) (ParamDirective, error) {
+	typeExpr, err := parseType(typeStr)
+	if err != nil {
+		return ParamDirective{}, fmt.Errorf("invalid type expression %q: %w", typeStr, err)
+	}
+	return ParamDirective{Path: path, Type: typeExpr}, nil
+}
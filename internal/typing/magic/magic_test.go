@@ -203,3 +203,96 @@ func TestParseParams_TrimMarkers(t *testing.T) {
 		})
 	}
 }
+
+func TestParseTypes(t *testing.T) {
+	src := `{{/* @type User struct{Name string; Email string} */}}
+{{/* @param Author User */}}
+  {{- /* @type Tags []string */ -}}`
+	decls, err := ParseTypes(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decls) != 2 {
+		t.Fatalf("expected 2 declarations, got %d", len(decls))
+	}
+	if decls[0].Name != "User" || decls[0].Type.Kind != TypeKindStruct || len(decls[0].Type.Fields) != 2 {
+		t.Errorf("unexpected declaration: %+v", decls[0])
+	}
+	if decls[1].Name != "Tags" || decls[1].Type.String() != "[]string" || decls[1].Line != 3 || decls[1].Col != 3 {
+		t.Errorf("unexpected declaration: %+v", decls[1])
+	}
+}
+
+func TestParseTypes_InvalidName(t *testing.T) {
+	_, err := ParseTypes(`{{/* @type User.Name string */}}`)
+	if err == nil || err.Error() != `1:1: error: invalid type name "User.Name"` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestParseImports(t *testing.T) {
+	src := `{{/* @import github.com/acme/app/models */}}
+{{- /* @import m2 "github.com/acme/app/models/v2" */ -}}
+{{/* @param User models.User */}}`
+	decls, err := ParseImports(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ImportDecl{
+		{Name: "", Path: "github.com/acme/app/models", Line: 1, Col: 1},
+		{Name: "m2", Path: "github.com/acme/app/models/v2", Line: 2, Col: 1},
+	}
+	if len(decls) != len(want) {
+		t.Fatalf("expected %d imports, got %d", len(want), len(decls))
+	}
+	for i := range want {
+		if decls[i] != want[i] {
+			t.Errorf("import %d = %+v, want %+v", i, decls[i], want[i])
+		}
+	}
+
+	_, err = ParseImports(`{{/* @import my-models github.com/acme/app/models */}}`)
+	if err == nil || err.Error() != `1:1: error: invalid package name "my-models"` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestTypeExpr_QualifiedNames(t *testing.T) {
+	typ, err := parseType("map[string]struct{Owner *models.User; Tags []models.Tag; At time.Time}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := typ.QualifiedNames()
+	if len(got) != 3 || got[0] != "models.User" || got[1] != "models.Tag" || got[2] != "time.Time" {
+		t.Fatalf("QualifiedNames() = %v, want [models.User models.Tag time.Time]", got)
+	}
+}
+
+func TestParseModel(t *testing.T) {
+	model, err := ParseModel("{{/* @param X int */}}\n{{- /* @model *github.com/acme/app/models.Invoice */ -}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ModelDirective{Path: "github.com/acme/app/models", Name: "Invoice", Pointer: true, Line: 2, Col: 1}
+	if model == nil || *model != want {
+		t.Fatalf("ParseModel() = %+v, want %+v", model, want)
+	}
+
+	if model, err := ParseModel("{{ .Name }}"); err != nil || model != nil {
+		t.Fatalf("ParseModel() without @model = %+v, %v", model, err)
+	}
+
+	errTests := []struct {
+		src  string
+		want string
+	}{
+		{"{{/* @model Invoice */}}", `1:1: error: invalid @model "Invoice": expected <import path>.<type>`},
+		{"{{/* @model github.com/acme/app/models.invoice */}}", `1:1: error: invalid @model "github.com/acme/app/models.invoice": expected <import path>.<type>`},
+		{"{{/* @model time.Time */}}\n{{/* @model time.Duration */}}", "2:1: error: @model is already declared at line 1"},
+	}
+	for _, tt := range errTests {
+		if _, err := ParseModel(tt.src); err == nil || err.Error() != tt.want {
+			t.Errorf("ParseModel(%q) error = %v, want %q", tt.src, err, tt.want)
+		}
+	}
+}
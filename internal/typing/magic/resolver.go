@@ -1,6 +1,7 @@
 package magic
 
 import (
+	"slices"
 	"strings"
 
 	"github.com/bellwood4486/tmpltype/internal/util"
@@ -10,18 +11,22 @@ import (
 type TypeResolver struct {
 	overrides    map[string]string      // パス -> Go型文字列 (例: "User.Age" -> "int")
 	structFields map[string]map[string]string  // パス -> 構造体型のフィールド定義
+	directives   []ParamDirective       // 元の @param ディレクティブ（出現順）
 }
 
 // NewTypeResolver はテンプレートソースからTypeResolverを作成する
-func NewTypeResolver(src string) (*TypeResolver, error) {
-	directives, err := ParseParams(src)
+// extra はテンプレート外で指定された @param で、同じパスに対してはテンプレート内の @param が優先される
+func NewTypeResolver(src string, extra ...ParamDirective) (*TypeResolver, error) {
+	parsed, err := ParseParams(src)
 	if err != nil {
 		return nil, err
 	}
+	directives := append(slices.Clone(extra), parsed...)
 
 	resolver := &TypeResolver{
 		overrides:    make(map[string]string),
 		structFields: make(map[string]map[string]string),
+		directives:   directives,
 	}
 
 	for _, dir := range directives {
@@ -58,6 +63,11 @@ func (r *TypeResolver) GetAllOverrides() map[string]string {
 	return r.overrides
 }
 
+// Directives はテンプレートに書かれた @param ディレクティブを出現順に返す
+func (r *TypeResolver) Directives() []ParamDirective {
+	return r.directives
+}
+
 // GetStructFields は指定されたパスの構造体フィールド定義を返す
 func (r *TypeResolver) GetStructFields(path string) map[string]string {
 	return r.structFields[path]
@@ -65,34 +75,5 @@ func (r *TypeResolver) GetStructFields(path string) map[string]string {
 
 // typeExprToString はTypeExprをGo型文字列に変換する
 func (r *TypeResolver) typeExprToString(expr TypeExpr) string {
-	switch expr.Kind {
-	case TypeKindBase:
-		return expr.BaseType
-	case TypeKindSlice:
-		if expr.Elem != nil {
-			return "[]" + r.typeExprToString(*expr.Elem)
-		}
-		return "[]string"
-	case TypeKindMap:
-		if expr.Elem != nil {
-			return "map[string]" + r.typeExprToString(*expr.Elem)
-		}
-		return "map[string]string"
-	case TypeKindPointer:
-		if expr.Elem != nil {
-			return "*" + r.typeExprToString(*expr.Elem)
-		}
-		return "*string"
-	case TypeKindStruct:
-		// 構造体の場合、インライン構造体型を生成
-		// これは簡略版 - 実際には名前付き型を生成することも検討
-		var fields []string
-		for _, f := range expr.Fields {
-			fields = append(fields, f.Name + " " + r.typeExprToString(f.Type))
-		}
-		return "struct{" + strings.Join(fields, "; ") + "}"
-	default:
-		return "string"
-	}
+	return expr.String()
 }
-
@@ -0,0 +1,202 @@
+package typing
+
+import (
+	"fmt"
+	"go/types"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/bellwood4486/tmpltype/internal/scan"
+	"github.com/bellwood4486/tmpltype/internal/typing/magic"
+)
+
+// ============================================================
+// Types from Go Packages
+// ============================================================
+
+// qualifierRegex は型文字列に含まれるパッケージ名（"models.User" の "models"）にマッチする
+var qualifierRegex = regexp.MustCompile(`\b([A-Za-z_][A-Za-z0-9_]*)\.[A-Za-z_]`)
+
+// CheckPackages checks that the qualified type names in a type expression refer to exported types of pkgs
+// テンプレート外で解決する @type 宣言の検証に使う
+func CheckPackages(typ magic.TypeExpr, pkgs map[string]*types.Package) error {
+	return validator{pkgs: pkgs}.checkPackages(typ)
+}
+
+// CheckModel checks every field the template uses against an existing Go type declared with @model
+// テンプレートのルート（.）が model の値になる
+func CheckModel(schema scan.Schema, model types.Type) error {
+	root := &scan.Field{Kind: scan.KindStruct, Children: schema.Fields}
+	return validator{}.checkGoType("", root, model)
+}
+
+// checkPackages checks that every qualified type name refers to an exported type of an imported package
+// time パッケージは @import なしで使える（従来どおり time.Time は検証しない）
+func (v validator) checkPackages(typ magic.TypeExpr) error {
+	for _, name := range typ.QualifiedNames() {
+		pkgName, typeName, _ := strings.Cut(name, ".")
+		pkg, ok := v.pkgs[pkgName]
+		if !ok {
+			if pkgName == "time" {
+				continue
+			}
+			return fmt.Errorf("unknown package %s in %s; declare it with @import", pkgName, name)
+		}
+		if v.lookupType(name) == nil {
+			return fmt.Errorf("%s is not an exported type of package %s", typeName, pkg.Path())
+		}
+	}
+	return nil
+}
+
+// lookupType returns the type a qualified name refers to, or nil if it is not a type of an imported package
+func (v validator) lookupType(name string) types.Type {
+	pkgName, typeName, ok := strings.Cut(name, ".")
+	pkg := v.pkgs[pkgName]
+	if !ok || pkg == nil {
+		return nil
+	}
+	obj, ok := pkg.Scope().Lookup(typeName).(*types.TypeName)
+	if !ok || !obj.Exported() {
+		return nil
+	}
+	return obj.Type()
+}
+
+// checkGoType checks a field usage against a type loaded from a Go package
+// テンプレートと同じく、フィールドに加えて引数のないメソッドの呼び出しも許可する
+func (v validator) checkGoType(path string, field *scan.Field, t types.Type) error {
+	// テンプレートはポインタを自動的にたどる
+	for {
+		ptr, ok := t.Underlying().(*types.Pointer)
+		if !ok {
+			break
+		}
+		t = ptr.Elem()
+	}
+	typeStr := types.TypeString(t, func(p *types.Package) string { return p.Name() })
+
+	switch u := t.Underlying().(type) {
+	case *types.Interface:
+		// インターフェースは実行時の値次第なので検証しない
+		return nil
+	case *types.Signature:
+		// イテレータ関数の range などは検証しない
+		return nil
+	case *types.Basic:
+		switch field.Kind {
+		case scan.KindSlice:
+			if u.Info()&types.IsInteger != 0 {
+				return nil
+			}
+			return fmt.Errorf("%s is used with range, but %s cannot be ranged over", path, typeStr)
+		case scan.KindMap:
+			return fmt.Errorf("%s is used with index or a key/value range, but %s is not a map or slice", path, typeStr)
+		case scan.KindStruct:
+			return fmt.Errorf("%s is used, but %s has no fields", joinPath(path, slices.Sorted(maps.Keys(field.Children))[0]), typeStr)
+		case scan.KindInt, scan.KindFloat:
+			if u.Info()&types.IsNumeric == 0 {
+				return fmt.Errorf("%s is compared or formatted as a number, but %s is not numeric", path, typeStr)
+			}
+		}
+		return nil
+	}
+
+	switch field.Kind {
+	case scan.KindSlice, scan.KindMap:
+		elem := goElemType(t)
+		if elem == nil {
+			if field.Kind == scan.KindSlice {
+				return fmt.Errorf("%s is used with range, but %s cannot be ranged over", path, typeStr)
+			}
+			return fmt.Errorf("%s is used with index or a key/value range, but %s is not a map or slice", path, typeStr)
+		}
+		if field.Elem == nil {
+			return nil
+		}
+		return v.checkGoType(path, field.Elem, elem)
+
+	case scan.KindStruct:
+		return v.checkGoChildren(path, field, t, typeStr)
+
+	case scan.KindInt, scan.KindFloat:
+		return fmt.Errorf("%s is compared or formatted as a number, but %s is not numeric", path, typeStr)
+	}
+	return nil
+}
+
+// goElemType returns the element type of a slice, array, map or channel type
+func goElemType(t types.Type) types.Type {
+	switch u := t.Underlying().(type) {
+	case *types.Slice:
+		return u.Elem()
+	case *types.Array:
+		return u.Elem()
+	case *types.Map:
+		return u.Elem()
+	case *types.Chan:
+		return u.Elem()
+	}
+	return nil
+}
+
+// checkGoChildren checks child field accesses against the fields and methods of a Go type
+func (v validator) checkGoChildren(path string, field *scan.Field, t types.Type, typeStr string) error {
+	for _, name := range slices.Sorted(maps.Keys(field.Children)) {
+		child := field.Children[name]
+		childPath := joinPath(path, name)
+
+		// map[string]T の .key アクセスは要素の参照になる
+		if m, ok := t.Underlying().(*types.Map); ok {
+			if err := v.checkGoType(childPath, child, m.Elem()); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// 未エクスポートのフィールド・メソッドはテンプレートから参照できないため見つからない扱いになる
+		obj, _, _ := types.LookupFieldOrMethod(t, true, nil, name)
+		var childType types.Type
+		switch obj := obj.(type) {
+		case *types.Var:
+			childType = obj.Type()
+		case *types.Func:
+			sig := obj.Signature()
+			if sig.Params().Len() > 0 || sig.Results().Len() == 0 {
+				// 引数を取るメソッドは呼び出し側の引数を解析しないため検証しない
+				continue
+			}
+			childType = sig.Results().At(0).Type()
+		default:
+			return fmt.Errorf("%s is used, but %s has no exported field or method %s", childPath, typeStr, name)
+		}
+		if err := v.checkGoType(childPath, child, childType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// joinPath returns the path of a child field; the template root has an empty path
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// packageImports returns the import paths of the packages a Go type string refers to
+// 例: "[]models.User" -> ["github.com/acme/app/models"], "time.Time" -> ["time"]
+func (v validator) packageImports(goType string) []string {
+	var paths []string
+	for _, m := range qualifierRegex.FindAllStringSubmatch(goType, -1) {
+		if pkg, ok := v.pkgs[m[1]]; ok {
+			paths = append(paths, pkg.Path())
+		} else if m[1] == "time" {
+			paths = append(paths, "time")
+		}
+	}
+	return paths
+}
@@ -2,10 +2,12 @@ package typing
 
 import (
 	"fmt"
+	"go/types"
 	"maps"
 	"slices"
 	"strings"
 
+	"github.com/bellwood4486/tmpltype/internal/diag"
 	"github.com/bellwood4486/tmpltype/internal/scan"
 	"github.com/bellwood4486/tmpltype/internal/typing/magic"
 	"github.com/bellwood4486/tmpltype/internal/util"
@@ -15,25 +17,108 @@ import (
 // Public API
 // ============================================================
 
+// Option configures Resolve
+type Option func(*resolveOptions)
+
+// resolveOptions は Resolve の設定
+type resolveOptions struct {
+	params []magic.ParamDirective      // テンプレート外で指定された @param
+	types  map[string]magic.TypeExpr   // @type で宣言された型（名前 -> 型）
+	pkgs   map[string]*types.Package   // @import で宣言されたパッケージ（パッケージ名 -> パッケージ）
+	funcs  map[string]*types.Signature // カスタム関数のシグネチャ（関数名 -> シグネチャ）
+}
+
+// newResolveOptions applies the options
+func newResolveOptions(opts []Option) *resolveOptions {
+	o := &resolveOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// validator returns a validator for the declared types, packages and functions
+func (o *resolveOptions) validator() validator {
+	return validator{types: o.types, pkgs: o.pkgs, funcs: o.funcs}
+}
+
+// WithParams adds @param overrides given outside the template (e.g. a config file)
+// those are applied only to paths the template uses, and the template's own @param wins
+func WithParams(params ...magic.ParamDirective) Option {
+	return func(o *resolveOptions) {
+		o.params = append(o.params, params...)
+	}
+}
+
+// WithTypes makes the @type declarations of the package available to the template
+// inferred named types with a declared name use the declared type instead of a template-specific struct
+func WithTypes(types map[string]magic.TypeExpr) Option {
+	return func(o *resolveOptions) {
+		o.types = types
+	}
+}
+
+// WithPackages makes the packages declared with @import available to type expressions
+// keys are the package names used in types (e.g. "models" for models.User); fields used with those types are checked with go/types
+func WithPackages(pkgs map[string]*types.Package) Option {
+	return func(o *resolveOptions) {
+		o.pkgs = pkgs
+	}
+}
+
+// WithFuncs makes the signatures of the template's custom functions available
+// fields passed to a function get the parameter type unless the template declares another one, and every call is checked
+func WithFuncs(funcs map[string]*types.Signature) Option {
+	return func(o *resolveOptions) {
+		o.funcs = funcs
+	}
+}
+
 // Resolve resolves types for a schema with both default inference and @param overrides
-func Resolve(schema scan.Schema, templateSrc string) (*TypedSchema, error) {
+func Resolve(schema scan.Schema, templateSrc string, opts ...Option) (*TypedSchema, error) {
+	o := newResolveOptions(opts)
+	v := o.validator()
+
 	// 1. デフォルト型推論
 	typed := inferDefaultTypes(schema)
 
 	// 2. @paramによるオーバーライド適用
-	resolver, err := magic.NewTypeResolver(templateSrc)
+	// テンプレート外の指定は共通の型マッピングとして使われるため、使われていないパスは無視する
+	var used []magic.ParamDirective
+	for _, d := range o.params {
+		if lookupField(schema, strings.Split(d.Path, ".")) != nil {
+			used = append(used, d)
+		}
+	}
+	// カスタム関数の引数から推論した型は、明示的な指定がないパスにだけ使われる
+	resolver, err := magic.NewTypeResolver(templateSrc, append(v.inferFromCalls(schema), used...)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create type resolver: %w", err)
 	}
 
+	// @paramの型がテンプレートでの使われ方と矛盾しないか検証
+	if err := v.validateOverrides(schema, resolver.Directives()); err != nil {
+		return nil, err
+	}
+
 	// オーバーライドを適用
 	applyOverrides(typed, resolver)
 
+	// @type で宣言された名前の型を宣言に結びつける
+	if err := bindDeclaredTypes(schema, typed, v); err != nil {
+		return nil, err
+	}
+
+	// カスタム関数の呼び出しが引数の数・型と一致するか検証
+	if err := v.checkCalls(schema.Calls, typedFieldType(typed)); err != nil {
+		return nil, err
+	}
+
 	// 3. 名前付き型を抽出
 	extractNamedTypes(typed)
 
 	// 4. 必要なimportsを収集
-	collectImports(typed)
+	collectImports(typed, v)
 
 	return typed, nil
 }
@@ -67,6 +152,15 @@ func inferFieldType(path []string, field *scan.Field) *TypedField {
 	case scan.KindString:
 		typed.GoType = "string"
 
+	case scan.KindBool:
+		typed.GoType = "bool"
+
+	case scan.KindInt:
+		typed.GoType = "int"
+
+	case scan.KindFloat:
+		typed.GoType = "float64"
+
 	case scan.KindStruct:
 		// 構造体の場合、名前付き型かインライン型か判断
 		typeName := util.Export(path[len(path)-1])
@@ -137,8 +231,10 @@ func applyOverrides(typed *TypedSchema, resolver *magic.TypeResolver) {
 		applyFieldOverride([]string{name}, field, resolver)
 	}
 
-	// @paramで定義された構造体型を名前付き型として追加
-	for path, typeStr := range resolver.GetAllOverrides() {
+	// @paramで定義された構造体型を名前付き型として追加（パス順で順序を安定させる）
+	overrides := resolver.GetAllOverrides()
+	for _, path := range slices.Sorted(maps.Keys(overrides)) {
+		typeStr := overrides[path]
 		if strings.HasPrefix(typeStr, "[]") && !strings.HasPrefix(typeStr, "[]struct{") && !isBuiltinType(typeStr[2:]) {
 			// []ItemsItem のような名前付き型
 			if fields := resolver.GetStructFields(path); fields != nil {
@@ -177,6 +273,58 @@ func applyFieldOverride(path []string, field *TypedField, resolver *magic.TypeRe
 	}
 }
 
+// bindDeclaredTypes binds inferred named types to @type declarations with the same name
+// 例: @type User struct{...} があれば、{{ .User.Name }} の User はテンプレート固有の型ではなく宣言された User になる
+func bindDeclaredTypes(schema scan.Schema, typed *TypedSchema, v validator) error {
+	if len(v.types) == 0 {
+		return nil
+	}
+
+	var bind func(path []string, field *TypedField) error
+	bind = func(path []string, field *TypedField) error {
+		if field.Children == nil {
+			// 子フィールドを持たない（@param で上書きされた・構造体でない）フィールドは対象外
+			return nil
+		}
+		name := namedTypeName(field.GoType)
+		decl, ok := v.types[name]
+		if !ok {
+			for _, childName := range slices.Sorted(maps.Keys(field.Children)) {
+				if err := bind(append(slices.Clone(path), childName), field.Children[childName]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		// テンプレートでの使われ方が宣言と矛盾しないか検証
+		fieldPath := strings.Join(path, ".")
+		if scanned := lookupField(schema, path); scanned != nil {
+			if err := v.checkFieldType(fieldPath, scanned, magic.TypeExpr{Kind: magic.TypeKindBase, BaseType: name}); err != nil {
+				return diag.Errorf(diag.CodeTypeDecl, "", 0, 0, "%s does not match @type %s %s: %v", fieldPath, name, decl.String(), err)
+			}
+		}
+		// 子フィールドを持たない型は名前付き型として抽出されない
+		field.Children = nil
+		return nil
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(typed.Fields)) {
+		if err := bind([]string{name}, typed.Fields[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// namedTypeName returns the named type a field type refers to
+// 例: "User" -> "User", "[]ItemsItem" -> "ItemsItem", "map[string]UsersValue" -> "UsersValue"
+func namedTypeName(goType string) string {
+	goType = strings.TrimPrefix(goType, "[]")
+	goType = strings.TrimPrefix(goType, "map[string]")
+	return goType
+}
+
 // ============================================================
 // Phase 3: Extract Named Types
 // ============================================================
@@ -282,12 +430,12 @@ func isBuiltinType(typeName string) bool {
 // ============================================================
 
 // collectImports collects required imports based on types used
-func collectImports(typed *TypedSchema) {
+func collectImports(typed *TypedSchema, v validator) {
 	var collectFromField func(field *TypedField)
 	collectFromField = func(field *TypedField) {
-		// time.Time を使っている場合は time パッケージが必要
-		if strings.Contains(field.GoType, "time.Time") {
-			typed.Imports["time"] = struct{}{}
+		// time.Time や @import したパッケージの型を使っている場合はそのパッケージが必要
+		for _, path := range v.packageImports(field.GoType) {
+			typed.Imports[path] = struct{}{}
 		}
 
 		// 子フィールドも再帰的にチェック
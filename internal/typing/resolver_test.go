@@ -1,8 +1,16 @@
 package typing
 
 import (
+	"errors"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
 	"testing"
 
+	"github.com/bellwood4486/tmpltype/internal/diag"
 	"github.com/bellwood4486/tmpltype/internal/scan"
 )
 
@@ -61,6 +69,29 @@ func TestInferDefaultTypes_BasicFields(t *testing.T) {
 	}
 }
 
+func TestInferDefaultTypes_ScalarKinds(t *testing.T) {
+	schema := scan.Schema{
+		Fields: map[string]*scan.Field{
+			"Enabled": {Name: "Enabled", Kind: scan.KindBool},
+			"Count":   {Name: "Count", Kind: scan.KindInt},
+			"Score":   {Name: "Score", Kind: scan.KindFloat},
+		},
+	}
+
+	typed := inferDefaultTypes(schema)
+
+	want := map[string]string{
+		"Enabled": "bool",
+		"Count":   "int",
+		"Score":   "float64",
+	}
+	for name, goType := range want {
+		if typed.Fields[name].GoType != goType {
+			t.Errorf("%s.GoType = %q, want %q", name, typed.Fields[name].GoType, goType)
+		}
+	}
+}
+
 func TestInferDefaultTypes_StructField(t *testing.T) {
 	schema := scan.Schema{
 		Fields: map[string]*scan.Field{
@@ -325,6 +356,30 @@ func TestResolve_WithSliceStructOverride(t *testing.T) {
 	}
 }
 
+func TestResolve_NamedTypeOrderIsStable(t *testing.T) {
+	schema := scan.Schema{Fields: map[string]*scan.Field{}}
+	templateSrc := `
+{{/* @param Zoo []struct{Name string} */}}
+{{/* @param Apps []struct{ID int} */}}
+{{/* @param Menu []struct{Label string} */}}
+`
+
+	// @param の解決結果はmapで保持されるため、繰り返しても同じ順序になることを確認する
+	for range 20 {
+		typed, err := Resolve(schema, templateSrc)
+		if err != nil {
+			t.Fatalf("Resolve failed: %v", err)
+		}
+		var names []string
+		for _, nt := range typed.NamedTypes {
+			names = append(names, nt.Name)
+		}
+		if got, want := strings.Join(names, ","), "AppsItem,MenuItem,ZooItem"; got != want {
+			t.Fatalf("NamedTypes order = %s, want %s", got, want)
+		}
+	}
+}
+
 func TestResolve_InvalidParamDirective(t *testing.T) {
 	schema := scan.Schema{
 		Fields: map[string]*scan.Field{
@@ -345,3 +400,373 @@ func TestResolve_InvalidParamDirective(t *testing.T) {
 		t.Error("expected error for invalid param directive, got nil")
 	}
 }
+
+func TestResolve_ParamTypeMismatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		wantErr string // 空なら成功を期待
+	}{
+		{
+			name:    "range over int is allowed",
+			src:     "{{/* @param Count int */}}\n{{ range .Count }}{{ . }}{{ end }}",
+			wantErr: "",
+		},
+		{
+			name:    "range over string",
+			src:     "{{/* @param User.Name string */}}\n{{ range .User.Name }}{{ . }}{{ end }}",
+			wantErr: "1:1: error: @param User.Name string: User.Name is used with range, but string cannot be ranged over",
+		},
+		{
+			name:    "index on int",
+			src:     "\n\n{{/* @param Meta int */}}\n{{ index .Meta \"key\" }}",
+			wantErr: "3:1: error: @param Meta int: Meta is used with index or a key/value range, but int is not a map or slice",
+		},
+		{
+			name:    "key/value range over slice is allowed",
+			src:     "{{/* @param Products []struct{Name string} */}}\n{{ range $i, $p := .Products }}{{ $i }}{{ $p.Name }}{{ end }}",
+			wantErr: "",
+		},
+		{
+			name:    "child access on string",
+			src:     "{{/* @param User string */}}\n{{ with .User }}{{ .Name }}{{ end }}",
+			wantErr: "1:1: error: @param User string: User.Name is used, but string has no fields",
+		},
+		{
+			name:    "field missing from struct",
+			src:     "{{/* @param Items []struct{Title string} */}}\n{{ range .Items }}{{ .Title }}{{ .ID }}{{ end }}",
+			wantErr: "1:1: error: @param Items []struct{Title string}: Items.ID is used, but struct{Title string} has no field ID",
+		},
+		{
+			name:    "nested element type",
+			src:     "{{/* @param Items []struct{Tags string} */}}\n{{ range .Items }}{{ range .Tags }}{{ . }}{{ end }}{{ end }}",
+			wantErr: "Items.Tags is used with range, but string cannot be ranged over",
+		},
+		{
+			name:    "comparison with string",
+			src:     "{{/* @param Count string */}}\n{{ if gt .Count 0 }}many{{ end }}",
+			wantErr: "Count is compared or formatted as a number, but string is not numeric",
+		},
+		{
+			name:    "pointer and named types are not checked",
+			src:     "{{/* @param User *struct{Name string} */}}{{/* @param At time.Time */}}\n{{ .User.Name }}{{ .At.Year }}",
+			wantErr: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := scan.ScanTemplate(tt.src)
+			if err != nil {
+				t.Fatalf("ScanTemplate failed: %v", err)
+			}
+			_, err = Resolve(schema, tt.src)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Resolve() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// checkPackage は src を example.com/app/models パッケージとして型チェックする
+func checkPackage(t *testing.T, src string) *types.Package {
+	t.Helper()
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "models.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := (&types.Config{}).Check("example.com/app/models", fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkg
+}
+
+func TestResolve_WithPackages(t *testing.T) {
+	// go/types で型チェックしたパッケージを @import したパッケージとして使う
+	const src = `package models
+
+type Base struct{ ID int64 }
+
+type User struct {
+	Base
+	Name  string
+	Roles []string
+	Attrs map[string]string
+}
+
+func (u *User) Admin() bool           { return false }
+func (u User) Greet(name string) string { return name }
+`
+	pkgs := map[string]*types.Package{"models": checkPackage(t, src)}
+
+	tests := []struct {
+		name    string
+		src     string
+		wantErr string // 空なら成功を期待
+	}{
+		{
+			name: "fields, embedded fields and methods",
+			src:  "{{/* @param User *models.User */}}{{ .User.ID }}{{ .User.Name }}{{ if .User.Admin }}{{ end }}{{ .User.Greet \"x\" }}{{ range .User.Roles }}{{ . }}{{ end }}{{ .User.Attrs.color }}",
+		},
+		{
+			name:    "missing field",
+			src:     "{{/* @param User models.User */}}{{ .User.Email }}",
+			wantErr: "1:1: error: @param User models.User: User.Email is used, but models.User has no exported field or method Email",
+		},
+		{
+			name:    "child access on slice element",
+			src:     "{{/* @param User models.User */}}{{ range .User.Roles }}{{ .Name }}{{ end }}",
+			wantErr: "User.Roles.Name is used, but string has no fields",
+		},
+		{
+			name:    "numeric comparison",
+			src:     "{{/* @param User models.User */}}{{ if gt .User.Name 1 }}{{ end }}",
+			wantErr: "User.Name is compared or formatted as a number, but string is not numeric",
+		},
+		{
+			name:    "unknown type",
+			src:     "{{/* @param User models.Account */}}{{ .User.Name }}",
+			wantErr: "@param User models.Account: Account is not an exported type of package example.com/app/models",
+		},
+		{
+			name:    "unknown package",
+			src:     "{{/* @param User app.User */}}{{ .User.Name }}",
+			wantErr: "@param User app.User: unknown package app in app.User; declare it with @import",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := scan.ScanTemplate(tt.src)
+			if err != nil {
+				t.Fatalf("ScanTemplate failed: %v", err)
+			}
+			typed, err := Resolve(schema, tt.src, WithPackages(pkgs))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if _, ok := typed.Imports["example.com/app/models"]; !ok {
+					t.Errorf("Imports = %v, want example.com/app/models", typed.Imports)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Resolve() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckModel(t *testing.T) {
+	pkg := checkPackage(t, `package models
+
+type Invoice struct {
+	Number string
+	Lines  []Line
+}
+
+type Line struct{ Amount int }
+
+func (i Invoice) Total() int { return 0 }
+`)
+	invoice := pkg.Scope().Lookup("Invoice").Type()
+
+	tests := []struct {
+		name    string
+		src     string
+		wantErr string // 空なら成功を期待
+	}{
+		{
+			name: "fields and methods",
+			src:  "{{ .Number }}{{ range .Lines }}{{ .Amount }}{{ end }}{{ .Total }}",
+		},
+		{
+			name:    "missing root field",
+			src:     "{{ .Customer }}",
+			wantErr: "Customer is used, but models.Invoice has no exported field or method Customer",
+		},
+		{
+			name:    "missing element field",
+			src:     "{{ range .Lines }}{{ .Item }}{{ end }}",
+			wantErr: "Lines.Item is used, but models.Line has no exported field or method Item",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := scan.ScanTemplate(tt.src)
+			if err != nil {
+				t.Fatalf("ScanTemplate failed: %v", err)
+			}
+			err = CheckModel(schema, invoice)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("CheckModel() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResolve_WithFuncs(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "funcs.go", `package funcs
+
+import "time"
+
+type Money int64
+
+func formatDate(t time.Time) string         { return "" }
+func add(a, b int) int                       { return a + b }
+func upper(s string) string                  { return s }
+func join(sep string, items ...string) string { return "" }
+func price(m Money) string                   { return "" }
+func dump(v any) string                      { return "" }
+`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := (&types.Config{Importer: importer.Default()}).Check("example.com/app/funcs", fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigs := make(map[string]*types.Signature)
+	for _, name := range pkg.Scope().Names() {
+		if fn, ok := pkg.Scope().Lookup(name).(*types.Func); ok {
+			sigs[name] = fn.Signature()
+		}
+	}
+
+	tests := []struct {
+		name    string
+		src     string
+		want    map[string]string // パス -> 期待する型
+		wantErr string            // 空なら成功を期待
+	}{
+		{
+			name: "infers parameter types",
+			src:  "{{ formatDate .CreatedAt }}{{ add .Price 1 }}{{ .Title | upper }}{{ dump .Any }}",
+			want: map[string]string{"CreatedAt": "time.Time", "Price": "int", "Title": "string", "Any": "string"},
+		},
+		{
+			name: "variadic and piped results",
+			src:  `{{ join ", " .A .B | upper }}{{ .CreatedAt | formatDate | upper }}{{ len .Items | add 1 }}{{ range .Items }}{{ end }}`,
+			want: map[string]string{"A": "string", "B": "string", "CreatedAt": "time.Time"},
+		},
+		{
+			name:    "types of packages that are not imported are not inferred",
+			src:     "{{ price .Amount }}",
+			wantErr: "1:4: error: wrong type for argument 1 of price: expected funcs.Money; got .Amount of type string",
+		},
+		{
+			name:    "declared type wins",
+			src:     "{{/* @param Price int64 */}}{{ add .Price 1 }}",
+			wantErr: "wrong type for argument 1 of add: expected int; got .Price of type int64",
+		},
+		{
+			name:    "wrong number of arguments",
+			src:     "{{ add .Price }}",
+			wantErr: "wrong number of args for add: want 2 got 1",
+		},
+		{
+			name:    "too few variadic arguments",
+			src:     "{{ join }}",
+			wantErr: "wrong number of args for join: want at least 1 got 0",
+		},
+		{
+			name:    "literal",
+			src:     `{{ add .Price "1" }}`,
+			wantErr: `wrong type for argument 2 of add: expected int; got "1"`,
+		},
+		{
+			name:    "result of another function",
+			src:     "{{ formatDate .CreatedAt | add 1 }}",
+			wantErr: "wrong type for argument 2 of add: expected int; got the result of formatDate of type string",
+		},
+		{
+			name:    "generated struct",
+			src:     "{{ upper .User }}{{ .User.Name }}",
+			wantErr: "got .User of a type generated from the template; declare its type with @param",
+		},
+		{
+			name:    "conflicts with the template's usage",
+			src:     "{{ if eq .Count 0 }}{{ end }}{{ upper .Count }}",
+			wantErr: "wrong type for argument 1 of upper: expected string; got .Count of type int",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := scan.ScanTemplate(tt.src)
+			if err != nil {
+				t.Fatalf("ScanTemplate failed: %v", err)
+			}
+			typed, err := Resolve(schema, tt.src, WithFuncs(sigs))
+			if tt.wantErr != "" {
+				var d *diag.Diagnostic
+				if !errors.As(err, &d) || d.Code != diag.CodeFunc || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Resolve() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for path, want := range tt.want {
+				if got := typed.Fields[path].GoType; got != want {
+					t.Errorf("%s: got %s, want %s", path, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckModelCalls(t *testing.T) {
+	pkg := checkPackage(t, `package models
+
+type Invoice struct {
+	Number string
+	Lines  []Line
+}
+
+type Line struct{ Amount int }
+
+func add(a, b int) int        { return a + b }
+func upper(s string) string { return s }
+`)
+	invoice := pkg.Scope().Lookup("Invoice").Type()
+	sigs := map[string]*types.Signature{
+		"add":   pkg.Scope().Lookup("add").(*types.Func).Signature(),
+		"upper": pkg.Scope().Lookup("upper").(*types.Func).Signature(),
+	}
+
+	schema, err := scan.ScanTemplate("{{ upper .Number }}{{ range .Lines }}{{ add .Amount 1 }}{{ end }}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckModelCalls(schema, invoice, WithFuncs(sigs)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	schema, err = scan.ScanTemplate("{{ range .Lines }}{{ upper .Amount }}{{ end }}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = CheckModelCalls(schema, invoice, WithFuncs(sigs))
+	if want := "wrong type for argument 1 of upper: expected string; got .Lines.Amount of type int"; err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("CheckModelCalls() error = %v, want %q", err, want)
+	}
+}
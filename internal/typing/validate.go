@@ -0,0 +1,178 @@
+package typing
+
+import (
+	"fmt"
+	"go/types"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/bellwood4486/tmpltype/internal/diag"
+	"github.com/bellwood4486/tmpltype/internal/scan"
+	"github.com/bellwood4486/tmpltype/internal/typing/magic"
+	"github.com/bellwood4486/tmpltype/internal/util"
+)
+
+// ============================================================
+// @param Validation
+// ============================================================
+
+// validator checks declared types against how fields are used in a template
+type validator struct {
+	// @type で宣言された型（名前 -> 型）。これらの名前は構造を展開して検証する
+	types map[string]magic.TypeExpr
+	// @import で宣言されたパッケージ（パッケージ名 -> パッケージ）。これらの型は go/types の情報で検証する
+	pkgs map[string]*types.Package
+	// カスタム関数のシグネチャ（関数名 -> シグネチャ）。呼び出しの引数を検証し、引数の型を推論する
+	funcs map[string]*types.Signature
+}
+
+// validateOverrides checks that each @param type is compatible with how the field is used
+// 例: @param User.Age int に対して {{ range .User.Age }} は生成できても実行時にエラーになる
+func (v validator) validateOverrides(schema scan.Schema, directives []magic.ParamDirective) error {
+	for _, d := range directives {
+		if err := v.checkPackages(d.Type); err != nil {
+			return diag.Errorf(diag.CodeImport, "", d.Line, d.Col, "@param %s %s: %v", d.Path, d.Type.String(), err)
+		}
+		path := strings.Split(d.Path, ".")
+		field := lookupField(schema, path)
+		if field == nil {
+			// テンプレートで使われていないパスは検証しない
+			continue
+		}
+		if err := v.checkFieldType(d.Path, field, d.Type); err != nil {
+			return diag.Errorf(diag.CodeParamType, "", d.Line, d.Col, "@param %s %s: %v", d.Path, d.Type.String(), err)
+		}
+	}
+	return nil
+}
+
+// lookupField finds the scanned field for a @param path
+// スライス・マップのパスは要素のフィールドをたどる（@param Items.Title は要素の Title を指す）
+func lookupField(schema scan.Schema, path []string) *scan.Field {
+	field := schema.Fields[path[0]]
+	for _, name := range path[1:] {
+		if field == nil {
+			return nil
+		}
+		if (field.Kind == scan.KindSlice || field.Kind == scan.KindMap) && field.Elem != nil {
+			field = field.Elem
+		}
+		field = field.Children[name]
+	}
+	return field
+}
+
+// checkFieldType recursively checks a field usage against its declared type
+func (v validator) checkFieldType(path string, field *scan.Field, typ magic.TypeExpr) error {
+	typ = v.expand(typ)
+	// @import したパッケージの型は go/types の情報で検証する
+	if typ.Kind == magic.TypeKindBase {
+		if t := v.lookupType(typ.BaseType); t != nil {
+			return v.checkGoType(path, field, t)
+		}
+	}
+	// それ以外の名前付き型や外部パッケージの型は構造が分からないので検証しない
+	if typ.Kind == magic.TypeKindBase && !isBuiltinType(typ.BaseType) || typ.BaseType == "any" {
+		return nil
+	}
+
+	switch field.Kind {
+	case scan.KindSlice:
+		if typ.Kind == magic.TypeKindBase && isIntegerType(typ.BaseType) {
+			return nil
+		}
+		if typ.Kind != magic.TypeKindSlice && typ.Kind != magic.TypeKindMap {
+			return fmt.Errorf("%s is used with range, but %s cannot be ranged over", path, typ.String())
+		}
+		return v.checkElemType(path, field, typ)
+
+	case scan.KindMap:
+		if typ.Kind != magic.TypeKindSlice && typ.Kind != magic.TypeKindMap {
+			return fmt.Errorf("%s is used with index or a key/value range, but %s is not a map or slice", path, typ.String())
+		}
+		return v.checkElemType(path, field, typ)
+
+	case scan.KindStruct:
+		return v.checkChildren(path, field, typ)
+
+	case scan.KindInt, scan.KindFloat:
+		if typ.Kind != magic.TypeKindBase || !isNumericType(typ.BaseType) {
+			return fmt.Errorf("%s is compared or formatted as a number, but %s is not numeric", path, typ.String())
+		}
+	}
+	return nil
+}
+
+// expand dereferences pointers and replaces @type names with their declared types
+// 宣言どうしが互いを参照していても止まるよう、展開の回数を宣言の数までに制限する
+func (v validator) expand(typ magic.TypeExpr) magic.TypeExpr {
+	for range len(v.types) + 1 {
+		// テンプレートはポインタを自動的にたどる
+		for typ.Kind == magic.TypeKindPointer && typ.Elem != nil {
+			typ = *typ.Elem
+		}
+		decl, ok := v.types[typ.BaseType]
+		if typ.Kind != magic.TypeKindBase || !ok {
+			break
+		}
+		typ = decl
+	}
+	return typ
+}
+
+// checkElemType checks slice or map element usages against the element type
+func (v validator) checkElemType(path string, field *scan.Field, typ magic.TypeExpr) error {
+	if field.Elem == nil || typ.Elem == nil {
+		return nil
+	}
+	return v.checkFieldType(path, field.Elem, *typ.Elem)
+}
+
+// checkChildren checks child field accesses against a struct or map type
+func (v validator) checkChildren(path string, field *scan.Field, typ magic.TypeExpr) error {
+	for _, name := range slices.Sorted(maps.Keys(field.Children)) {
+		child := field.Children[name]
+		childPath := path + "." + name
+
+		switch typ.Kind {
+		case magic.TypeKindStruct:
+			idx := slices.IndexFunc(typ.Fields, func(f magic.FieldDef) bool {
+				return util.Export(f.Name) == util.Export(name)
+			})
+			if idx < 0 {
+				return fmt.Errorf("%s is used, but %s has no field %s", childPath, typ.String(), name)
+			}
+			if err := v.checkFieldType(childPath, child, typ.Fields[idx].Type); err != nil {
+				return err
+			}
+		case magic.TypeKindMap:
+			// map[string]T の .key アクセスは要素の参照になる
+			if typ.Elem == nil {
+				continue
+			}
+			if err := v.checkFieldType(childPath, child, *typ.Elem); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%s is used, but %s has no fields", childPath, typ.String())
+		}
+	}
+	return nil
+}
+
+// isIntegerType reports whether a value of the type can be ranged over as an integer
+func isIntegerType(typeName string) bool {
+	switch typeName {
+	case "int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64",
+		"byte", "rune":
+		return true
+	}
+	return false
+}
+
+// isNumericType reports whether the type can be compared or formatted as a number
+func isNumericType(typeName string) bool {
+	return isIntegerType(typeName) || typeName == "float32" || typeName == "float64"
+}
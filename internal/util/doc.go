@@ -2,4 +2,5 @@
 //
 // 現在提供されている機能:
 //   - Export: 識別子を Go のエクスポート済み識別子に変換
+//   - ExportName: テンプレート名を略語を考慮した Go のエクスポート済み識別子に変換
 package util
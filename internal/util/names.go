@@ -44,3 +44,36 @@ func Export(name string) string {
 
 	return string(r)
 }
+
+// commonInitialisms は ExportName で大文字のまま表記する略語です。
+var commonInitialisms = map[string]bool{
+	"api": true, "ascii": true, "css": true, "csv": true, "dns": true,
+	"html": true, "http": true, "https": true, "id": true, "ip": true,
+	"json": true, "pdf": true, "sms": true, "sql": true, "ui": true,
+	"uri": true, "url": true, "uuid": true, "xml": true,
+}
+
+// ExportName はテンプレート名やディレクトリ名から Go のエクスポートされた識別子を生成します。
+//
+// Export と同様にアンダースコア区切りの名前をキャメルケースに変換しますが、
+// "html" や "id" のような一般的な略語は Go の命名規則に合わせてすべて大文字にします。
+//
+// 例:
+//   - "invite" -> "Invite"
+//   - "html" -> "HTML"
+//   - "user_id" -> "UserID"
+//   - "mail_invite" -> "MailInvite"
+func ExportName(name string) string {
+	var result strings.Builder
+	for _, part := range strings.Split(name, "_") {
+		if part == "" {
+			continue
+		}
+		if commonInitialisms[strings.ToLower(part)] {
+			result.WriteString(strings.ToUpper(part))
+			continue
+		}
+		result.WriteString(Export(part))
+	}
+	return result.String()
+}
@@ -34,3 +34,30 @@ func TestExport(t *testing.T) {
 		})
 	}
 }
+
+func TestExportName(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		name string
+	}{
+		{in: "", want: "", name: "empty"},
+		{in: "invite", want: "Invite", name: "lower ascii"},
+		{in: "html", want: "HTML", name: "initialism"},
+		{in: "HTML", want: "HTML", name: "initialism already upper"},
+		{in: "user_id", want: "UserID", name: "snake_case with initialism"},
+		{in: "api_url", want: "APIURL", name: "consecutive initialisms"},
+		{in: "mail_invite", want: "MailInvite", name: "snake_case two words"},
+		{in: "identity", want: "Identity", name: "initialism prefix only"},
+		{in: "メール", want: "メール", name: "non-ascii japanese"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ExportName(tt.in)
+			if got != tt.want {
+				t.Fatalf("ExportName(%q) = %q; want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}